@@ -0,0 +1,299 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"sort"
+)
+
+type arangesCheckMode int
+
+const (
+	noArangesCheck  arangesCheckMode = 0
+	yesArangesCheck arangesCheckMode = 1
+)
+
+// arangeSet is a single set from .debug_aranges: the address ranges
+// belonging to the CU at offset 'infoOff'.
+type arangeSet struct {
+	off      int64 // offset of the set header
+	infoOff  int64
+	addrSize int
+	ranges   [][2]uint64
+}
+
+// parseAranges decodes the contents of a .debug_aranges section.
+func parseAranges(data []byte, of *objFile) ([]arangeSet, error) {
+	var rv []arangeSet
+	b := &llbuf{data: data, order: of.byteOrder(), what: ".debug_aranges"}
+	for b.off < int64(len(data)) {
+		s := arangeSet{off: b.off}
+		length := b.u32()
+		is64 := false
+		if length == 0xffffffff {
+			length = b.u64()
+			is64 = true
+		}
+		end := b.off + int64(length)
+		if b.err != nil {
+			return rv, b.err
+		}
+		if end > int64(len(data)) || end < b.off {
+			return rv, fmt.Errorf("set at 0x%x: length 0x%x overruns section", s.off, length)
+		}
+		if v := b.u16(); v != 2 {
+			return rv, fmt.Errorf("set at 0x%x: unsupported version %d", s.off, v)
+		}
+		if is64 {
+			s.infoOff = int64(b.u64())
+		} else {
+			s.infoOff = int64(b.u32())
+		}
+		s.addrSize = int(b.u8())
+		if seg := b.u8(); seg != 0 {
+			return rv, fmt.Errorf("set at 0x%x: segment selectors not supported", s.off)
+		}
+		if s.addrSize != 4 && s.addrSize != 8 {
+			return rv, fmt.Errorf("set at 0x%x: unsupported address size %d", s.off, s.addrSize)
+		}
+		// Tuples are aligned to twice the address size, measured from
+		// the start of the set.
+		tsize := int64(2 * s.addrSize)
+		b.off = s.off + (b.off-s.off+tsize-1)/tsize*tsize
+		for b.off+tsize <= end {
+			lo, n := b.addr(s.addrSize), b.addr(s.addrSize)
+			if lo == 0 && n == 0 {
+				break
+			}
+			s.ranges = append(s.ranges, [2]uint64{lo, lo + n})
+		}
+		if b.err != nil {
+			return rv, fmt.Errorf("set at 0x%x: %v", s.off, b.err)
+		}
+		rv = append(rv, s)
+		b.off = end
+	}
+	return rv, nil
+}
+
+// mergeRanges returns the union of 'ranges' as a sorted list of
+// disjoint ranges. Empty ranges and ranges starting at address zero
+// (left behind by code the linker discarded) are dropped.
+func mergeRanges(ranges [][2]uint64) [][2]uint64 {
+	var rs [][2]uint64
+	for _, r := range ranges {
+		if r[0] != 0 && r[1] > r[0] {
+			rs = append(rs, r)
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i][0] < rs[j][0] })
+	var rv [][2]uint64
+	for _, r := range rs {
+		if n := len(rv); n > 0 && r[0] <= rv[n-1][1] {
+			if r[1] > rv[n-1][1] {
+				rv[n-1][1] = r[1]
+			}
+			continue
+		}
+		rv = append(rv, r)
+	}
+	return rv
+}
+
+// subtractRanges returns the parts of 'a' not covered by 'b'; both
+// must be sorted and disjoint, as produced by mergeRanges.
+func subtractRanges(a, b [][2]uint64) [][2]uint64 {
+	var rv [][2]uint64
+	j := 0
+	for _, r := range a {
+		lo := r[0]
+		for j < len(b) && b[j][1] <= lo {
+			j++
+		}
+		for k := j; k < len(b) && b[k][0] < r[1]; k++ {
+			if b[k][0] > lo {
+				rv = append(rv, [2]uint64{lo, b[k][0]})
+			}
+			if b[k][1] > lo {
+				lo = b[k][1]
+			}
+		}
+		if lo < r[1] {
+			rv = append(rv, [2]uint64{lo, r[1]})
+		}
+	}
+	return rv
+}
+
+// checkAranges validates .debug_aranges: each set must name a real
+// CU, its ranges must agree with the CU's own PC ranges, and no
+// address may be claimed by two CUs. CUs with code but no set are
+// also reported. Returns false if problems were found.
+func checkAranges(of *objFile, d *dwarf.Data) (bool, error) {
+	data, err := of.sectionData(".debug_aranges")
+	if err != nil {
+		return false, err
+	}
+	if data == nil {
+		verb(1, "no .debug_aranges section")
+		return true, nil
+	}
+	sets, err := parseAranges(data, of)
+	if err != nil {
+		return !reportf("aranges", ".debug_aranges", "decode", site{}, ".debug_aranges: %v", err), nil
+	}
+	info, err := of.sectionData(".debug_info")
+	if err != nil {
+		return false, err
+	}
+	units, err := parseUnitHeaders(info, of.byteOrder(), false)
+	if err != nil {
+		return false, err
+	}
+	unitAt := make(map[int64]*unitHeader)
+	for i := range units {
+		unitAt[units[i].off] = &units[i]
+	}
+
+	// Collect each CU's name and PC ranges.
+	type cuInfo struct {
+		name   string
+		die    dwarf.Offset
+		ranges [][2]uint64
+	}
+	cus := make(map[int64]*cuInfo)
+	var cuOffs []int64
+	ui := 0
+	rdr := d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return false, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag != dwarf.TagCompileUnit && ent.Tag != dwarf.TagPartialUnit {
+			rdr.SkipChildren()
+			continue
+		}
+		for ui < len(units) && units[ui].end <= int64(ent.Offset) {
+			ui++
+		}
+		if ui >= len(units) {
+			return false, fmt.Errorf("CU DIE at 0x%x lies outside any unit", ent.Offset)
+		}
+		ranges, err := d.Ranges(ent)
+		if err != nil {
+			return false, err
+		}
+		name, _ := ent.Val(dwarf.AttrName).(string)
+		cus[units[ui].off] = &cuInfo{name: name, die: ent.Offset, ranges: mergeRanges(ranges)}
+		cuOffs = append(cuOffs, units[ui].off)
+		rdr.SkipChildren()
+	}
+
+	// Addresses in relocatable objects are section-relative, so only
+	// the structure of the sets can be checked.
+	isRel := of.ef != nil && of.ef.Type == elf.ET_REL
+
+	ok := true
+	type owned struct {
+		r  [2]uint64
+		cu int64
+	}
+	var all []owned
+	seen := make(map[int64]int64)
+	for _, s := range sets {
+		u := unitAt[s.infoOff]
+		if u == nil {
+			if reportf("aranges", ".debug_aranges", "unit header", site{},
+				".debug_aranges: set at 0x%x refers to 0x%x, which is not a unit header in .debug_info",
+				s.off, s.infoOff) {
+				ok = false
+			}
+			continue
+		}
+		cu := cus[s.infoOff]
+		cuName := ""
+		var at site
+		if cu != nil {
+			cuName = cu.name
+			at.dies = []dwarf.Offset{cu.die}
+		}
+		what := fmt.Sprintf(".debug_aranges: set at 0x%x for CU at 0x%x", s.off, s.infoOff)
+		if cu != nil && cu.name != "" {
+			what += " (" + cu.name + ")"
+		}
+		if prev, dup := seen[s.infoOff]; dup {
+			if reportf("aranges", cuName, "duplicate set", at, "%s: duplicates set at 0x%x", what, prev) {
+				ok = false
+			}
+			continue
+		}
+		seen[s.infoOff] = s.off
+		if s.addrSize != u.addrSize {
+			if reportf("aranges", cuName, "address size", at, "%s: address size %d, but the CU's is %d", what, s.addrSize, u.addrSize) {
+				ok = false
+			}
+		}
+		if isRel || cu == nil {
+			continue
+		}
+		ar := mergeRanges(s.ranges)
+		for _, r := range subtractRanges(ar, cu.ranges) {
+			if reportf("aranges", cuName, "extra range", at, "%s: covers [0x%x,0x%x), which is outside the CU's PC ranges", what, r[0], r[1]) {
+				ok = false
+			}
+		}
+		for _, r := range subtractRanges(cu.ranges, ar) {
+			if reportf("aranges", cuName, "missing range", at, "%s: CU's PC range [0x%x,0x%x) is missing", what, r[0], r[1]) {
+				ok = false
+			}
+		}
+		for _, r := range ar {
+			all = append(all, owned{r, s.infoOff})
+		}
+	}
+	verb(1, "checked %d .debug_aranges sets", len(sets))
+	if isRel {
+		return ok, nil
+	}
+
+	for _, off := range cuOffs {
+		if cu := cus[off]; len(cu.ranges) != 0 {
+			if _, found := seen[off]; !found {
+				if reportf("aranges", cu.name, "no set", site{dies: []dwarf.Offset{cu.die}}, ".debug_aranges: no set for CU at 0x%x (%s), which has code at 0x%x",
+					off, cu.name, cu.ranges[0][0]) {
+					ok = false
+				}
+			}
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].r[0] < all[j].r[0] })
+	// 'top' is the range seen so far that extends furthest.
+	var top owned
+	for i, c := range all {
+		if i > 0 && c.r[0] < top.r[1] && c.cu != top.cu {
+			if reportf("aranges", cus[top.cu].name+" and "+cus[c.cu].name, "overlap",
+				site{dies: []dwarf.Offset{cus[top.cu].die, cus[c.cu].die}},
+				".debug_aranges: [0x%x,0x%x) is claimed by both CU at 0x%x and CU at 0x%x",
+				c.r[0], minU64(c.r[1], top.r[1]), top.cu, c.cu) {
+				ok = false
+			}
+		}
+		if i == 0 || c.r[1] > top.r[1] {
+			top = c
+		}
+	}
+	return ok, nil
+}
+
+func minU64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"debug/elf"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMergeRanges(t *testing.T) {
+	got := mergeRanges([][2]uint64{{0x30, 0x40}, {0, 0x10}, {0x10, 0x20}, {0x18, 0x28}, {0x50, 0x50}})
+	want := [][2]uint64{{0x10, 0x28}, {0x30, 0x40}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeRanges = %x, want %x", got, want)
+	}
+	got = subtractRanges([][2]uint64{{0x10, 0x40}, {0x50, 0x60}}, [][2]uint64{{0x18, 0x20}, {0x30, 0x58}})
+	want = [][2]uint64{{0x10, 0x18}, {0x20, 0x30}, {0x58, 0x60}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("subtractRanges = %x, want %x", got, want)
+	}
+}
+
+func TestAranges(t *testing.T) {
+	dir := t.TempDir()
+	a, b, _ := buildRelocObjects(t, dir)
+	cc, _ := exec.LookPath("gcc")
+	exe := filepath.Join(dir, "aranges.exe")
+	cmd := exec.Command(cc, "-g", "-o", exe, filepath.Join("testdata", "relocmain.c"), a, b)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Logf("build: %s\n", out)
+		t.Fatalf("build error: %v", err)
+	}
+	of, d := loadObj(t, exe)
+	if of.ef == nil || of.ef.Section(".debug_aranges") == nil {
+		t.Skip("no .debug_aranges to check")
+	}
+	if ok, err := checkAranges(of, d); err != nil || !ok {
+		t.Fatalf("checkAranges = %v, %v", ok, err)
+	}
+
+	// Corrupt the first set: extend its first range, and point the
+	// second set at a bogus CU offset.
+	content, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := of.ef.Section(".debug_aranges")
+	sets, err := parseAranges(content[s.Offset:s.Offset+s.Size], of)
+	if err != nil || len(sets) < 2 || of.ef.Class != elf.ELFCLASS64 {
+		t.Skipf("unexpected .debug_aranges layout (%d sets, %v)", len(sets), err)
+	}
+	order := of.byteOrder()
+	p := s.Offset + 16 + 8 // 32-bit header padded to 16; length follows address
+	order.PutUint64(content[p:], order.Uint64(content[p:])+0x1000)
+	order.PutUint32(content[s.Offset+uint64(sets[1].off)+6:], 1)
+	bad := filepath.Join(dir, "bad.exe")
+	if err := ioutil.WriteFile(bad, content, 0755); err != nil {
+		t.Fatal(err)
+	}
+	of, d = loadObj(t, bad)
+	if ok, err := checkAranges(of, d); err != nil || ok {
+		t.Errorf("checkAranges on corrupted aranges = %v, %v", ok, err)
+	}
+}
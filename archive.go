@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	arMagic     = "!<arch>\n"
+	arThinMagic = "!<thin>\n"
+	arHdrSize   = 60
+)
+
+// goObjMagic starts object files in the Go toolchain's own format,
+// as found in Go package archives; these carry no DWARF.
+const goObjMagic = "go object "
+
+// arMember is a single member of an ar archive.
+type arMember struct {
+	name string
+	off  int64 // offset of the member's contents
+	size int64
+}
+
+// isArchive reports whether 'r' starts with the ar archive magic.
+func isArchive(r io.ReaderAt) bool {
+	var buf [len(arMagic)]byte
+	if _, err := r.ReadAt(buf[:], 0); err != nil {
+		return false
+	}
+	return string(buf[:]) == arMagic || string(buf[:]) == arThinMagic
+}
+
+// readArchive returns the members of the ar archive 'r', which is
+// 'size' bytes long. Both the GNU ("/" terminated names, with long
+// names in a "//" member) and BSD ("#1/<len>" names stored ahead of
+// the contents) variants are handled. Symbol tables and the Go
+// __.PKGDEF member are omitted.
+func readArchive(r io.ReaderAt, size int64) ([]arMember, error) {
+	var magic [len(arMagic)]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return nil, err
+	}
+	if string(magic[:]) == arThinMagic {
+		return nil, fmt.Errorf("thin archives are not supported")
+	}
+	if string(magic[:]) != arMagic {
+		return nil, fmt.Errorf("not an ar archive")
+	}
+	var rv []arMember
+	var longNames []byte
+	off := int64(len(arMagic))
+	for off < size {
+		var hdr [arHdrSize]byte
+		if _, err := r.ReadAt(hdr[:], off); err != nil {
+			return rv, fmt.Errorf("reading member header at offset 0x%x: %v", off, err)
+		}
+		if string(hdr[58:60]) != "`\n" {
+			return rv, fmt.Errorf("bad member header at offset 0x%x", off)
+		}
+		msize, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil || msize < 0 || off+arHdrSize+msize > size {
+			return rv, fmt.Errorf("bad member size at offset 0x%x", off)
+		}
+		m := arMember{off: off + arHdrSize, size: msize}
+		name := strings.TrimRight(string(hdr[0:16]), " ")
+		switch {
+		case name == "//":
+			longNames = make([]byte, msize)
+			if _, err := r.ReadAt(longNames, m.off); err != nil {
+				return rv, err
+			}
+			name = ""
+		case name == "/" || name == "/SYM64/":
+			name = ""
+		case strings.HasPrefix(name, "#1/"):
+			n, err := strconv.Atoi(name[3:])
+			if err != nil || n < 0 || int64(n) > msize {
+				return rv, fmt.Errorf("bad BSD member name %q at offset 0x%x", name, off)
+			}
+			nb := make([]byte, n)
+			if _, err := r.ReadAt(nb, m.off); err != nil {
+				return rv, err
+			}
+			name = string(bytes.TrimRight(nb, "\x00"))
+			m.off += int64(n)
+			m.size -= int64(n)
+		case strings.HasPrefix(name, "/"):
+			idx, err := strconv.Atoi(name[1:])
+			if err != nil || idx < 0 || idx >= len(longNames) {
+				return rv, fmt.Errorf("bad long member name %q at offset 0x%x", name, off)
+			}
+			ln := longNames[idx:]
+			if end := bytes.IndexByte(ln, '\n'); end >= 0 {
+				ln = ln[:end]
+			}
+			name = strings.TrimSuffix(string(ln), "/")
+		default:
+			name = strings.TrimSuffix(name, "/")
+		}
+		switch name {
+		case "", "__.PKGDEF", "__.SYMDEF", "__.SYMDEF SORTED", "__.SYMDEF_64", "__.SYMDEF_64 SORTED":
+		default:
+			m.name = name
+			rv = append(rv, m)
+		}
+		off += arHdrSize + msize
+		off += off & 1
+	}
+	return rv, nil
+}
+
+// examineArchive checks each object file member of the archive
+// 'filename', naming the member in any diagnostics.
+func examineArchive(filename string, r io.ReaderAt, size int64, o options) bool {
+	members, err := readArchive(r, size)
+	if err != nil {
+		warn("unable to read archive %s: %v", filename, err)
+		setExit(exitNotObject)
+		return false
+	}
+	ok := true
+	save := diagLabel
+	for _, m := range members {
+		label := fmt.Sprintf("%s(%s)", filename, m.name)
+		sr := io.NewSectionReader(r, m.off, m.size)
+		var buf [len(goObjMagic)]byte
+		if _, err := sr.ReadAt(buf[:], 0); err == nil && string(buf[:]) == goObjMagic {
+			warn("note: skipping %s: Go object files carry no DWARF", label)
+			continue
+		}
+		verb(1, "examining archive member %s", label)
+		diagLabel = label
+		if !examineObject(label, sr, o) {
+			ok = false
+		}
+		diagLabel = save
+	}
+	return ok
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// buildRelocObjects compiles testdata/reloc.c into two objects with
+// distinct symbols, and combines them with "ld -r" into a third
+// relocatable object containing two CUs.
+func buildRelocObjects(t *testing.T, dir string) (a, b, ab string) {
+	cc, err := exec.LookPath("gcc")
+	if err != nil {
+		t.Skip("no gcc available")
+	}
+	ld, err := exec.LookPath("ld")
+	if err != nil {
+		t.Skip("no ld available")
+	}
+	run := func(tool string, args ...string) {
+		if out, err := exec.Command(tool, args...).CombinedOutput(); err != nil {
+			t.Logf("%s: %s\n", tool, out)
+			t.Fatalf("%s %v: %v", tool, args, err)
+		}
+	}
+	a = filepath.Join(dir, "a.o")
+	b = filepath.Join(dir, "a_rather_long_member_name.o")
+	ab = filepath.Join(dir, "ab.o")
+	for i, obj := range []string{a, b} {
+		run(cc, "-g", "-gdwarf-4", "-O2", "-c", "-DSUFFIX="+string(rune('a'+i)),
+			"-o", obj, filepath.Join("testdata", "reloc.c"))
+	}
+	run(ld, "-r", "-o", ab, a, b)
+	return a, b, ab
+}
+
+func TestRelocatableObject(t *testing.T) {
+	a, _, ab := buildRelocObjects(t, t.TempDir())
+	of, _ := loadObj(t, ab)
+	if of.ef == nil {
+		t.Skip("test requires ELF objects")
+	}
+	if !examineFile(ab, options{dc: yesDoAbsChecks}) {
+		t.Errorf("examineFile returned false for %s", ab)
+	}
+
+	// The unit headers' abbrev offsets are filled in by relocations;
+	// the second CU's abbreviations follow those of the first.
+	info, err := of.sectionData(".debug_info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	units, err := parseUnitHeaders(info, of.byteOrder(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(units) != 2 {
+		t.Fatalf("found %d units, want 2", len(units))
+	}
+	aof, _ := loadObj(t, a)
+	abbrev, err := aof.sectionData(".debug_abbrev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// DWARF 4, 32-bit: unit_length, version, debug_abbrev_offset.
+	u := units[1]
+	if got := of.byteOrder().Uint32(info[u.off+6:]); int(got) != len(abbrev) {
+		t.Errorf("second CU abbrev offset 0x%x, want 0x%x", got, len(abbrev))
+	}
+}
+
+func TestArchive(t *testing.T) {
+	ar, err := exec.LookPath("ar")
+	if err != nil {
+		t.Skip("no ar available")
+	}
+	dir := t.TempDir()
+	a, b, _ := buildRelocObjects(t, dir)
+	lib := filepath.Join(dir, "lib.a")
+	if out, err := exec.Command(ar, "rcs", lib, a, b).CombinedOutput(); err != nil {
+		t.Logf("ar: %s\n", out)
+		t.Fatalf("ar: %v", err)
+	}
+	f, err := os.Open(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	members, err := readArchive(f, fi.Size())
+	if err != nil {
+		t.Fatalf("readArchive: %v", err)
+	}
+	if len(members) != 2 || members[0].name != filepath.Base(a) ||
+		members[1].name != filepath.Base(b) {
+		t.Errorf("unexpected archive members %+v", members)
+	}
+	if !examineFile(lib, options{dc: yesDoAbsChecks}) {
+		t.Errorf("examineFile returned false for %s", lib)
+	}
+
+	// A Go package archive holds only Go object files, which are
+	// skipped.
+	goa := filepath.Join(dir, "dwexaminer.a")
+	gotoolpath := filepath.Join(runtime.GOROOT(), "bin", "go")
+	cmd := exec.Command(gotoolpath, "build", "-o", goa, "./dwexaminer")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Logf("build: %s\n", out)
+		t.Fatalf("build error: %v", err)
+	}
+	if !examineFile(goa, options{dc: yesDoAbsChecks}) {
+		t.Errorf("examineFile returned false for %s", goa)
+	}
+}
+
+func TestArchiveBSDNames(t *testing.T) {
+	member := func(name, data string) string {
+		return fmt.Sprintf("%-16s%-12d%-6d%-6d%-8s%-10d`\n", name, 0, 0, 0, "644", len(data)) + data
+	}
+	good := arMagic + member("#1/8", "long.o\x00\x00contents")
+	members, err := readArchive(strings.NewReader(good), int64(len(good)))
+	if err != nil {
+		t.Fatalf("readArchive: %v", err)
+	}
+	if len(members) != 1 || members[0].name != "long.o" || members[0].size != 8 {
+		t.Errorf("unexpected archive members %+v", members)
+	}
+	for _, name := range []string{"#1/-5", "#1/99", "#1/x"} {
+		bad := arMagic + member(name, "long.o\x00\x00contents")
+		if _, err := readArchive(strings.NewReader(bad), int64(len(bad))); err == nil {
+			t.Errorf("archive with member name %q accepted", name)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func readAligned4(r io.Reader, sz uint32) ([]byte, error) {
+	full := (uint64(sz) + 3) &^ 3
+	data := make([]byte, full)
+	_, err := io.ReadFull(r, data)
+	if err != nil {
+		return nil, err
+	}
+	data = data[:sz]
+	return data, nil
+}
+
+// elfNote is a single entry from an ELF SHT_NOTE section.
+type elfNote struct {
+	name string // owner name, without NUL padding
+	typ  uint32
+	desc []byte
+}
+
+// ELF note types of interest.
+const (
+	ntGnuBuildId = 3 // NT_GNU_BUILD_ID, owner "GNU"
+	ntGoBuildId  = 4 // Go build ID, owner "Go", in .note.go.buildid
+)
+
+// maxNoteSize bounds the name and descriptor sizes we are willing to
+// read, to avoid huge allocations when handed a corrupt note.
+const maxNoteSize = 1 << 20
+
+// parseNotes decodes all of the notes in the contents of a note
+// section. Each note is consumed in its entirety (header, name and
+// descriptor) so that iteration stays in sync regardless of which
+// notes the caller is interested in.
+func parseNotes(r io.Reader, order binary.ByteOrder) ([]elfNote, error) {
+	var notes []elfNote
+	for {
+		var hdr struct {
+			Namesize, Descsize, Type uint32
+		}
+		if err := binary.Read(r, order, &hdr); err != nil {
+			if err == io.EOF {
+				return notes, nil
+			}
+			return notes, err
+		}
+		if hdr.Namesize > maxNoteSize || hdr.Descsize > maxNoteSize {
+			return notes, fmt.Errorf("implausible note sizes (name %d, desc %d)", hdr.Namesize, hdr.Descsize)
+		}
+		name, err := readAligned4(r, hdr.Namesize)
+		if err != nil {
+			return notes, err
+		}
+		desc, err := readAligned4(r, hdr.Descsize)
+		if err != nil {
+			return notes, err
+		}
+		notes = append(notes, elfNote{
+			name: strings.TrimRight(string(name), "\x00"),
+			typ:  hdr.Type,
+			desc: desc,
+		})
+	}
+}
+
+// findNote returns the descriptor of the first note in any of the
+// ELF file's note sections with the given owner and type, or nil.
+func findNote(ef *elf.File, owner string, typ uint32) []byte {
+	for _, sect := range ef.Sections {
+		if sect.Type != elf.SHT_NOTE {
+			continue
+		}
+		notes, _ := parseNotes(sect.Open(), ef.ByteOrder)
+		for _, n := range notes {
+			if n.name == owner && n.typ == typ {
+				return n.desc
+			}
+		}
+	}
+	return nil
+}
+
+// gnuBuildId returns the GNU build ID for an ELF file, or nil if it
+// doesn't have one.
+func gnuBuildId(ef *elf.File) []byte {
+	return findNote(ef, "GNU", ntGnuBuildId)
+}
+
+// goBuildId returns the Go build ID recorded in an ELF file (normally
+// in the .note.go.buildid section), or nil if there is none.
+func goBuildId(ef *elf.File) []byte {
+	return findNote(ef, "Go", ntGoBuildId)
+}
+
+func dumpBuildIdsInNoteSection(ef *elf.File, sect *elf.Section) error {
+	notes, err := parseNotes(sect.Open(), ef.ByteOrder)
+	for _, n := range notes {
+		var descStr string
+		switch {
+		case n.name == "GNU" && n.typ == ntGnuBuildId:
+			descStr = hex.EncodeToString(n.desc)
+		case n.name == "Go" && n.typ == ntGoBuildId:
+			descStr = string(n.desc)
+		default:
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "found build id '%s' in section `%s` notename `%s`\n", descStr, sect.Name, n.name)
+	}
+	return err
+}
+
+func dumpBuildId(ef *elf.File) {
+	for _, sect := range ef.Sections {
+		if sect.Type != elf.SHT_NOTE {
+			continue
+		}
+		if err := dumpBuildIdsInNoteSection(ef, sect); err != nil {
+			warn("error reading notes in section %s: %v", sect.Name, err)
+		}
+	}
+}
+
+// loadCmdUUID is the Mach-O LC_UUID load command, which debug/macho
+// doesn't define.
+const loadCmdUUID macho.LoadCmd = 0x1b
+
+// formatUUID renders a 16 byte UUID in the usual 8-4-4-4-12 form.
+func formatUUID(u []byte) string {
+	h := strings.ToUpper(hex.EncodeToString(u))
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// machoUUID returns the LC_UUID of a Mach-O file, or nil.
+func machoUUID(mf *macho.File) []byte {
+	for _, l := range mf.Loads {
+		raw := l.Raw()
+		if len(raw) < 24 || macho.LoadCmd(mf.ByteOrder.Uint32(raw)) != loadCmdUUID {
+			continue
+		}
+		return raw[8:24]
+	}
+	return nil
+}
+
+func dumpMachoBuildId(mf *macho.File) {
+	if u := machoUUID(mf); u != nil {
+		fmt.Fprintf(os.Stderr, "found build id '%s' in load command LC_UUID\n", formatUUID(u))
+	}
+}
+
+// codeViewInfo is the payload of a PE CodeView (RSDS) debug
+// directory entry, which identifies the matching PDB.
+type codeViewInfo struct {
+	guid string
+	age  uint32
+	pdb  string
+}
+
+const (
+	peDebugDirectoryEntry = 6 // IMAGE_DIRECTORY_ENTRY_DEBUG
+	peDebugTypeCodeView   = 2 // IMAGE_DEBUG_TYPE_CODEVIEW
+	peDebugDirEntrySize   = 28
+)
+
+// parseCodeView decodes an "RSDS" CodeView record.
+func parseCodeView(data []byte) (codeViewInfo, bool) {
+	if len(data) < 24 || string(data[:4]) != "RSDS" {
+		return codeViewInfo{}, false
+	}
+	g := data[4:20]
+	le := binary.LittleEndian
+	cv := codeViewInfo{
+		guid: fmt.Sprintf("%08X-%04X-%04X-%s-%s", le.Uint32(g[0:]),
+			le.Uint16(g[4:]), le.Uint16(g[6:]),
+			strings.ToUpper(hex.EncodeToString(g[8:10])),
+			strings.ToUpper(hex.EncodeToString(g[10:16]))),
+		age: le.Uint32(data[20:]),
+	}
+	pdb := data[24:]
+	if i := bytes.IndexByte(pdb, 0); i >= 0 {
+		pdb = pdb[:i]
+	}
+	cv.pdb = string(pdb)
+	return cv, true
+}
+
+// peReadRVA returns 'size' bytes at relative virtual address 'rva'.
+func peReadRVA(pf *pe.File, rva, size uint32) ([]byte, error) {
+	start, end := uint64(rva), uint64(rva)+uint64(size)
+	for _, s := range pf.Sections {
+		va := uint64(s.VirtualAddress)
+		if start < va || start >= va+uint64(s.VirtualSize) {
+			continue
+		}
+		if end > va+uint64(s.VirtualSize) || end-va > uint64(s.Size) {
+			return nil, fmt.Errorf("RVA 0x%x size 0x%x runs past the end of section %s", rva, size, s.Name)
+		}
+		data := make([]byte, size)
+		if _, err := s.ReadAt(data, int64(start-va)); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("RVA 0x%x size 0x%x not within any section", rva, size)
+}
+
+// peCodeView returns the CodeView records from a PE file's debug
+// directory.
+func peCodeView(pf *pe.File) ([]codeViewInfo, error) {
+	var dd pe.DataDirectory
+	switch oh := pf.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if oh.NumberOfRvaAndSizes <= peDebugDirectoryEntry {
+			return nil, nil
+		}
+		dd = oh.DataDirectory[peDebugDirectoryEntry]
+	case *pe.OptionalHeader64:
+		if oh.NumberOfRvaAndSizes <= peDebugDirectoryEntry {
+			return nil, nil
+		}
+		dd = oh.DataDirectory[peDebugDirectoryEntry]
+	default:
+		return nil, nil
+	}
+	if dd.VirtualAddress == 0 || dd.Size == 0 {
+		return nil, nil
+	}
+	dir, err := peReadRVA(pf, dd.VirtualAddress, dd.Size)
+	if err != nil {
+		return nil, err
+	}
+	var rv []codeViewInfo
+	le := binary.LittleEndian
+	for p := 0; p+peDebugDirEntrySize <= len(dir); p += peDebugDirEntrySize {
+		ent := dir[p : p+peDebugDirEntrySize]
+		if le.Uint32(ent[12:]) != peDebugTypeCodeView {
+			continue
+		}
+		size, rva := le.Uint32(ent[16:]), le.Uint32(ent[20:])
+		data, err := peReadRVA(pf, rva, size)
+		if err != nil {
+			return rv, err
+		}
+		if cv, ok := parseCodeView(data); ok {
+			rv = append(rv, cv)
+		}
+	}
+	return rv, nil
+}
+
+func dumpPEBuildId(pf *pe.File) {
+	cvs, err := peCodeView(pf)
+	if err != nil {
+		warn("error reading PE debug directory: %v", err)
+	}
+	for _, cv := range cvs {
+		fmt.Fprintf(os.Stderr, "found build id '%s' age %d in CodeView record for PDB `%s`\n",
+			cv.guid, cv.age, cv.pdb)
+	}
+}
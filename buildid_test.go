@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseNotes(t *testing.T) {
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	addNote := func(name string, typ uint32, desc []byte) {
+		n := []byte(name + "\x00")
+		binary.Write(&buf, le, uint32(len(n)))
+		binary.Write(&buf, le, uint32(len(desc)))
+		binary.Write(&buf, le, typ)
+		buf.Write(n)
+		buf.Write(make([]byte, (4-len(n)%4)%4))
+		buf.Write(desc)
+		buf.Write(make([]byte, (4-len(desc)%4)%4))
+	}
+	// A note we are not interested in, with an odd-sized descriptor,
+	// ahead of the ones we want; iteration must stay in sync.
+	addNote("stapsdt", 1, []byte{1, 2, 3, 4, 5})
+	addNote("GNU", ntGnuBuildId, []byte{0xde, 0xad, 0xbe, 0xef})
+	addNote("Go", ntGoBuildId, []byte("abc/def"))
+
+	notes, err := parseNotes(&buf, le)
+	if err != nil {
+		t.Fatalf("parseNotes: %v", err)
+	}
+	if len(notes) != 3 {
+		t.Fatalf("got %d notes, want 3", len(notes))
+	}
+	if n := notes[1]; n.name != "GNU" || n.typ != ntGnuBuildId ||
+		!bytes.Equal(n.desc, []byte{0xde, 0xad, 0xbe, 0xef}) {
+		t.Errorf("bad GNU note: %+v", n)
+	}
+	if n := notes[2]; n.name != "Go" || n.typ != ntGoBuildId || string(n.desc) != "abc/def" {
+		t.Errorf("bad Go note: %+v", n)
+	}
+
+	// Truncated input is reported.
+	if _, err := parseNotes(bytes.NewReader([]byte{8, 0, 0, 0, 0}), le); err == nil {
+		t.Errorf("expected error for truncated note")
+	}
+}
+
+func TestParseCodeView(t *testing.T) {
+	data := []byte("RSDS")
+	data = append(data, 0x78, 0x56, 0x34, 0x12, 0x34, 0x12, 0x78, 0x56,
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08)
+	data = append(data, 2, 0, 0, 0)
+	data = append(data, []byte("C:\\foo.pdb\x00")...)
+	cv, ok := parseCodeView(data)
+	if !ok {
+		t.Fatalf("parseCodeView failed")
+	}
+	if want := "12345678-1234-5678-0102-030405060708"; cv.guid != want {
+		t.Errorf("guid %s, want %s", cv.guid, want)
+	}
+	if cv.age != 2 || cv.pdb != "C:\\foo.pdb" {
+		t.Errorf("bad age/pdb: %+v", cv)
+	}
+	if _, ok := parseCodeView([]byte("NB10xxxxxxxxxxxxxxxxxxxxxx")); ok {
+		t.Errorf("non-RSDS record accepted")
+	}
+}
+
+func TestFormatUUID(t *testing.T) {
+	u := []byte{0x0a, 0x1b, 0x2c, 0x3d, 0x4e, 0x5f, 0x60, 0x71,
+		0x82, 0x93, 0xa4, 0xb5, 0xc6, 0xd7, 0xe8, 0xf9}
+	if got, want := formatUUID(u), "0A1B2C3D-4E5F-6071-8293-A4B5C6D7E8F9"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestPEReadRVA(t *testing.T) {
+	sect := func(va, vsize, size uint32) *pe.Section {
+		return &pe.Section{
+			SectionHeader: pe.SectionHeader{Name: ".rdata", VirtualAddress: va, VirtualSize: vsize, Size: size},
+			ReaderAt:      bytes.NewReader(make([]byte, size)),
+		}
+	}
+	pf := &pe.File{Sections: []*pe.Section{sect(0x1000, 0x100, 0x100), sect(0xffffff00, 0x100, 0x100)}}
+	if data, err := peReadRVA(pf, 0x1010, 0x20); err != nil || len(data) != 0x20 {
+		t.Errorf("reading within a section: %d bytes, %v", len(data), err)
+	}
+	for _, r := range [][2]uint32{
+		{0x10f0, 0x20},      // past the section end
+		{0xffffff80, 0x100}, // wraps around in 32 bits
+		{0x2000, 0x10},      // in no section
+	} {
+		if _, err := peReadRVA(pf, r[0], r[1]); err == nil {
+			t.Errorf("reading RVA 0x%x size 0x%x succeeded", r[0], r[1])
+		}
+	}
+}
@@ -0,0 +1,731 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type cfiCheckMode int
+
+const (
+	noCFICheck  cfiCheckMode = 0
+	yesCFICheck cfiCheckMode = 1
+)
+
+// DW_EH_PE pointer encodings used in .eh_frame and .eh_frame_hdr.
+const (
+	dwEhPeAbsptr   = 0x00
+	dwEhPeUleb128  = 0x01
+	dwEhPeUdata2   = 0x02
+	dwEhPeUdata4   = 0x03
+	dwEhPeUdata8   = 0x04
+	dwEhPeSleb128  = 0x09
+	dwEhPeSdata2   = 0x0a
+	dwEhPeSdata4   = 0x0b
+	dwEhPeSdata8   = 0x0c
+	dwEhPePcrel    = 0x10
+	dwEhPeDatarel  = 0x30
+	dwEhPeIndirect = 0x80
+	dwEhPeOmit     = 0xff
+)
+
+// Call frame instructions.
+const (
+	dwCfaNop                     = 0x00
+	dwCfaSetLoc                  = 0x01
+	dwCfaAdvanceLoc1             = 0x02
+	dwCfaAdvanceLoc2             = 0x03
+	dwCfaAdvanceLoc4             = 0x04
+	dwCfaOffsetExtended          = 0x05
+	dwCfaRestoreExtended         = 0x06
+	dwCfaUndefined               = 0x07
+	dwCfaSameValue               = 0x08
+	dwCfaRegister                = 0x09
+	dwCfaRememberState           = 0x0a
+	dwCfaRestoreState            = 0x0b
+	dwCfaDefCfa                  = 0x0c
+	dwCfaDefCfaRegister          = 0x0d
+	dwCfaDefCfaOffset            = 0x0e
+	dwCfaDefCfaExpression        = 0x0f
+	dwCfaExpression              = 0x10
+	dwCfaOffsetExtendedSf        = 0x11
+	dwCfaDefCfaSf                = 0x12
+	dwCfaDefCfaOffsetSf          = 0x13
+	dwCfaValOffset               = 0x14
+	dwCfaValOffsetSf             = 0x15
+	dwCfaValExpression           = 0x16
+	dwCfaGNUWindowSave           = 0x2d // also AArch64 negate_ra_state
+	dwCfaGNUArgsSize             = 0x2e
+	dwCfaGNUNegativeOffsetExtend = 0x2f
+	dwCfaAdvanceLoc              = 0x40 // high 2 bits; delta in low 6
+	dwCfaOffset                  = 0x80 // high 2 bits; register in low 6
+	dwCfaRestore                 = 0xc0 // high 2 bits; register in low 6
+)
+
+// cfiSection is a section holding call frame information.
+type cfiSection struct {
+	name string
+	data []byte
+	addr uint64 // load address, for pc-relative pointer encodings
+	eh   bool   // .eh_frame format (as opposed to .debug_frame)
+}
+
+// cfiCIE is a Common Information Entry.
+type cfiCIE struct {
+	off          int64
+	version      uint8
+	augmentation string
+	addrSize     int
+	codeAlign    uint64
+	dataAlign    int64
+	raReg        uint64
+	fdeEnc       uint8
+	lsdaEnc      uint8
+	signalFrame  bool
+	initial      []byte
+}
+
+// cfiFDE is a Frame Description Entry.
+type cfiFDE struct {
+	off    int64
+	cie    *cfiCIE
+	lowpc  uint64
+	highpc uint64
+	insns  []byte
+}
+
+// cfiTable holds the decoded contents of a cfiSection.
+type cfiTable struct {
+	sect *cfiSection
+	cies map[int64]*cfiCIE
+	fdes []*cfiFDE
+}
+
+// cfaInsn is a decoded call frame instruction. Offsets and advances
+// have already been scaled by the CIE's alignment factors.
+type cfaInsn struct {
+	op   uint8 // opcode, with the operand bits of compact forms cleared
+	reg  uint64
+	reg2 uint64 // second register, for DW_CFA_register
+	off  int64  // offset, or byte delta for advance instructions
+	loc  uint64 // new location, for DW_CFA_set_loc
+	expr []byte
+}
+
+// addrSize returns the size of a target address in bytes.
+func (of *objFile) addrSize() int {
+	switch {
+	case of.ef != nil:
+		if of.ef.Class == elf.ELFCLASS32 {
+			return 4
+		}
+	case of.mf != nil:
+		if of.mf.Magic == macho.Magic32 {
+			return 4
+		}
+	case of.pf != nil:
+		if _, ok := of.pf.OptionalHeader.(*pe.OptionalHeader32); ok {
+			return 4
+		}
+	}
+	return 8
+}
+
+// readEncoded reads a pointer with DW_EH_PE encoding 'enc'. The
+// section's address supplies the base for pc-relative values, and
+// 'datarel' the base for data-relative ones.
+func readEncoded(b *llbuf, enc uint8, sect *cfiSection, addrSize int, datarel uint64) (uint64, error) {
+	if enc == dwEhPeOmit {
+		return 0, nil
+	}
+	pos := sect.addr + uint64(b.off)
+	var v uint64
+	switch enc & 0x0f {
+	case dwEhPeAbsptr:
+		v = b.addr(addrSize)
+	case dwEhPeUleb128:
+		v = b.uleb()
+	case dwEhPeUdata2:
+		v = b.u16()
+	case dwEhPeUdata4:
+		v = b.u32()
+	case dwEhPeUdata8:
+		v = b.u64()
+	case dwEhPeSleb128:
+		v = uint64(b.sleb())
+	case dwEhPeSdata2:
+		v = uint64(int16(b.u16()))
+	case dwEhPeSdata4:
+		v = uint64(int32(b.u32()))
+	case dwEhPeSdata8:
+		v = b.u64()
+	default:
+		return 0, fmt.Errorf("unsupported pointer encoding 0x%x", enc)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	switch enc & 0x70 {
+	case 0:
+	case dwEhPePcrel:
+		v += pos
+	case dwEhPeDatarel:
+		v += datarel
+	default:
+		return 0, fmt.Errorf("unsupported pointer encoding 0x%x", enc)
+	}
+	if enc&dwEhPeIndirect != 0 {
+		return 0, fmt.Errorf("indirect pointer encoding 0x%x not supported", enc)
+	}
+	if addrSize == 4 {
+		v &= 0xffffffff
+	}
+	return v, nil
+}
+
+// parseCIE decodes the CIE whose contents (following the CIE id)
+// span [b.off, end).
+func parseCIE(b *llbuf, off, end int64, sect *cfiSection, addrSize int) (*cfiCIE, error) {
+	c := &cfiCIE{off: off, addrSize: addrSize}
+	c.version = uint8(b.u8())
+	switch c.version {
+	case 1, 3, 4:
+	default:
+		return nil, fmt.Errorf("CIE at 0x%x: unsupported version %d", off, c.version)
+	}
+	c.augmentation = b.cstring()
+	if strings.HasPrefix(c.augmentation, "eh") {
+		b.addr(addrSize) // old GNU eh_ptr
+	}
+	if c.version == 4 {
+		c.addrSize = int(b.u8())
+		if seg := b.u8(); seg != 0 {
+			return nil, fmt.Errorf("CIE at 0x%x: segment selectors not supported", off)
+		}
+	}
+	c.codeAlign = b.uleb()
+	c.dataAlign = b.sleb()
+	if c.version == 1 {
+		c.raReg = b.u8()
+	} else {
+		c.raReg = b.uleb()
+	}
+	if strings.HasPrefix(c.augmentation, "z") {
+		alen := int64(b.uleb())
+		aend := b.off + alen
+	augLoop:
+		for _, ch := range c.augmentation[1:] {
+			switch ch {
+			case 'R':
+				c.fdeEnc = uint8(b.u8())
+			case 'L':
+				c.lsdaEnc = uint8(b.u8())
+			case 'P':
+				penc := uint8(b.u8())
+				// The personality routine may be indirect; we don't
+				// need its value, so just step over it.
+				if _, err := readEncoded(b, penc&^dwEhPeIndirect, sect, addrSize, 0); err != nil {
+					return nil, fmt.Errorf("CIE at 0x%x: %v", off, err)
+				}
+			case 'S':
+				c.signalFrame = true
+			case 'B', 'G':
+			default:
+				break augLoop
+			}
+		}
+		b.off = aend
+	} else if c.augmentation != "" && c.augmentation != "eh" {
+		return nil, fmt.Errorf("CIE at 0x%x: unknown augmentation %q", off, c.augmentation)
+	}
+	if b.err != nil {
+		return nil, fmt.Errorf("CIE at 0x%x: %v", off, b.err)
+	}
+	if b.off > end {
+		return nil, fmt.Errorf("CIE at 0x%x: contents overrun entry", off)
+	}
+	c.initial = b.data[b.off:end]
+	return c, nil
+}
+
+// parseCFI decodes all of the CIEs and FDEs in 'sect'. Problems
+// with individual entries are returned as a list of errors; the
+// table holds whatever could be decoded.
+func parseCFI(sect *cfiSection, order binary.ByteOrder, addrSize int) (*cfiTable, []error) {
+	tab := &cfiTable{sect: sect, cies: make(map[int64]*cfiCIE)}
+	var errs []error
+	type entry struct {
+		off, body, end int64
+		id             uint64
+		is64           bool
+	}
+	var fdes []entry
+	b := &llbuf{data: sect.data, order: order, what: sect.name}
+	for b.off < int64(len(sect.data)) {
+		e := entry{off: b.off}
+		length := b.u32()
+		if length == 0xffffffff {
+			length = b.u64()
+			e.is64 = true
+		}
+		if b.err != nil {
+			errs = append(errs, b.err)
+			break
+		}
+		if length == 0 {
+			if sect.eh {
+				break // terminator
+			}
+			continue
+		}
+		e.end = b.off + int64(length)
+		if e.end > int64(len(sect.data)) || e.end < b.off {
+			errs = append(errs, fmt.Errorf("entry at 0x%x: length 0x%x overruns section", e.off, length))
+			break
+		}
+		if e.is64 {
+			e.id = b.u64()
+		} else {
+			e.id = b.u32()
+		}
+		e.body = b.off
+		isCIE := e.id == 0
+		if !sect.eh {
+			isCIE = e.id == 0xffffffff || (e.is64 && e.id == ^uint64(0))
+		}
+		if isCIE {
+			c, err := parseCIE(b, e.off, e.end, sect, addrSize)
+			if err != nil {
+				errs = append(errs, err)
+			} else {
+				tab.cies[e.off] = c
+			}
+		} else {
+			fdes = append(fdes, e)
+		}
+		b.off = e.end
+		b.err = nil
+	}
+
+	for _, e := range fdes {
+		cieOff := int64(e.id)
+		if sect.eh {
+			// The CIE pointer is relative to the pointer field itself.
+			idSize := int64(4)
+			if e.is64 {
+				idSize = 8
+			}
+			cieOff = e.body - idSize - int64(e.id)
+		}
+		c := tab.cies[cieOff]
+		if c == nil {
+			errs = append(errs, fmt.Errorf("FDE at 0x%x: no CIE at 0x%x", e.off, cieOff))
+			continue
+		}
+		fb := &llbuf{data: sect.data[:e.end], off: e.body, order: order, what: sect.name}
+		f := &cfiFDE{off: e.off, cie: c}
+		enc := c.fdeEnc
+		if !sect.eh {
+			enc = dwEhPeAbsptr
+		}
+		var err error
+		if f.lowpc, err = readEncoded(fb, enc, sect, c.addrSize, 0); err == nil {
+			var size uint64
+			size, err = readEncoded(fb, enc&0x0f, sect, c.addrSize, 0)
+			f.highpc = f.lowpc + size
+		}
+		if err == nil && strings.HasPrefix(c.augmentation, "z") {
+			fb.bytes(int64(fb.uleb()))
+			err = fb.err
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("FDE at 0x%x: %v", e.off, err))
+			continue
+		}
+		f.insns = sect.data[fb.off:e.end]
+		tab.fdes = append(tab.fdes, f)
+	}
+	return tab, errs
+}
+
+// decodeCFA decodes the call frame instructions 'insns' belonging
+// to CIE 'c' (either its initial instructions or those of one of
+// its FDEs).
+func decodeCFA(insns []byte, c *cfiCIE, sect *cfiSection, order binary.ByteOrder) ([]cfaInsn, error) {
+	var rv []cfaInsn
+	b := &llbuf{data: insns, order: order, what: "CFA instructions"}
+	fact := func(v int64) int64 { return v * c.dataAlign }
+	for b.off < int64(len(insns)) && b.err == nil {
+		at := b.off
+		op := uint8(b.u8())
+		in := cfaInsn{op: op}
+		switch op & 0xc0 {
+		case dwCfaAdvanceLoc:
+			in.op = dwCfaAdvanceLoc
+			in.off = int64(uint64(op&0x3f) * c.codeAlign)
+		case dwCfaOffset:
+			in.op = dwCfaOffset
+			in.reg = uint64(op & 0x3f)
+			in.off = fact(int64(b.uleb()))
+		case dwCfaRestore:
+			in.op = dwCfaRestore
+			in.reg = uint64(op & 0x3f)
+		default:
+			switch op {
+			case dwCfaNop, dwCfaRememberState, dwCfaRestoreState, dwCfaGNUWindowSave:
+			case dwCfaSetLoc:
+				enc := c.fdeEnc
+				if !sect.eh {
+					enc = dwEhPeAbsptr
+				}
+				// pc-relative set_loc operands are vanishingly rare;
+				// treat the operand as relative to the section start.
+				loc, err := readEncoded(b, enc&^0x70, sect, c.addrSize, 0)
+				if err != nil {
+					return rv, fmt.Errorf("at 0x%x: %v", at, err)
+				}
+				in.loc = loc
+			case dwCfaAdvanceLoc1:
+				in.off = int64(b.u8() * c.codeAlign)
+			case dwCfaAdvanceLoc2:
+				in.off = int64(b.u16() * c.codeAlign)
+			case dwCfaAdvanceLoc4:
+				in.off = int64(b.u32() * c.codeAlign)
+			case dwCfaOffsetExtended, dwCfaValOffset:
+				in.reg = b.uleb()
+				in.off = fact(int64(b.uleb()))
+			case dwCfaOffsetExtendedSf, dwCfaValOffsetSf:
+				in.reg = b.uleb()
+				in.off = fact(b.sleb())
+			case dwCfaGNUNegativeOffsetExtend:
+				in.reg = b.uleb()
+				in.off = -fact(int64(b.uleb()))
+			case dwCfaRestoreExtended, dwCfaUndefined, dwCfaSameValue, dwCfaDefCfaRegister:
+				in.reg = b.uleb()
+			case dwCfaRegister:
+				in.reg = b.uleb()
+				in.reg2 = b.uleb()
+			case dwCfaDefCfa:
+				in.reg = b.uleb()
+				in.off = int64(b.uleb())
+			case dwCfaDefCfaSf:
+				in.reg = b.uleb()
+				in.off = fact(b.sleb())
+			case dwCfaDefCfaOffset, dwCfaGNUArgsSize:
+				in.off = int64(b.uleb())
+			case dwCfaDefCfaOffsetSf:
+				in.off = fact(b.sleb())
+			case dwCfaDefCfaExpression:
+				in.expr = b.bytes(int64(b.uleb()))
+			case dwCfaExpression, dwCfaValExpression:
+				in.reg = b.uleb()
+				in.expr = b.bytes(int64(b.uleb()))
+			default:
+				return rv, fmt.Errorf("at 0x%x: unknown opcode 0x%x", at, op)
+			}
+		}
+		if b.err != nil {
+			break
+		}
+		rv = append(rv, in)
+	}
+	return rv, b.err
+}
+
+// cfiSections returns the call frame information sections present
+// in the object file.
+func cfiSections(of *objFile) ([]*cfiSection, error) {
+	var rv []*cfiSection
+	switch {
+	case of.ef != nil:
+		if s := of.loadedELF().Section(".eh_frame"); s != nil && s.Type != elf.SHT_NOBITS {
+			data, err := s.Data()
+			if err != nil {
+				return nil, err
+			}
+			rv = append(rv, &cfiSection{name: s.Name, data: data, addr: s.Addr, eh: true})
+		}
+	case of.mf != nil:
+		if s := of.mf.Section("__eh_frame"); s != nil {
+			data, err := s.Data()
+			if err != nil {
+				return nil, err
+			}
+			rv = append(rv, &cfiSection{name: s.Name, data: data, addr: s.Addr, eh: true})
+		}
+	}
+	data, err := of.sectionData(".debug_frame")
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		rv = append(rv, &cfiSection{name: ".debug_frame", data: data})
+	}
+	return rv, nil
+}
+
+// isDiscardedFDE reports whether an FDE describes code that the
+// linker threw away, which leaves its initial location zero or set
+// to a tombstone value.
+func isDiscardedFDE(f *cfiFDE, addrSize int) bool {
+	tomb := ^uint64(0)
+	if addrSize == 4 {
+		tomb = 0xffffffff
+	}
+	return f.lowpc == 0 || f.lowpc >= tomb-1
+}
+
+// checkFDERanges checks that the live FDEs of a table don't overlap.
+// FDE order within a section isn't mandated (only the .eh_frame_hdr
+// search table must be sorted, which checkEhFrameHdr checks), so out
+// of order entries are merely noted.
+func checkFDERanges(tab *cfiTable, addrSize int) ([]*cfiFDE, bool) {
+	var live []*cfiFDE
+	unsorted := 0
+	for _, f := range tab.fdes {
+		if isDiscardedFDE(f, addrSize) {
+			continue
+		}
+		if n := len(live); n > 0 && f.lowpc < live[n-1].lowpc {
+			unsorted++
+		}
+		live = append(live, f)
+	}
+	if unsorted != 0 {
+		verb(1, "%s: %d FDEs out of address order", tab.sect.name, unsorted)
+	}
+	sorted := append([]*cfiFDE(nil), live...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].lowpc < sorted[j].lowpc })
+	ok := true
+	for i := 1; i < len(sorted); i++ {
+		p, f := sorted[i-1], sorted[i]
+		if f.lowpc < p.highpc {
+			if reportf("cfi", tab.sect.name, "FDE overlap", site{pc: f.lowpc},
+				"%s: FDE at 0x%x [0x%x,0x%x) overlaps FDE at 0x%x [0x%x,0x%x)",
+				tab.sect.name, f.off, f.lowpc, f.highpc, p.off, p.lowpc, p.highpc) {
+				ok = false
+			}
+		}
+	}
+	return live, ok
+}
+
+// checkEhFrameHdr validates the .eh_frame_hdr binary search table
+// against the FDEs found in .eh_frame.
+func checkEhFrameHdr(hdr *cfiSection, eh *cfiTable, order binary.ByteOrder, addrSize int) bool {
+	b := &llbuf{data: hdr.data, order: order, what: hdr.name}
+	if v := b.u8(); v != 1 {
+		return !reportf("cfi", hdr.name, "version", site{}, "%s: unsupported version %d", hdr.name, v)
+	}
+	ptrEnc, countEnc, tableEnc := uint8(b.u8()), uint8(b.u8()), uint8(b.u8())
+	ehPtr, err := readEncoded(b, ptrEnc, hdr, addrSize, hdr.addr)
+	if err != nil {
+		return !reportf("cfi", hdr.name, "decode", site{}, "%s: %v", hdr.name, err)
+	}
+	ok := true
+	if ehPtr != eh.sect.addr {
+		if reportf("cfi", hdr.name, "eh_frame_ptr", site{}, "%s: eh_frame_ptr 0x%x does not match %s address 0x%x",
+			hdr.name, ehPtr, eh.sect.name, eh.sect.addr) {
+			ok = false
+		}
+	}
+	if countEnc == dwEhPeOmit || tableEnc == dwEhPeOmit {
+		verb(1, "%s: no search table", hdr.name)
+		return ok
+	}
+	count, err := readEncoded(b, countEnc, hdr, addrSize, hdr.addr)
+	if err != nil {
+		return !reportf("cfi", hdr.name, "decode", site{}, "%s: %v", hdr.name, err)
+	}
+	nlive := 0
+	for _, f := range eh.fdes {
+		if !isDiscardedFDE(f, addrSize) {
+			nlive++
+		}
+	}
+	if count != uint64(nlive) {
+		if reportf("cfi", hdr.name, "table size", site{}, "%s: search table has %d entries, but %s has %d live FDEs",
+			hdr.name, count, eh.sect.name, nlive) {
+			ok = false
+		}
+	}
+	byAddr := make(map[uint64]*cfiFDE)
+	for _, f := range eh.fdes {
+		byAddr[eh.sect.addr+uint64(f.off)] = f
+	}
+	var prev uint64
+	for i := uint64(0); i < count; i++ {
+		loc, err := readEncoded(b, tableEnc, hdr, addrSize, hdr.addr)
+		if err != nil {
+			return !reportf("cfi", hdr.name, "decode", site{}, "%s: entry %d: %v", hdr.name, i, err)
+		}
+		fdeAddr, err := readEncoded(b, tableEnc, hdr, addrSize, hdr.addr)
+		if err != nil {
+			return !reportf("cfi", hdr.name, "decode", site{}, "%s: entry %d: %v", hdr.name, i, err)
+		}
+		if i > 0 && loc <= prev {
+			if reportf("cfi", hdr.name, "table order", site{pc: loc}, "%s: entry %d: initial location 0x%x not above previous 0x%x",
+				hdr.name, i, loc, prev) {
+				ok = false
+			}
+		}
+		prev = loc
+		f := byAddr[fdeAddr]
+		switch {
+		case f == nil:
+			if reportf("cfi", hdr.name, "table entry", site{pc: loc}, "%s: entry %d: 0x%x is not the address of an FDE", hdr.name, i, fdeAddr) {
+				ok = false
+			}
+		case f.lowpc != loc:
+			if reportf("cfi", hdr.name, "table entry", site{pc: loc}, "%s: entry %d: initial location 0x%x, but FDE at 0x%x starts at 0x%x",
+				hdr.name, i, loc, fdeAddr, f.lowpc) {
+				ok = false
+			}
+		}
+	}
+	return ok
+}
+
+// checkCFICoverage checks that the PC range of every DWARF
+// subprogram is covered by some FDE.
+func checkCFICoverage(d *dwarf.Data, fdes []*cfiFDE) (bool, error) {
+	type span struct{ lo, hi uint64 }
+	var spans []span
+	for _, f := range fdes {
+		spans = append(spans, span{f.lowpc, f.highpc})
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].lo < spans[j].lo })
+	var merged []span
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s.lo <= merged[n-1].hi {
+			if s.hi > merged[n-1].hi {
+				merged[n-1].hi = s.hi
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+	covered := func(lo, hi uint64) bool {
+		i := sort.Search(len(merged), func(i int) bool { return merged[i].hi > lo })
+		return i < len(merged) && merged[i].lo <= lo && hi <= merged[i].hi
+	}
+
+	ok := true
+	nsub := 0
+	rdr := d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return false, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag != dwarf.TagSubprogram {
+			continue
+		}
+		ranges, err := d.Ranges(ent)
+		if err != nil {
+			return false, err
+		}
+		for _, r := range ranges {
+			if r[0] == 0 || r[1] <= r[0] {
+				continue
+			}
+			nsub++
+			if !covered(r[0], r[1]) {
+				name, _ := ent.Val(dwarf.AttrName).(string)
+				if reportf("cfi", name, "FDE coverage", site{fn: name, dies: []dwarf.Offset{ent.Offset}}, "subprogram %s at DIE 0x%x: range [0x%x,0x%x) not covered by any FDE",
+					name, ent.Offset, r[0], r[1]) {
+					ok = false
+				}
+			}
+		}
+	}
+	verb(1, "checked FDE coverage of %d subprogram ranges", nsub)
+	return ok, nil
+}
+
+// checkCFI parses the object file's call frame information and checks
+// it for problems: undecodable entries or instructions, overlapping
+// FDEs, subprograms with no FDE, and a .eh_frame_hdr search table
+// that disagrees with .eh_frame. Returns false if problems were found.
+func checkCFI(of *objFile, d *dwarf.Data) (bool, error) {
+	sects, err := cfiSections(of)
+	if err != nil {
+		return false, err
+	}
+	if len(sects) == 0 {
+		verb(1, "no call frame information found")
+		return true, nil
+	}
+	order := of.byteOrder()
+	addrSize := of.addrSize()
+	// Addresses in relocatable objects are section-relative, so only
+	// the encoding can be checked.
+	isRel := of.ef != nil && of.ef.Type == elf.ET_REL
+
+	ok := true
+	var live []*cfiFDE
+	var ehTab *cfiTable
+	for _, sect := range sects {
+		tab, errs := parseCFI(sect, order, addrSize)
+		for _, err := range errs {
+			if reportf("cfi", sect.name, "decode", site{}, "%s: %v", sect.name, err) {
+				ok = false
+			}
+		}
+		verb(1, "%s: %d CIEs, %d FDEs", sect.name, len(tab.cies), len(tab.fdes))
+		for _, c := range tab.cies {
+			if _, err := decodeCFA(c.initial, c, sect, order); err != nil {
+				if reportf("cfi", sect.name, "CIE instructions", site{}, "%s: CIE at 0x%x: bad initial instructions: %v", sect.name, c.off, err) {
+					ok = false
+				}
+			}
+		}
+		for _, f := range tab.fdes {
+			if _, err := decodeCFA(f.insns, f.cie, sect, order); err != nil {
+				if reportf("cfi", sect.name, "FDE instructions", site{pc: f.lowpc}, "%s: FDE at 0x%x: bad instructions: %v", sect.name, f.off, err) {
+					ok = false
+				}
+			}
+		}
+		if isRel {
+			continue
+		}
+		fl, rok := checkFDERanges(tab, addrSize)
+		ok = ok && rok
+		live = append(live, fl...)
+		if sect.eh {
+			ehTab = tab
+		}
+	}
+	if isRel {
+		return ok, nil
+	}
+
+	if of.ef != nil {
+		if s := of.loadedELF().Section(".eh_frame_hdr"); s != nil && ehTab != nil {
+			data, err := s.Data()
+			if err != nil {
+				return false, err
+			}
+			hdr := &cfiSection{name: s.Name, data: data, addr: s.Addr, eh: true}
+			if !checkEhFrameHdr(hdr, ehTab, order, addrSize) {
+				ok = false
+			}
+		}
+	}
+
+	cok, err := checkCFICoverage(d, live)
+	if err != nil {
+		return false, err
+	}
+	return ok && cok, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeCFA(t *testing.T) {
+	cie := &cfiCIE{addrSize: 8, codeAlign: 1, dataAlign: -8}
+	sect := &cfiSection{name: ".debug_frame"}
+	insns := []byte{
+		dwCfaDefCfa, 7, 8, // def_cfa r7+8
+		dwCfaOffset | 16, 1, // r16 at cfa-8
+		dwCfaAdvanceLoc | 4,
+		dwCfaDefCfaOffset, 16,
+		dwCfaAdvanceLoc1, 0x80,
+		dwCfaDefCfaOffsetSf, 0x7e, // -2 * -8 = 16
+		dwCfaDefCfaExpression, 2, 0x77, 0x08,
+		dwCfaNop,
+	}
+	got, err := decodeCFA(insns, cie, sect, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("decodeCFA: %v", err)
+	}
+	want := []cfaInsn{
+		{op: dwCfaDefCfa, reg: 7, off: 8},
+		{op: dwCfaOffset, reg: 16, off: -8},
+		{op: dwCfaAdvanceLoc, off: 4},
+		{op: dwCfaDefCfaOffset, off: 16},
+		{op: dwCfaAdvanceLoc1, off: 0x80},
+		{op: dwCfaDefCfaOffsetSf, off: 16},
+		{op: dwCfaDefCfaExpression, expr: []byte{0x77, 0x08}},
+		{op: dwCfaNop},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("decoded %d instructions, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.op != w.op || g.reg != w.reg || g.off != w.off || !bytes.Equal(g.expr, w.expr) {
+			t.Errorf("insn %d: got %+v, want %+v", i, g, w)
+		}
+	}
+
+	for _, bad := range [][]byte{
+		{0x3f},                  // unassigned opcode
+		{dwCfaDefCfa, 7},        // truncated operand
+		{dwCfaExpression, 1, 5}, // block overruns
+	} {
+		if _, err := decodeCFA(bad, cie, sect, binary.LittleEndian); err == nil {
+			t.Errorf("decodeCFA(% x) succeeded", bad)
+		}
+	}
+}
+
+// debugFrame assembles a 64-bit-address .debug_frame section with a
+// single CIE followed by an FDE for each of 'ranges'.
+func debugFrame(ranges [][2]uint64) []byte {
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	cie := []byte{0xff, 0xff, 0xff, 0xff, 3, 0, 1, 0x78, 16, dwCfaDefCfa, 7, 8}
+	binary.Write(&buf, le, uint32(len(cie)))
+	buf.Write(cie)
+	for _, r := range ranges {
+		binary.Write(&buf, le, uint32(4+16+1))
+		binary.Write(&buf, le, uint32(0))
+		binary.Write(&buf, le, r[0])
+		binary.Write(&buf, le, r[1]-r[0])
+		buf.WriteByte(dwCfaNop)
+	}
+	return buf.Bytes()
+}
+
+func TestFDERanges(t *testing.T) {
+	for _, tc := range []struct {
+		ranges [][2]uint64
+		ok     bool
+	}{
+		{[][2]uint64{{0x1000, 0x1010}, {0x1010, 0x1020}}, true},
+		{[][2]uint64{{0x1010, 0x1020}, {0x1000, 0x1010}}, true},
+		{[][2]uint64{{0x1000, 0x1018}, {0x1010, 0x1020}}, false},
+		// FDEs for discarded functions are ignored.
+		{[][2]uint64{{0x1000, 0x1010}, {0, 0x20}, {0x1010, 0x1020}}, true},
+	} {
+		sect := &cfiSection{name: ".debug_frame", data: debugFrame(tc.ranges)}
+		tab, errs := parseCFI(sect, binary.LittleEndian, 8)
+		if len(errs) != 0 || len(tab.fdes) != len(tc.ranges) {
+			t.Fatalf("parseCFI: %d FDEs, errors %v", len(tab.fdes), errs)
+		}
+		if _, ok := checkFDERanges(tab, 8); ok != tc.ok {
+			t.Errorf("checkFDERanges(%x) = %v, want %v", tc.ranges, ok, tc.ok)
+		}
+	}
+}
+
+func TestEhFrameHdrCount(t *testing.T) {
+	// An .eh_frame with a live FDE and one for discarded code, which
+	// the linker leaves out of the search table.
+	eh := &cfiTable{
+		sect: &cfiSection{name: ".eh_frame", addr: 0x2000, eh: true},
+		fdes: []*cfiFDE{{off: 0x18, lowpc: 0x1000, highpc: 0x1010}, {off: 0x38, lowpc: 0, highpc: 0x10}},
+	}
+	le := binary.LittleEndian
+	var buf bytes.Buffer
+	buf.Write([]byte{1, dwEhPeUdata4, dwEhPeUdata4, dwEhPeUdata4})
+	for _, v := range []uint32{0x2000, 1, 0x1000, 0x2018} {
+		binary.Write(&buf, le, v)
+	}
+	hdr := &cfiSection{name: ".eh_frame_hdr", data: buf.Bytes(), addr: 0x1f00, eh: true}
+	if !checkEhFrameHdr(hdr, eh, le, 8) {
+		t.Errorf("checkEhFrameHdr counted a discarded FDE")
+	}
+}
+
+func TestCheckCFI(t *testing.T) {
+	exe := buildSelf(t, t.TempDir(), noExtra)
+	of, d := loadObj(t, exe)
+	if ok, err := checkCFI(of, d); err != nil || !ok {
+		t.Errorf("checkCFI(Go binary) = %v, %v", ok, err)
+	}
+
+	cxx, err := exec.LookPath("g++")
+	if err != nil {
+		t.Skip("no g++ available")
+	}
+	cexe := filepath.Join(t.TempDir(), "cfi.exe")
+	cmd := exec.Command(cxx, "-g", "-O2", "-o", cexe, filepath.Join("testdata", "typeunits.cc"))
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Logf("build: %s\n", b)
+		t.Fatalf("build error: %v", err)
+	}
+	of, d = loadObj(t, cexe)
+	if ok, err := checkCFI(of, d); err != nil || !ok {
+		t.Errorf("checkCFI(C++ binary) = %v, %v", ok, err)
+	}
+	if of.ef == nil || of.ef.Section(".eh_frame_hdr") == nil {
+		t.Skip("no .eh_frame_hdr to check")
+	}
+
+	// Damage the first initial location in the .eh_frame_hdr table.
+	sects, err := cfiSections(of)
+	if err != nil || len(sects) == 0 || !sects[0].eh {
+		t.Fatalf("cfiSections: %v", err)
+	}
+	eh, _ := parseCFI(sects[0], of.byteOrder(), of.addrSize())
+	s := of.ef.Section(".eh_frame_hdr")
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := &cfiSection{name: s.Name, data: data, addr: s.Addr, eh: true}
+	if !checkEhFrameHdr(hdr, eh, of.byteOrder(), of.addrSize()) {
+		t.Fatalf("checkEhFrameHdr failed on intact table")
+	}
+	if data[3] != 0x3b { // datarel|sdata4
+		t.Skipf("unexpected table encoding 0x%x", data[3])
+	}
+	bad := append([]byte(nil), data...)
+	bad[12]++
+	hdr.data = bad
+	if checkEhFrameHdr(hdr, eh, of.byteOrder(), of.addrSize()) {
+		t.Errorf("checkEhFrameHdr missed a corrupted table entry")
+	}
+}
@@ -8,8 +8,6 @@ import (
 	"debug/elf"
 	"debug/macho"
 	"debug/pe"
-	"encoding/binary"
-	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -54,6 +52,7 @@ const (
 	noDumpSize     dumpSizeMode = 0
 	yesDumpSize    dumpSizeMode = 1
 	detailDumpSize dumpSizeMode = 2
+	attribDumpSize dumpSizeMode = 3
 )
 
 type options struct {
@@ -62,70 +61,18 @@ type options struct {
 	rl readLineMode
 	sz dumpSizeMode
 	dc doAbsChecksMode
-}
-
-func readAligned4(r io.Reader, sz int32) ([]byte, error) {
-	full := (sz + 3) &^ 3
-	data := make([]byte, full)
-	_, err := io.ReadFull(r, data)
-	if err != nil {
-		return nil, err
-	}
-	data = data[:sz]
-	return data, nil
-}
-
-func dumpBuildIdsInNoteSection(ef *elf.File, sect *elf.Section) error {
-	const wantNameSize = 4 // GNU\0
-	var wantNoteName = [...]byte{'G', 'N', 'U', 0}
-	const wantNoteType = 3 // NT_GNU_BUILD_ID
-	r := sect.Open()
-	for {
-		var namesize, descsize, noteType int32
-		if err := binary.Read(r, ef.ByteOrder, &namesize); err != nil {
-			if err == io.EOF {
-				return nil
-			}
-			return err
-		}
-		if namesize != wantNameSize {
-			continue
-		}
-		if err := binary.Read(r, ef.ByteOrder, &descsize); err != nil {
-			return err
-		}
-		if err := binary.Read(r, ef.ByteOrder, &noteType); err != nil {
-			return err
-		}
-		if noteType != wantNoteType {
-			continue
-		}
-		noteName, err := readAligned4(r, namesize)
-		if err != nil {
-			continue
-		}
-		if wantNoteName[0] != noteName[0] ||
-			wantNoteName[1] != noteName[1] ||
-			wantNoteName[2] != noteName[2] ||
-			wantNoteName[3] != noteName[3] {
-			continue
-		}
-		desc, err := readAligned4(r, descsize)
-		if err != nil {
-			return err
-		}
-		descStr := hex.EncodeToString(desc)
-		fmt.Fprintf(os.Stderr, "found build id '%s' in section `%s` notename `%s`\n", descStr, sect.Name, string(noteName))
-	}
-}
-
-func dumpBuildId(ef *elf.File) {
-	for _, sect := range ef.Sections {
-		if sect.Type != elf.SHT_NOTE {
-			continue
-		}
-		dumpBuildIdsInNoteSection(ef, sect)
-	}
+	lo layoutMode
+	il inlinesMode
+	ls locStatsMode
+	oc odrCheckMode
+	cf cfiCheckMode
+	uw unwindCheckMode
+	ar arangesCheckMode
+	nm namesCheckMode
+	sy symsCheckMode
+	pc pclnCheckMode
+	gt goTypesCheckMode
+	cs cuSizesMode
 }
 
 // isDebugSect returns TRUE if this section contains DWARF/debug info.
@@ -137,13 +84,21 @@ func isDwarfSect(secName string) bool {
 		strings.HasPrefix(secName, ".eh_frame")
 }
 
-func dumpSizes(ef *elf.File, mode dumpSizeMode) {
+func dumpSizes(ef *elf.File, r io.ReaderAt, mode dumpSizeMode) {
 	totDw := uint64(0)
+	totDwU := uint64(0)
 	totExe := uint64(0)
+	comp := make(map[*elf.Section]*sectCompression)
 	for _, sect := range ef.Sections {
 		totExe += sect.FileSize
 		if isDwarfSect(sect.Name) {
 			totDw += sect.FileSize
+			if sc := elfCompression(ef, r, sect, false); sc != nil {
+				comp[sect] = sc
+				totDwU += sc.usize
+			} else {
+				totDwU += sect.FileSize
+			}
 		}
 	}
 	perc := func(v, tot uint64) string {
@@ -154,13 +109,20 @@ func dumpSizes(ef *elf.File, mode dumpSizeMode) {
 		ft := float64(tot)
 		return fmt.Sprintf("%2.2f%%", (fv/ft)*100.0)
 	}
-	if mode == detailDumpSize {
+	if mode >= detailDumpSize {
 		for _, sect := range ef.Sections {
 			if isDwarfSect(sect.Name) {
-				fmt.Printf("section %15s: %10d bytes, %s of DWARF, %s of exe\n",
+				fmt.Printf("section %15s: %10d bytes, %s of DWARF, %s of exe",
 					sect.Name, sect.FileSize,
 					perc(sect.FileSize, totDw),
 					perc(sect.FileSize, totExe))
+				if sc := comp[sect]; sc != nil && sc.err != nil {
+					fmt.Printf(", bad compression header: %v", sc.err)
+				} else if sc != nil {
+					fmt.Printf(", %s compressed from %d bytes (%.2fx)",
+						sc.kind, sc.usize, sc.ratio())
+				}
+				fmt.Printf("\n")
 			} else { // if sect.Name == ".text" {
 				fmt.Printf("section %15s: %10d bytes, %s of exe\n",
 					sect.Name, sect.FileSize,
@@ -168,8 +130,11 @@ func dumpSizes(ef *elf.File, mode dumpSizeMode) {
 			}
 		}
 	}
-	if mode == detailDumpSize {
+	if mode >= detailDumpSize {
 		fmt.Printf("DWARF size total: %d bytes, %s of exe\n", totDw, perc(totDw, totExe))
+		if len(comp) != 0 {
+			fmt.Printf("DWARF uncompressed size total: %d bytes\n", totDwU)
+		}
 		fmt.Printf("Exe size total: %d bytes\n", totExe)
 	} else {
 		fmt.Printf("DWARF size total: %d bytes\n", totDw)
@@ -178,63 +143,243 @@ func dumpSizes(ef *elf.File, mode dumpSizeMode) {
 
 func examineFile(filename string, o options) bool {
 
-	var d *dwarf.Data
-	var derr error
+	if fi, err := os.Stat(filename); err == nil && fi.IsDir() {
+		dwfile, err := dsymDWARFFile(filename)
+		if err != nil {
+			warn("%v", err)
+			setExit(exitNotObject)
+			return false
+		}
+		verb(1, "using %s from bundle %s", dwfile, filename)
+		if *dsymexeflag != "" && !compareDsymUUIDs(*dsymexeflag, dwfile) {
+			return false
+		}
+		filename = dwfile
+	}
 
-	tries := []struct {
-		opener func(exe string) (*dwarf.Data, error)
-		flav   string
-	}{
-		{flav: "ELF",
-			opener: func(exe string) (*dwarf.Data, error) {
-				f, err := elf.Open(exe)
-				if err != nil {
-					return nil, err
-				}
-				rv, err := f.DWARF()
-				if o.sz != noDumpSize {
-					dumpSizes(f, o.sz)
-				}
-				if o.db == yesDumpBuildId {
-					dumpBuildId(f)
+	f, err := os.Open(filename)
+	if err != nil {
+		warn("%v", err)
+		setExit(exitNotObject)
+		return false
+	}
+	defer f.Close()
+	if isArchive(f) {
+		fi, err := f.Stat()
+		if err != nil {
+			warn("%v", err)
+			return false
+		}
+		return examineArchive(filename, f, fi.Size(), o)
+	}
+	return examineObject(filename, f, o)
+}
+
+// examineObject loads the DWARF from the object file 'r' (named
+// 'filename' in diagnostics) and checks it. The object file format
+// is determined from its magic number, and the exit status records
+// why the file could not be examined, if it couldn't.
+func examineObject(filename string, r io.ReaderAt, o options) bool {
+	format := sniffFormat(r)
+	if format == fatFormat {
+		if ok, isFat := examineFat(filename, r, o); isFat {
+			return ok
+		}
+		format = unknownFormat
+	}
+	of, d := openObject(filename, r, format, o)
+	if of == nil {
+		return false
+	}
+	defer of.close()
+	return examineDwarf(filename, of, d, o)
+}
+
+// openObject opens 'r', an object file of format 'format', and loads
+// its DWARF. If that fails, it reports why, records the exit status
+// and returns nil. Otherwise the caller must close the objFile, which
+// may be a separate debug file rather than 'r'.
+func openObject(filename string, r io.ReaderAt, format objFormat, o options) (*objFile, *dwarf.Data) {
+	openers := map[objFormat]func(r io.ReaderAt) (*objFile, error){
+		elfFormat: func(r io.ReaderAt) (*objFile, error) {
+			f, err := elf.NewFile(r)
+			if err != nil {
+				if probs := rawCompressionProblems(r); len(probs) != 0 {
+					for _, p := range probs {
+						reportf("compress", p.name, "bad compression", site{}, "section %s: bad compressed section: %v", p.name, p.err)
+					}
+					return nil, errBadCompression
 				}
-				return rv, err
-			},
-		},
-		{
-			flav: "Macho",
-			opener: func(exe string) (*dwarf.Data, error) {
-				f, err := macho.Open(exe)
+				return nil, err
+			}
+			if o.sz != noDumpSize {
+				dumpSizes(f, r, o.sz)
+			}
+			if o.db == yesDumpBuildId {
+				dumpBuildId(f)
+			}
+			if f.Type != elf.ET_REL && !elfHasDebugInfo(f) {
+				df, dfile, err := openSeparateDebugFile(filename, f)
 				if err != nil {
-					return nil, err
+					warn("unable to load separate debug file for %s: %v", filename, err)
+				} else if df != nil {
+					return &objFile{ef: df, r: dfile, df: dfile, exe: f}, nil
 				}
-				return f.DWARF()
-			},
+			}
+			return &objFile{ef: f, r: r}, nil
 		},
-		{
-			flav: "PE",
-			opener: func(exe string) (*dwarf.Data, error) {
-				f, err := pe.Open(exe)
-				if err != nil {
-					return nil, err
-				}
-				return f.DWARF()
-			},
+		machoFormat: func(r io.ReaderAt) (*objFile, error) {
+			f, err := macho.NewFile(r)
+			if err != nil {
+				return nil, err
+			}
+			if o.db == yesDumpBuildId {
+				dumpMachoBuildId(f)
+			}
+			return &objFile{mf: f, r: r}, nil
+		},
+		peFormat: func(r io.ReaderAt) (*objFile, error) {
+			f, err := pe.NewFile(r)
+			if err != nil {
+				return nil, err
+			}
+			if o.db == yesDumpBuildId {
+				dumpPEBuildId(f)
+			}
+			return &objFile{pf: f, r: r}, nil
 		},
 	}
 
-	for _, try := range tries {
-		verb(1, "loading %s for %s", try.flav, filename)
-		d, derr = try.opener(filename)
-		if derr != nil {
-			warn("unable to open %s as %s: %v",
-				filename, try.flav, derr)
-			continue
-		}
-		break
+	opener := openers[format]
+	if opener == nil {
+		warn("%s: not an object file", filename)
+		setExit(exitNotObject)
+		return nil, nil
+	}
+	verb(1, "loading %s for %s", format, filename)
+	of, err := opener(r)
+	if err == errBadCompression {
+		warn("%s: unable to load DWARF: %v", filename, err)
+		setExit(exitParseError)
+		return nil, nil
 	}
+	if err != nil {
+		warn("unable to open %s as %s: %v", filename, format, err)
+		setExit(exitNotObject)
+		return nil, nil
+	}
+	d := loadDWARF(filename, of)
 	if d == nil {
-		return false
+		return nil, nil
+	}
+	return of, d
+}
+
+// loadDWARF loads the DWARF of 'of', opened from 'filename'. If that
+// fails, it reports why, records the exit status, closes 'of' and
+// returns nil.
+func loadDWARF(filename string, of *objFile) *dwarf.Data {
+	names := of.dwarfSectionNames()
+	if len(names) == 0 {
+		warn("%s: no DWARF debugging information", filename)
+		setExit(exitNoDWARF)
+		of.close()
+		return nil
+	}
+	if !of.hasSection(".debug_info") {
+		warn("%s: DWARF present (%s) but stripped of .debug_info", filename,
+			strings.Join(names, ", "))
+		setExit(exitNoDebugInfo)
+		of.close()
+		return nil
+	}
+	d, err := of.dwarf()
+	if err != nil {
+		if of.ef != nil {
+			checkCompressedSections(of.ef, of.r)
+		}
+		warnParseError(filename, err)
+		of.close()
+		return nil
+	}
+	return d
+}
+
+// warnParseError reports 'err', an error decoding the DWARF of
+// 'filename', and records the parse error exit status.
+func warnParseError(filename string, err error) {
+	if de, ok := err.(dwarf.DecodeError); ok {
+		warn("%s: DWARF parse error in %s at offset 0x%x: %s",
+			filename, de.Name, de.Offset, de.Err)
+	} else {
+		warn("%s: unable to load DWARF: %v", filename, err)
+	}
+	setExit(exitParseError)
+}
+
+// enclosingFuncName returns the name of the subprogram containing
+// DIE 'idx' of 'ds', or "" if it is not within one.
+func enclosingFuncName(ds *dwexaminer.DwExaminer, d *dwarf.Data, offs []dwarf.Offset, idx int, cache map[dwarf.Offset]string) string {
+	for p, ok := ds.ParentID(idx); ok; p, ok = ds.ParentID(p) {
+		ent, err := ds.LoadEntryByID(p)
+		if err != nil {
+			break
+		}
+		if ent.Tag == dwarf.TagSubprogram {
+			return originName(d, offs[p], cache)
+		}
+	}
+	return ""
+}
+
+// examineDwarf runs the requested checks and reports on the DWARF
+// 'd' read from 'of'.
+func examineDwarf(filename string, of *objFile, d *dwarf.Data, o options) bool {
+
+	// Let the config file's rules find the CUs of findings.
+	findingCUs = nil
+	if config != nil && config.needCUs {
+		cus, err := collectConfigCUs(d)
+		if err != nil {
+			warn("error reading CUs for config file rules: %v", err)
+			return false
+		}
+		findingCUs = cus
+	}
+
+	if o.sz == attribDumpSize {
+		if err := dumpInfoAttribution(of, d, *showsizetopflag); err != nil {
+			warn("error attributing .debug_info size: %v", err)
+			return false
+		}
+	}
+
+	if o.cs != noCUSizes {
+		if err := dumpCUSizes(of, d, o.cs, *cusizesortflag); err != nil {
+			warn("error computing per-CU sizes: %v", err)
+			return false
+		}
+	}
+
+	if o.lo != noLayout {
+		if err := dumpLayouts(d, *layoutmaxflag); err != nil {
+			warn("error computing struct layouts: %v", err)
+			return false
+		}
+	}
+
+	if o.il != noInlines {
+		if err := dumpInlines(d, *inlinesmaxflag); err != nil {
+			warn("error collecting inlined subroutines: %v", err)
+			return false
+		}
+	}
+
+	if o.ls != noLocStats {
+		if err := dumpLocStats(of, d, o.ls, *locstatsmaxflag); err != nil {
+			warn("error computing location statistics: %v", err)
+			return false
+		}
 	}
 
 	// Initialize state
@@ -245,15 +390,22 @@ func examineFile(filename string, o options) bool {
 		var err error
 		ds, err = dwexaminer.NewDwExaminer(rdr)
 		if err != nil {
-			warn("error initializing dwarf state examiner: %v", err)
+			warnParseError(filename, err)
+			return false
+		}
+		ntu, err := indexTypeUnits(of, ds)
+		if err != nil {
+			warn("error indexing type units: %v", err)
 			return false
 		}
+		verb(1, "indexed %d type units", ntu)
 	}
 
 	dcount := 0
 	absocount := 0
 
 	typeNames := make(map[string]struct{})
+	sigRefs := make(map[uint64][]dwarf.Offset)
 
 	isTypeTag := func(t dwarf.Tag) bool {
 		switch t {
@@ -266,12 +418,13 @@ func examineFile(filename string, o options) bool {
 	if o.dc != noDoAbsChecks || o.dt != noDumpTypes {
 		// Walk DIEs
 		dieOffsets := ds.DieOffsets()
+		originNames := make(map[dwarf.Offset]string)
 		for idx, off := range dieOffsets {
 			verb(3, "examining DIE at offset 0x%x", off)
 			die, err := ds.LoadEntryByOffset(off)
 			dcount++
 			if err != nil {
-				warn("error examining DWARF: %v", err)
+				warnParseError(filename, fmt.Errorf("DIE at offset 0x%x: %v", off, err))
 				return false
 			}
 
@@ -283,6 +436,13 @@ func examineFile(filename string, o options) bool {
 				}
 			}
 
+			// Collect type signature references, checked below.
+			for _, f := range die.Field {
+				if sig, ok := f.Val.(uint64); ok && f.Class == dwarf.ClassReferenceSig {
+					sigRefs[sig] = append(sigRefs[sig], off)
+				}
+			}
+
 			// Does it have an abstract origin?
 			ooff, originOK := die.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
 			if !originOK {
@@ -294,7 +454,11 @@ func examineFile(filename string, o options) bool {
 			var entry *dwarf.Entry
 			entry, err = ds.LoadEntryByOffset(ooff)
 			if err != nil || entry == nil {
-				warn("unresolved abstract origin ref from DIE %d at offset 0x%x to bad offset 0x%x\n", idx, off, ooff)
+				fn := enclosingFuncName(ds, d, dieOffsets, idx, originNames)
+				if !reportf("absorigin", fn, die.Tag.String(), site{fn: fn, dies: []dwarf.Offset{off}},
+					"unresolved abstract origin ref from DIE %d at offset 0x%x to bad offset 0x%x\n", idx, off, ooff) {
+					continue
+				}
 				err := ds.DumpEntry(idx, false, true, 0)
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -304,6 +468,96 @@ func examineFile(filename string, o options) bool {
 		}
 		verb(1, "read %d DIEs, processed %d abstract origin refs",
 			dcount, absocount)
+		if !checkSignatures(ds, sigRefs) {
+			return false
+		}
+	}
+
+	if o.oc != noOdrCheck {
+		ok, err := checkODR(d)
+		if err != nil {
+			warn("error during ODR check: %v", err)
+			return false
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if o.cf != noCFICheck {
+		ok, err := checkCFI(of, d)
+		if err != nil {
+			warn("error checking call frame information: %v", err)
+			return false
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if o.uw != noUnwindCheck {
+		ok, err := checkUnwind(of, d)
+		if err != nil {
+			warn("error checking unwind tables: %v", err)
+			return false
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if o.ar != noArangesCheck {
+		ok, err := checkAranges(of, d)
+		if err != nil {
+			warn("error checking .debug_aranges: %v", err)
+			return false
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if o.nm != noNamesCheck {
+		ok, err := checkNames(of, d)
+		if err != nil {
+			warn("error checking name indexes: %v", err)
+			return false
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if o.sy != noSymsCheck {
+		ok, err := checkSyms(of, d)
+		if err != nil {
+			warn("error checking symbols: %v", err)
+			return false
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if o.pc != noPclnCheck {
+		ok, err := checkPcln(of, d)
+		if err != nil {
+			warn("error checking pclntab: %v", err)
+			return false
+		}
+		if !ok {
+			return false
+		}
+	}
+	if o.gt != noGoTypesCheck {
+		ok, err := checkGoTypes(of, d)
+		if err != nil {
+			warn("error checking Go types: %v", err)
+			return false
+		}
+		if !ok {
+			return false
+		}
 	}
 
 	if o.dt != noDumpTypes {
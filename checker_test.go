@@ -1,6 +1,10 @@
 package main
 
 import (
+	"debug/dwarf"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -26,6 +30,48 @@ func buildSelf(t *testing.T, tdir string, extra string) string {
 	return exe
 }
 
+func buildFixture(t *testing.T, tdir string, infile string, extra string) string {
+	// Do a build of testdata/<infile> into <tmpdir>/fixture.exe
+	exe := filepath.Join(tdir, "fixture.exe")
+	gotoolpath := filepath.Join(runtime.GOROOT(), "bin", "go")
+	cmd := exec.Command(gotoolpath, "build", extra, "-o", exe,
+		filepath.Join("testdata", infile))
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Logf("build: %s\n", b)
+		t.Fatalf("build error: %v", err)
+	}
+	return exe
+}
+
+// loadObj opens 'exe' using whichever object file flavor applies
+// and returns it along with its DWARF.
+func loadObj(t *testing.T, exe string) (*objFile, *dwarf.Data) {
+	var of *objFile
+	var d *dwarf.Data
+	var err error
+	if f, ferr := elf.Open(exe); ferr == nil {
+		of = &objFile{ef: f}
+		d, err = f.DWARF()
+	} else if f, ferr := macho.Open(exe); ferr == nil {
+		of = &objFile{mf: f}
+		d, err = f.DWARF()
+	} else if f, ferr := pe.Open(exe); ferr == nil {
+		of = &objFile{pf: f}
+		d, err = f.DWARF()
+	} else {
+		t.Fatalf("unable to open %s: %v", exe, ferr)
+	}
+	if err != nil {
+		t.Fatalf("reading DWARF from %s: %v", exe, err)
+	}
+	return of, d
+}
+
+func loadDwarf(t *testing.T, exe string) *dwarf.Data {
+	_, d := loadObj(t, exe)
+	return d
+}
+
 func TestBasic(t *testing.T) {
 	*verbflag = 1
 
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ELF section compression types. ELFCOMPRESS_ZSTD is defined here
+// since older versions of debug/elf lack it.
+const (
+	elfCompressZlib = 1
+	elfCompressZstd = 2
+)
+
+// sectCompression describes a compressed ELF section, either a
+// SHF_COMPRESSED one or an old-style GNU ".zdebug" one.
+type sectCompression struct {
+	kind  string // "zlib", "zstd" or "zlib-gnu"
+	csize uint64 // bytes on disk
+	usize uint64 // bytes once decompressed, per the header
+	err   error  // problem with the header or compressed data
+}
+
+func (sc *sectCompression) ratio() float64 {
+	if sc.csize == 0 {
+		return 0
+	}
+	return float64(sc.usize) / float64(sc.csize)
+}
+
+// elfCompression returns compression details for section 's' of
+// 'ef', reading the raw section contents from 'r', or nil if the
+// section is not compressed. Header problems are recorded in the
+// result's err field; if 'validate' is set, the contents are also
+// decompressed to check them.
+func elfCompression(ef *elf.File, r io.ReaderAt, s *elf.Section, validate bool) *sectCompression {
+	zdebug := strings.HasPrefix(s.Name, ".zdebug_")
+	if s.Flags&elf.SHF_COMPRESSED == 0 && !zdebug {
+		return nil
+	}
+	if s.Type == elf.SHT_NOBITS {
+		return nil
+	}
+	sc := &sectCompression{csize: s.FileSize}
+	raw := io.NewSectionReader(r, int64(s.Offset), int64(s.FileSize))
+
+	if s.Flags&elf.SHF_COMPRESSED == 0 {
+		sc.kind = "zlib-gnu"
+		var hdr [12]byte
+		if _, err := raw.ReadAt(hdr[:], 0); err != nil || string(hdr[:4]) != "ZLIB" {
+			sc.err = fmt.Errorf("missing or truncated ZLIB header")
+			return sc
+		}
+		sc.usize = binary.BigEndian.Uint64(hdr[4:])
+		if !validate {
+			return sc
+		}
+		b, err := s.Data()
+		if err == nil {
+			_, err = decompressZdebug(b)
+		}
+		sc.err = err
+		return sc
+	}
+
+	var ctype uint32
+	var hdrErr error
+	switch ef.Class {
+	case elf.ELFCLASS32:
+		var ch elf.Chdr32
+		hdrErr = binary.Read(raw, ef.ByteOrder, &ch)
+		ctype, sc.usize = ch.Type, uint64(ch.Size)
+	default:
+		var ch elf.Chdr64
+		hdrErr = binary.Read(raw, ef.ByteOrder, &ch)
+		ctype, sc.usize = ch.Type, ch.Size
+	}
+	if hdrErr != nil {
+		sc.err = fmt.Errorf("truncated compression header: %v", hdrErr)
+		return sc
+	}
+	switch ctype {
+	case elfCompressZlib:
+		sc.kind = "zlib"
+	case elfCompressZstd:
+		sc.kind = "zstd"
+	default:
+		sc.kind = fmt.Sprintf("type %d", ctype)
+		sc.err = fmt.Errorf("unknown compression type %d", ctype)
+		return sc
+	}
+	if !validate {
+		return sc
+	}
+	b, err := s.Data()
+	switch {
+	case err != nil:
+		sc.err = fmt.Errorf("corrupt %s data: %v", sc.kind, err)
+	case uint64(len(b)) != sc.usize:
+		sc.err = fmt.Errorf("decompressed to %d bytes, header says %d", len(b), sc.usize)
+	}
+	return sc
+}
+
+// checkCompressedSections reports any DWARF sections of 'ef' with a
+// corrupt compression header or undecodable compressed contents, so
+// that a failure to load the DWARF can be explained. Returns false
+// if any were reported.
+func checkCompressedSections(ef *elf.File, r io.ReaderAt) bool {
+	ok := true
+	for _, s := range ef.Sections {
+		if !isDwarfSect(s.Name) {
+			continue
+		}
+		if sc := elfCompression(ef, r, s, true); sc != nil && sc.err != nil {
+			if reportf("compress", s.Name, "bad compression", site{}, "section %s: bad compressed section: %v", s.Name, sc.err) {
+				ok = false
+			}
+		}
+	}
+	return ok
+}
+
+// errBadCompression is returned when an ELF file can't be opened
+// because of the compression headers reported by
+// rawCompressionProblems.
+var errBadCompression = errors.New("corrupt compressed debug sections")
+
+// rawCompressionProblem is a SHF_COMPRESSED section whose compression
+// header is unusable, found by rawCompressionProblems.
+type rawCompressionProblem struct {
+	name string
+	err  error
+}
+
+// rawCompressionProblems checks the compression headers of the
+// SHF_COMPRESSED sections of the ELF file 'r', reading the section
+// headers directly. debug/elf reads the compression headers while
+// opening the file, and fails without naming the section if one is
+// truncated; this explains such failures.
+func rawCompressionProblems(r io.ReaderAt) []rawCompressionProblem {
+	var ident [elf.EI_NIDENT]byte
+	if _, err := r.ReadAt(ident[:], 0); err != nil || string(ident[:4]) != elf.ELFMAG {
+		return nil
+	}
+	var order binary.ByteOrder
+	switch elf.Data(ident[elf.EI_DATA]) {
+	case elf.ELFDATA2LSB:
+		order = binary.LittleEndian
+	case elf.ELFDATA2MSB:
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+	type shdr struct {
+		name, typ     uint32
+		flags, offset uint64
+		size          uint64
+	}
+	var shoff int64
+	var shentsize, shnum, shstrndx int
+	var chdrSize uint64
+	readShdr := func(i int) (shdr, bool) {
+		var sh shdr
+		sr := io.NewSectionReader(r, shoff+int64(i*shentsize), int64(shentsize))
+		switch elf.Class(ident[elf.EI_CLASS]) {
+		case elf.ELFCLASS32:
+			var s elf.Section32
+			if binary.Read(sr, order, &s) != nil {
+				return sh, false
+			}
+			sh = shdr{s.Name, s.Type, uint64(s.Flags), uint64(s.Off), uint64(s.Size)}
+		default:
+			var s elf.Section64
+			if binary.Read(sr, order, &s) != nil {
+				return sh, false
+			}
+			sh = shdr{s.Name, s.Type, s.Flags, s.Off, s.Size}
+		}
+		return sh, true
+	}
+	switch elf.Class(ident[elf.EI_CLASS]) {
+	case elf.ELFCLASS32:
+		var h elf.Header32
+		if binary.Read(io.NewSectionReader(r, 0, int64(binary.Size(h))), order, &h) != nil {
+			return nil
+		}
+		shoff, shentsize, shnum, shstrndx = int64(h.Shoff), int(h.Shentsize), int(h.Shnum), int(h.Shstrndx)
+		chdrSize = uint64(binary.Size(elf.Chdr32{}))
+	case elf.ELFCLASS64:
+		var h elf.Header64
+		if binary.Read(io.NewSectionReader(r, 0, int64(binary.Size(h))), order, &h) != nil {
+			return nil
+		}
+		shoff, shentsize, shnum, shstrndx = int64(h.Shoff), int(h.Shentsize), int(h.Shnum), int(h.Shstrndx)
+		chdrSize = uint64(binary.Size(elf.Chdr64{}))
+	default:
+		return nil
+	}
+	if shoff <= 0 || shentsize == 0 {
+		return nil
+	}
+	var shstrtab []byte
+	if sh, ok := readShdr(shstrndx); ok && shstrndx != 0 && sh.flags&uint64(elf.SHF_COMPRESSED) == 0 && sh.size < 1<<24 {
+		shstrtab = make([]byte, sh.size)
+		if _, err := r.ReadAt(shstrtab, int64(sh.offset)); err != nil {
+			shstrtab = nil
+		}
+	}
+	var rv []rawCompressionProblem
+	for i := 1; i < shnum; i++ {
+		sh, ok := readShdr(i)
+		if !ok {
+			break
+		}
+		if sh.flags&uint64(elf.SHF_COMPRESSED) == 0 || elf.SectionType(sh.typ) == elf.SHT_NOBITS {
+			continue
+		}
+		name := fmt.Sprintf("#%d", i)
+		if int(sh.name) < len(shstrtab) {
+			n := shstrtab[sh.name:]
+			if j := bytes.IndexByte(n, 0); j >= 0 {
+				name = string(n[:j])
+			}
+		}
+		chdr := make([]byte, chdrSize)
+		switch _, err := r.ReadAt(chdr, int64(sh.offset)); {
+		case sh.size < chdrSize:
+			rv = append(rv, rawCompressionProblem{name, fmt.Errorf("truncated compression header: section is %d bytes", sh.size)})
+		case err != nil:
+			rv = append(rv, rawCompressionProblem{name, fmt.Errorf("compression header at offset 0x%x is past the end of the file", sh.offset)})
+		default:
+			if ctype := order.Uint32(chdr); ctype != elfCompressZlib && ctype != elfCompressZstd {
+				rv = append(rv, rawCompressionProblem{name, fmt.Errorf("unknown compression type %d", ctype)})
+			}
+		}
+	}
+	return rv
+}
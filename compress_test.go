@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressedSections(t *testing.T) {
+	dir := t.TempDir()
+	exe := buildSelf(t, dir, noExtra)
+	f, err := os.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ef, err := elf.NewFile(f)
+	if err != nil {
+		t.Skip("test requires ELF binaries")
+	}
+	s := ef.Section(".debug_info")
+	if s == nil || s.Flags&elf.SHF_COMPRESSED == 0 {
+		t.Skip("linker did not compress .debug_info")
+	}
+	sc := elfCompression(ef, f, s, true)
+	if sc == nil || sc.err != nil {
+		t.Fatalf("elfCompression(.debug_info) = %+v", sc)
+	}
+	if sc.kind != "zlib" || sc.csize != s.FileSize || sc.usize != s.Size {
+		t.Errorf("bad compression info %+v for section %+v", sc, s.SectionHeader)
+	}
+	if !checkCompressedSections(ef, f) {
+		t.Errorf("checkCompressedSections failed on intact binary")
+	}
+
+	content, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chdrSize := 24
+	if ef.Class == elf.ELFCLASS32 {
+		chdrSize = 12
+	}
+	corrupt := func(name string, mutate func(b []byte)) string {
+		b := append([]byte(nil), content...)
+		mutate(b[s.Offset : s.Offset+s.FileSize])
+		out := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(out, b, 0755); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	baddata := corrupt("baddata.exe", func(b []byte) {
+		for i := chdrSize; i < chdrSize+16; i++ {
+			b[i] = 0xff
+		}
+	})
+	badtype := corrupt("badtype.exe", func(b []byte) {
+		ef.ByteOrder.PutUint32(b, 99)
+	})
+	for _, bad := range []string{baddata, badtype} {
+		bf, err := os.Open(bad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bef, err := elf.NewFile(bf)
+		if err != nil {
+			t.Fatalf("%s: %v", bad, err)
+		}
+		if sc := elfCompression(bef, bf, bef.Section(".debug_info"), true); sc == nil || sc.err == nil {
+			t.Errorf("%s: corruption not detected: %+v", bad, sc)
+		}
+		bf.Close()
+		if examineFile(bad, options{dc: yesDoAbsChecks}) {
+			t.Errorf("%s: examineFile succeeded", bad)
+		}
+	}
+
+	// The config file can suppress the findings like any others.
+	cfg := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(cfg, []byte(`{"suppress": [{"checks": ["compress"]}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(c *checkConfig) { config = c }(config)
+	config = c
+	bf, err := os.Open(baddata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bf.Close()
+	bef, err := elf.NewFile(bf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkCompressedSections(bef, bf) {
+		t.Errorf("%s: suppressed compression findings reported", baddata)
+	}
+	config = nil
+
+	// A section too small for its compression header stops debug/elf
+	// from opening the file at all.
+	if ef.Class != elf.ELFCLASS64 {
+		return
+	}
+	idx := -1
+	for i, sect := range ef.Sections {
+		if sect == s {
+			idx = i
+		}
+	}
+	b := append([]byte(nil), content...)
+	shoff := ef.ByteOrder.Uint64(b[0x28:])
+	ef.ByteOrder.PutUint64(b[shoff+uint64(idx)*64+32:], 8)
+	if _, err := elf.NewFile(bytes.NewReader(b)); err == nil {
+		t.Fatalf("debug/elf opened a file with a truncated compression header")
+	}
+	probs := rawCompressionProblems(bytes.NewReader(b))
+	if len(probs) != 1 || probs[0].name != ".debug_info" {
+		t.Errorf("rawCompressionProblems = %v, want a problem in .debug_info", probs)
+	}
+	short := filepath.Join(dir, "short.exe")
+	if err := ioutil.WriteFile(short, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(e int) { st = e }(st)
+	st = exitOK
+	if examineFile(short, options{dc: yesDoAbsChecks}) || st != exitParseError {
+		t.Errorf("%s: examineFile succeeded, or exit status %d", short, st)
+	}
+}
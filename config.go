@@ -0,0 +1,241 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultConfigFile is read, if present, when -config isn't given.
+const defaultConfigFile = ".dwarfcheck.json"
+
+// checkIDs are the IDs of the checks whose findings can be
+// suppressed, as used in baselines and the config file.
+var checkIDs = []string{
+	"absorigin", "aranges", "cfi", "compress", "gotypes", "names",
+	"odr", "pcln", "reloc", "syms", "typesig", "unwind",
+}
+
+// suppressRule is a "suppress" entry of the config file. A finding is
+// suppressed by the rule if it is from one of 'Checks' (or any check,
+// if there are none) and it matches every pattern given.
+type suppressRule struct {
+	Checks   []string `json:"checks,omitempty"`
+	CU       string   `json:"cu,omitempty"`       // glob on the CU's DW_AT_name
+	Function string   `json:"function,omitempty"` // regexp on the function name
+	Producer string   `json:"producer,omitempty"` // regexp on the CU's DW_AT_producer
+
+	checks   map[string]bool
+	function *regexp.Regexp
+	producer *regexp.Regexp
+}
+
+// checkConfig is the contents of a config file.
+type checkConfig struct {
+	Suppress []*suppressRule `json:"suppress"`
+
+	needCUs bool // some rule refers to the CU
+}
+
+// config is the configuration in effect, or nil if there is none.
+var config *checkConfig
+
+// loadConfig reads and validates the config file 'file'.
+func loadConfig(file string) (*checkConfig, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var c checkConfig
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	for i, r := range c.Suppress {
+		if r == nil {
+			return nil, fmt.Errorf("%s: suppress rule %d is null", file, i)
+		}
+		r.checks = make(map[string]bool)
+		for _, id := range r.Checks {
+			j := sort.SearchStrings(checkIDs, id)
+			if j == len(checkIDs) || checkIDs[j] != id {
+				return nil, fmt.Errorf("%s: suppress rule %d: unknown check %q (want one of %s)",
+					file, i, id, strings.Join(checkIDs, ", "))
+			}
+			r.checks[id] = true
+		}
+		if r.CU != "" {
+			if _, err := path.Match(r.CU, ""); err != nil {
+				return nil, fmt.Errorf("%s: suppress rule %d: bad cu pattern %q: %v", file, i, r.CU, err)
+			}
+			c.needCUs = true
+		}
+		if r.Function != "" {
+			if r.function, err = regexp.Compile(r.Function); err != nil {
+				return nil, fmt.Errorf("%s: suppress rule %d: bad function pattern: %v", file, i, err)
+			}
+		}
+		if r.Producer != "" {
+			if r.producer, err = regexp.Compile(r.Producer); err != nil {
+				return nil, fmt.Errorf("%s: suppress rule %d: bad producer pattern: %v", file, i, err)
+			}
+			c.needCUs = true
+		}
+	}
+	return &c, nil
+}
+
+// configCU is a compilation unit that findings can be attributed to.
+type configCU struct {
+	off      dwarf.Offset
+	name     string
+	producer string
+}
+
+// configCUs locates the CUs of the object file being examined, by
+// DIE offset and by PC.
+type configCUs struct {
+	cus    []*configCU // in offset order
+	ranges []configRange
+}
+
+type configRange struct {
+	lo, hi uint64
+	cu     *configCU
+}
+
+// findingCUs are the CUs of the object file being examined, if the
+// config refers to CUs.
+var findingCUs *configCUs
+
+// collectConfigCUs reads the name, producer and PC ranges of each CU
+// in 'd'.
+func collectConfigCUs(d *dwarf.Data) (*configCUs, error) {
+	cc := &configCUs{}
+	rdr := d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag != dwarf.TagCompileUnit && ent.Tag != dwarf.TagPartialUnit {
+			rdr.SkipChildren()
+			continue
+		}
+		cu := &configCU{off: ent.Offset}
+		cu.name, _ = ent.Val(dwarf.AttrName).(string)
+		cu.producer, _ = ent.Val(dwarf.AttrProducer).(string)
+		cc.cus = append(cc.cus, cu)
+		ranges, err := d.Ranges(ent)
+		if err != nil {
+			return nil, fmt.Errorf("CU at 0x%x: %v", ent.Offset, err)
+		}
+		for _, r := range ranges {
+			if r[1] > r[0] {
+				cc.ranges = append(cc.ranges, configRange{r[0], r[1], cu})
+			}
+		}
+		rdr.SkipChildren()
+	}
+	sort.Slice(cc.ranges, func(i, j int) bool { return cc.ranges[i].lo < cc.ranges[j].lo })
+	return cc, nil
+}
+
+// byOffset returns the CU containing the DIE at 'off', or nil.
+func (cc *configCUs) byOffset(off dwarf.Offset) *configCU {
+	i := sort.Search(len(cc.cus), func(i int) bool { return cc.cus[i].off > off })
+	if i == 0 {
+		return nil
+	}
+	return cc.cus[i-1]
+}
+
+// byPC returns the CU whose code includes 'pc', or nil.
+func (cc *configCUs) byPC(pc uint64) *configCU {
+	i := sort.Search(len(cc.ranges), func(i int) bool { return cc.ranges[i].hi > pc })
+	if i < len(cc.ranges) && cc.ranges[i].lo <= pc {
+		return cc.ranges[i].cu
+	}
+	return nil
+}
+
+// findingCUsOf returns the CUs that finding 'f' is attributed to.
+func findingCUsOf(f *finding) []*configCU {
+	if findingCUs == nil {
+		return nil
+	}
+	var rv []*configCU
+	for _, off := range f.at.dies {
+		if cu := findingCUs.byOffset(off); cu != nil {
+			rv = append(rv, cu)
+		}
+	}
+	if f.at.pc != 0 {
+		if cu := findingCUs.byPC(f.at.pc); cu != nil {
+			rv = append(rv, cu)
+		}
+	}
+	return rv
+}
+
+// matches reports whether rule 'r' suppresses finding 'f', attributed
+// to the CUs 'cus'.
+func (r *suppressRule) matches(f *finding, cus []*configCU) bool {
+	if len(r.checks) != 0 && !r.checks[f.check] {
+		return false
+	}
+	if r.function != nil && (f.at.fn == "" || !r.function.MatchString(f.at.fn)) {
+		return false
+	}
+	if r.CU == "" && r.producer == nil {
+		return true
+	}
+	for _, cu := range cus {
+		if r.CU != "" && !matchCUName(r.CU, cu.name) {
+			continue
+		}
+		if r.producer != nil && !r.producer.MatchString(cu.producer) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// matchCUName reports whether the glob 'pattern' matches the CU name
+// 'name' or one of its leading directories, so that "vendor/*" covers
+// "vendor/a/b.c" as well as "vendor/a.c".
+func matchCUName(pattern, name string) bool {
+	for {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		i := strings.LastIndex(name, "/")
+		if i <= 0 {
+			return false
+		}
+		name = name[:i]
+	}
+}
+
+// isSuppressed reports whether some rule of the config suppresses
+// finding 'f'.
+func (c *checkConfig) isSuppressed(f *finding) bool {
+	var cus []*configCU
+	if c.needCUs {
+		cus = findingCUsOf(f)
+	}
+	for _, r := range c.Suppress {
+		if r.matches(f, cus) {
+			return true
+		}
+	}
+	return false
+}
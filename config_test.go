@@ -0,0 +1,126 @@
+package main
+
+import (
+	"debug/dwarf"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchCUName(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"runtime", "runtime", true},
+		{"runtime", "runtime/internal/sys", true},
+		{"runtime", "internal/runtime", false},
+		{"vendor/*", "vendor/a.c", true},
+		{"vendor/*", "vendor/a/b.c", true},
+		{"*.c", "x.c", true},
+		{"*.c", "lib/x.c", false},
+		{"/usr/src/*", "/usr/src/glibc/csu/init.c", true},
+	} {
+		if got := matchCUName(tc.pattern, tc.name); got != tc.want {
+			t.Errorf("matchCUName(%q, %q) = %v, want %v", tc.pattern, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	defer func(c *checkConfig, cus *configCUs) { config, findingCUs = c, cus }(config, findingCUs)
+	dir := t.TempDir()
+	load := func(s string) (*checkConfig, error) {
+		file := filepath.Join(dir, "config.json")
+		if err := ioutil.WriteFile(file, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return loadConfig(file)
+	}
+	for _, s := range []string{
+		`{"suppress": [{"checks": ["nosuch"]}]}`,
+		`{"suppress": [{"cu": "["}]}`,
+		`{"suppress": [{"function": "("}]}`,
+		`{"suppress": [null]}`,
+		`{"suppress": `,
+	} {
+		if _, err := load(s); err == nil {
+			t.Errorf("loading %s succeeded", s)
+		}
+	}
+
+	c, err := load(`{"suppress": [
+		{"checks": ["cfi", "unwind"], "function": "^asm\\."},
+		{"checks": ["odr"], "cu": "third_party/*"},
+		{"producer": "^GNU C 4\\."}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config = c
+	app := &configCU{off: 0x10, name: "app/main.c", producer: "GNU C17 12.2.0"}
+	lib := &configCU{off: 0x100, name: "third_party/z/inflate.c", producer: "GNU C17 12.2.0"}
+	old := &configCU{off: 0x200, name: "old/legacy.c", producer: "GNU C 4.8.5"}
+	findingCUs = &configCUs{
+		cus:    []*configCU{app, lib, old},
+		ranges: []configRange{{0x1000, 0x2000, app}, {0x2000, 0x3000, lib}, {0x3000, 0x4000, old}},
+	}
+	for _, tc := range []struct {
+		f    finding
+		want bool
+	}{
+		{finding{check: "unwind", at: site{fn: "asm.memcpy", pc: 0x1100}}, true},
+		{finding{check: "syms", at: site{fn: "asm.memcpy", pc: 0x1100}}, false},
+		{finding{check: "unwind", at: site{fn: "main", pc: 0x1100}}, false},
+		{finding{check: "odr", at: site{dies: []dwarf.Offset{0x20, 0x180}}}, true},
+		{finding{check: "odr", at: site{dies: []dwarf.Offset{0x20, 0x30}}}, false},
+		{finding{check: "gotypes", at: site{dies: []dwarf.Offset{0x180}}}, false},
+		{finding{check: "aranges", at: site{dies: []dwarf.Offset{0x200}}}, true},
+		{finding{check: "pcln", at: site{pc: 0x3800}}, true},
+		{finding{check: "pcln", at: site{pc: 0x5000}}, false},
+		{finding{check: "cfi", at: site{}}, false},
+	} {
+		if got := suppressed(&tc.f); got != tc.want {
+			t.Errorf("suppressed(%s at %+v) = %v, want %v", tc.f.check, tc.f.at, got, tc.want)
+		}
+	}
+
+	// A baselined finding the config suppresses is still seen by the
+	// baseline, and so isn't taken to be fixed.
+	defer func(b *findingBaseline) { baseline = b }(baseline)
+	f := finding{check: "unwind", name: "asm.memcpy", attr: "CFA", at: site{fn: "asm.memcpy"}}
+	baseline = &findingBaseline{
+		known: map[string]baselineEntry{f.fingerprint(): {Check: f.check, Name: f.name, Attr: f.attr}},
+		seen:  make(map[string]baselineEntry),
+	}
+	if !suppressed(&f) {
+		t.Errorf("suppressed(%s) = false, want true", f.name)
+	}
+	if _, ok := baseline.seen[f.fingerprint()]; !ok {
+		t.Errorf("finding suppressed by the config not seen by the baseline")
+	}
+}
+
+func TestConfigCUs(t *testing.T) {
+	_, d := loadObj(t, buildSelf(t, t.TempDir(), noExtra))
+	cc, err := collectConfigCUs(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cc.cus) == 0 || len(cc.ranges) == 0 {
+		t.Fatalf("found %d CUs, %d ranges", len(cc.cus), len(cc.ranges))
+	}
+	for _, cu := range cc.cus {
+		if got := cc.byOffset(cu.off + 1); got != cu {
+			t.Errorf("byOffset(0x%x) = %v, want CU %q", cu.off+1, got, cu.name)
+		}
+	}
+	r := cc.ranges[0]
+	if got := cc.byPC(r.lo); got != r.cu {
+		t.Errorf("byPC(0x%x) = %v, want CU %q", r.lo, got, r.cu.name)
+	}
+	if !strings.HasPrefix(r.cu.producer, "Go cmd/compile") {
+		t.Errorf("CU %q has producer %q", r.cu.name, r.cu.producer)
+	}
+}
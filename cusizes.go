@@ -0,0 +1,228 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+type cuSizesMode int
+
+const (
+	noCUSizes   cuSizesMode = 0
+	textCUSizes cuSizesMode = 1
+	csvCUSizes  cuSizesMode = 2
+	jsonCUSizes cuSizesMode = 3
+)
+
+// unattributedCU is the pseudo-CU name used for section bytes (such
+// as list headers) not referenced by any particular CU.
+const unattributedCU = "<unattributed>"
+
+// cuSizes holds the bytes contributed to each debug section by all
+// CUs with a given name (for Go, a package path).
+type cuSizes struct {
+	Name  string `json:"name"`
+	CUs   int    `json:"cus"`
+	Info  int64  `json:"debug_info"`
+	Line  int64  `json:"debug_line"`
+	Loc   int64  `json:"debug_loc"`
+	Total int64  `json:"total"`
+}
+
+// lineProgramSize returns the size in bytes of the line number
+// program starting at offset 'off' in .debug_line.
+func lineProgramSize(of *objFile, line []byte, off int64) (int64, error) {
+	if off < 0 || off+4 > int64(len(line)) {
+		return 0, fmt.Errorf("stmt_list offset 0x%x out of range", off)
+	}
+	order := of.byteOrder()
+	length := int64(order.Uint32(line[off:]))
+	hdr := int64(4)
+	if length == 0xffffffff {
+		if off+12 > int64(len(line)) {
+			return 0, fmt.Errorf("truncated line table at offset 0x%x", off)
+		}
+		length = int64(order.Uint64(line[off+4:]))
+		hdr = 12
+	}
+	if off+hdr+length > int64(len(line)) {
+		return 0, fmt.Errorf("line table at offset 0x%x overruns section", off)
+	}
+	return hdr + length, nil
+}
+
+// collectCUSizes computes per-CU-name byte counts for .debug_info,
+// .debug_line and .debug_loc (or .debug_loclists). Bytes within those
+// sections not claimed by any CU are charged to 'unattributedCU'.
+func collectCUSizes(of *objFile, d *dwarf.Data) ([]*cuSizes, error) {
+	info, err := of.sectionData(".debug_info")
+	if err != nil {
+		return nil, err
+	}
+	units, err := parseUnitHeaders(info, of.byteOrder(), false)
+	if err != nil {
+		return nil, err
+	}
+	line, err := of.sectionData(".debug_line")
+	if err != nil {
+		return nil, err
+	}
+	lr, err := newLocListReader(of)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*cuSizes)
+	seenLine := make(map[int64]bool)
+	seenLoc := make(map[int64]bool)
+	var lineTot, locTot int64
+	var cur *cuSizes
+	var lc *locListCU
+	ui := -1
+
+	rdr := d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag == 0 {
+			continue
+		}
+		if ui < 0 || int64(ent.Offset) >= units[ui].end {
+			for ui++; ui < len(units) && int64(ent.Offset) >= units[ui].end; ui++ {
+			}
+			if ui >= len(units) {
+				return nil, fmt.Errorf("DIE at offset 0x%x lies outside any unit", ent.Offset)
+			}
+			u := &units[ui]
+			name, _ := ent.Val(dwarf.AttrName).(string)
+			cur = byName[name]
+			if cur == nil {
+				cur = &cuSizes{Name: name}
+				byName[name] = cur
+			}
+			cur.CUs++
+			cur.Info += u.end - u.off
+			lc = newLocListCU(u, ent)
+			if off, ok := ent.Val(dwarf.AttrStmtList).(int64); ok && !seenLine[off] {
+				seenLine[off] = true
+				sz, err := lineProgramSize(of, line, off)
+				if err != nil {
+					return nil, err
+				}
+				cur.Line += sz
+				lineTot += sz
+			}
+		}
+		for i := range ent.Field {
+			f := &ent.Field[i]
+			// DW_AT_loclists_base is of class loclistptr too, but points
+			// at the offsets array of the CU's location lists.
+			if f.Class != dwarf.ClassLocListPtr && f.Class != dwarf.ClassLocList || f.Attr == dwarf.AttrLoclistsBase {
+				continue
+			}
+			off, err := lr.listOffset(lc, f)
+			if err != nil {
+				return nil, fmt.Errorf("DIE at offset 0x%x: %v", ent.Offset, err)
+			}
+			if seenLoc[off] {
+				continue
+			}
+			seenLoc[off] = true
+			_, end, err := lr.read(lc, off)
+			if err != nil {
+				return nil, fmt.Errorf("DIE at offset 0x%x: %v", ent.Offset, err)
+			}
+			cur.Loc += end - off
+			locTot += end - off
+		}
+	}
+
+	var unattr cuSizes
+	unattr.Name = unattributedCU
+	unattr.Line = int64(len(line)) - lineTot
+	unattr.Loc = int64(len(lr.loc)+len(lr.loclists)) - locTot
+	if unattr.Line != 0 || unattr.Loc != 0 {
+		byName[unattributedCU] = &unattr
+	}
+
+	rv := make([]*cuSizes, 0, len(byName))
+	for _, cs := range byName {
+		cs.Total = cs.Info + cs.Line + cs.Loc
+		rv = append(rv, cs)
+	}
+	return rv, nil
+}
+
+// sortCUSizes orders the breakdown according to 'key', one of
+// "name", "info", "line", "loc" or "total"; numeric keys sort
+// largest first.
+func sortCUSizes(css []*cuSizes, key string) error {
+	var val func(cs *cuSizes) int64
+	switch key {
+	case "name":
+		sort.Slice(css, func(i, j int) bool { return css[i].Name < css[j].Name })
+		return nil
+	case "info":
+		val = func(cs *cuSizes) int64 { return cs.Info }
+	case "line":
+		val = func(cs *cuSizes) int64 { return cs.Line }
+	case "loc":
+		val = func(cs *cuSizes) int64 { return cs.Loc }
+	case "total":
+		val = func(cs *cuSizes) int64 { return cs.Total }
+	default:
+		return fmt.Errorf("unknown sort key %q", key)
+	}
+	sort.Slice(css, func(i, j int) bool {
+		if val(css[i]) != val(css[j]) {
+			return val(css[i]) > val(css[j])
+		}
+		return css[i].Name < css[j].Name
+	})
+	return nil
+}
+
+// dumpCUSizes writes the per-CU breakdown to stdout in the requested
+// format.
+func dumpCUSizes(of *objFile, d *dwarf.Data, mode cuSizesMode, sortKey string) error {
+	css, err := collectCUSizes(of, d)
+	if err != nil {
+		return err
+	}
+	if err := sortCUSizes(css, sortKey); err != nil {
+		return err
+	}
+	switch mode {
+	case jsonCUSizes:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(css)
+	case csvCUSizes:
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"name", "cus", "debug_info", "debug_line", "debug_loc", "total"})
+		for _, cs := range css {
+			w.Write([]string{cs.Name, strconv.Itoa(cs.CUs),
+				strconv.FormatInt(cs.Info, 10), strconv.FormatInt(cs.Line, 10),
+				strconv.FormatInt(cs.Loc, 10), strconv.FormatInt(cs.Total, 10)})
+		}
+		w.Flush()
+		return w.Error()
+	}
+	fmt.Printf("%-40s %5s %12s %12s %12s %12s\n", "name", "CUs",
+		".debug_info", ".debug_line", ".debug_loc", "total")
+	for _, cs := range css {
+		fmt.Printf("%-40s %5d %12d %12d %12d %12d\n", shortName(cs.Name, 40),
+			cs.CUs, cs.Info, cs.Line, cs.Loc, cs.Total)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCUSizes(t *testing.T) {
+	exe := buildSelf(t, t.TempDir(), noExtra)
+	of, d := loadObj(t, exe)
+	css, err := collectCUSizes(of, d)
+	if err != nil {
+		t.Fatalf("collectCUSizes: %v", err)
+	}
+	if err := sortCUSizes(css, "total"); err != nil {
+		t.Fatalf("sortCUSizes: %v", err)
+	}
+	if err := sortCUSizes(css, "bogus"); err == nil {
+		t.Errorf("sortCUSizes accepted bogus key")
+	}
+
+	// Per-CU counts (including unattributed bytes) should add up
+	// to the section sizes.
+	var info, line, loc int64
+	foundMain := false
+	for _, cs := range css {
+		info += cs.Info
+		line += cs.Line
+		loc += cs.Loc
+		if cs.Name == "main" {
+			foundMain = true
+		}
+	}
+	if !foundMain {
+		t.Errorf("no entry for package main")
+	}
+	want := func(sect string) int64 {
+		b, err := of.sectionData(sect)
+		if err != nil {
+			t.Fatalf("reading %s: %v", sect, err)
+		}
+		return int64(len(b))
+	}
+	if w := want(".debug_info"); info != w {
+		t.Errorf(".debug_info: got %d bytes want %d", info, w)
+	}
+	if w := want(".debug_line"); line != w {
+		t.Errorf(".debug_line: got %d bytes want %d", line, w)
+	}
+	if w := want(".debug_loc") + want(".debug_loclists"); loc != w {
+		t.Errorf(".debug_loc: got %d bytes want %d", loc, w)
+	}
+}
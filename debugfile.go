@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// elfHasDebugInfo returns true if the ELF file carries a (non-empty)
+// .debug_info section, compressed or otherwise.
+func elfHasDebugInfo(ef *elf.File) bool {
+	for _, name := range []string{".debug_info", ".zdebug_info"} {
+		if s := ef.Section(name); s != nil && s.Type != elf.SHT_NOBITS && s.Size != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// debugLink returns the file name and CRC recorded in the
+// .gnu_debuglink section, if there is one.
+func debugLink(ef *elf.File) (string, uint32, bool, error) {
+	s := ef.Section(".gnu_debuglink")
+	if s == nil {
+		return "", 0, false, nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return "", 0, false, err
+	}
+	nul := bytes.IndexByte(data, 0)
+	if nul <= 0 {
+		return "", 0, false, fmt.Errorf("malformed .gnu_debuglink section")
+	}
+	// The CRC follows the NUL-terminated name, at the next 4-byte
+	// aligned offset.
+	crcOff := (nul + 1 + 3) &^ 3
+	if crcOff+4 > len(data) {
+		return "", 0, false, fmt.Errorf("truncated .gnu_debuglink section")
+	}
+	return string(data[:nul]), ef.ByteOrder.Uint32(data[crcOff:]), true, nil
+}
+
+// fileCRC32 computes the .gnu_debuglink style CRC of a file.
+func fileCRC32(path string) (uint32, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return crc32.ChecksumIEEE(content), nil
+}
+
+// debugFileDirs returns the list of global debug directories from
+// the -debug-file-directory flag.
+func debugFileDirs() []string {
+	var dirs []string
+	for _, d := range filepath.SplitList(*debugfiledirflag) {
+		if d != "" {
+			dirs = append(dirs, d)
+		}
+	}
+	return dirs
+}
+
+// findSeparateDebugFile looks for a separate debug file for 'exe',
+// first via its GNU build ID under each of 'dirs' (using the
+// ".build-id/xx/yyyy.debug" layout), then via its .gnu_debuglink
+// (next to the executable, in a ".debug" subdirectory, and under each
+// of 'dirs' followed by the executable's directory). Debuglink
+// candidates must match the recorded CRC. Returns "" if nothing
+// suitable is found.
+func findSeparateDebugFile(exe string, ef *elf.File, dirs []string) (string, error) {
+	if id := gnuBuildId(ef); len(id) >= 2 {
+		hid := hex.EncodeToString(id)
+		for _, dir := range dirs {
+			cand := filepath.Join(dir, ".build-id", hid[:2], hid[2:]+".debug")
+			verb(2, "trying build-id debug file %s", cand)
+			df, err := elf.Open(cand)
+			if err != nil {
+				continue
+			}
+			did := gnuBuildId(df)
+			df.Close()
+			if !bytes.Equal(did, id) {
+				warn("ignoring debug file %s: build id %x does not match %s",
+					cand, did, hid)
+				continue
+			}
+			return cand, nil
+		}
+	}
+
+	name, crc, ok, err := debugLink(ef)
+	if err != nil || !ok {
+		return "", err
+	}
+	exedir, err := filepath.Abs(filepath.Dir(exe))
+	if err != nil {
+		return "", err
+	}
+	cands := []string{
+		filepath.Join(exedir, name),
+		filepath.Join(exedir, ".debug", name),
+	}
+	for _, dir := range dirs {
+		cands = append(cands, filepath.Join(dir, exedir, name))
+	}
+	exeAbs, _ := filepath.Abs(exe)
+	for _, cand := range cands {
+		if cand == exeAbs {
+			continue
+		}
+		verb(2, "trying debuglink debug file %s", cand)
+		if _, err := os.Stat(cand); err != nil {
+			continue
+		}
+		got, err := fileCRC32(cand)
+		if err != nil {
+			return "", err
+		}
+		if got != crc {
+			warn("ignoring debug file %s: CRC 0x%08x does not match .gnu_debuglink CRC 0x%08x",
+				cand, got, crc)
+			continue
+		}
+		return cand, nil
+	}
+	return "", nil
+}
+
+// openSeparateDebugFile locates and opens the separate debug file
+// for 'exe', returning nil if there isn't one. The file the ELF was
+// read from is returned too, for the caller to close.
+func openSeparateDebugFile(exe string, ef *elf.File) (*elf.File, *os.File, error) {
+	path, err := findSeparateDebugFile(exe, ef, debugFileDirs())
+	if err != nil || path == "" {
+		return nil, nil, err
+	}
+	verb(1, "using separate debug file %s for %s", path, exe)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	df, err := elf.NewFile(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if !elfHasDebugInfo(df) {
+		f.Close()
+		return nil, nil, fmt.Errorf("debug file %s has no DWARF", path)
+	}
+	return df, f, nil
+}
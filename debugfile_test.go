@@ -0,0 +1,102 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestSeparateDebugFile(t *testing.T) {
+	objcopy, err := exec.LookPath("objcopy")
+	if err != nil {
+		t.Skip("no objcopy available")
+	}
+	dir := t.TempDir()
+	exe := buildSelf(t, dir, noExtra)
+	if _, err := elf.Open(exe); err != nil {
+		t.Skip("test requires ELF binaries")
+	}
+
+	// Split out the debug info, leaving a .gnu_debuglink behind.
+	dbg := exe + ".debug"
+	run := func(args ...string) {
+		if b, err := exec.Command(objcopy, args...).CombinedOutput(); err != nil {
+			t.Logf("objcopy: %s\n", b)
+			t.Fatalf("objcopy %v: %v", args, err)
+		}
+	}
+	run("--only-keep-debug", exe, dbg)
+	run("--strip-debug", "--add-gnu-debuglink="+dbg, exe)
+
+	ef, err := elf.Open(exe)
+	if err != nil {
+		t.Fatalf("opening stripped exe: %v", err)
+	}
+	defer ef.Close()
+	if elfHasDebugInfo(ef) {
+		t.Fatalf("stripped exe still has .debug_info")
+	}
+
+	// Found via .gnu_debuglink next to the executable.
+	got, err := findSeparateDebugFile(exe, ef, nil)
+	if err != nil || got != dbg {
+		t.Errorf("debuglink lookup: got %q, %v want %q", got, err, dbg)
+	}
+
+	// openObject reads the DWARF, including any compressed sections,
+	// from the debug file.
+	f, err := os.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	of, _ := openObject(exe, f, elfFormat, options{})
+	if of == nil || of.df == nil {
+		t.Fatalf("openObject did not load %s", dbg)
+	}
+	if !checkCompressedSections(of.ef, of.r) {
+		t.Errorf("compressed sections of %s not read from it", dbg)
+	}
+	// Loaded sections are read from the executable.
+	if tab, err := goLineTable(of); err != nil || tab == nil {
+		t.Errorf("goLineTable: %v, %v", tab, err)
+	}
+	if text := of.ef.Section(".text"); text == nil || of.codeBytes(text.Addr, text.Addr+16) == nil {
+		t.Errorf("no code read for .text")
+	}
+	if err := of.close(); err != nil {
+		t.Errorf("closing %s: %v", dbg, err)
+	}
+
+	// Found via build ID in a debug directory.
+	id := gnuBuildId(ef)
+	if len(id) == 0 {
+		t.Skip("no GNU build ID in test binary")
+	}
+	hid := hex.EncodeToString(id)
+	gdir := filepath.Join(dir, "global")
+	bid := filepath.Join(gdir, ".build-id", hid[:2], hid[2:]+".debug")
+	if err := os.MkdirAll(filepath.Dir(bid), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(dbg, bid); err != nil {
+		t.Fatal(err)
+	}
+	got, err = findSeparateDebugFile(exe, ef, []string{gdir})
+	if err != nil || got != bid {
+		t.Errorf("build-id lookup: got %q, %v want %q", got, err, bid)
+	}
+
+	// A debuglink target with the wrong CRC should be rejected.
+	if err := ioutil.WriteFile(dbg, []byte("garbage"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	got, err = findSeparateDebugFile(exe, ef, nil)
+	if err != nil || got != "" {
+		t.Errorf("bad CRC lookup: got %q, %v want no file", got, err)
+	}
+}
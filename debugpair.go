@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/hex"
+	"path/filepath"
+)
+
+// verifyDebugPair checks that 'dbgfile' is the separate debug file
+// for 'exe': their GNU and Go build IDs must agree, the executable's
+// .gnu_debuglink CRC (if any) must match the debug file, and the
+// allocated sections common to both must have the same addresses and
+// sizes. Returns false if any mismatch is found.
+func verifyDebugPair(exe, dbgfile string) bool {
+	ef, err := elf.Open(exe)
+	if err != nil {
+		warn("unable to open %s as ELF: %v", exe, err)
+		return false
+	}
+	defer ef.Close()
+	df, err := elf.Open(dbgfile)
+	if err != nil {
+		warn("unable to open %s as ELF: %v", dbgfile, err)
+		return false
+	}
+	defer df.Close()
+
+	ok := true
+	mismatch := func(s string, a ...interface{}) {
+		warn("mismatch: "+s, a...)
+		ok = false
+	}
+
+	if ef.Class != df.Class || ef.Machine != df.Machine {
+		mismatch("%s is %v/%v but %s is %v/%v", exe, ef.Class, ef.Machine,
+			dbgfile, df.Class, df.Machine)
+	}
+
+	// Build IDs.
+	ids := []struct {
+		what string
+		get  func(*elf.File) []byte
+		fmt  func([]byte) string
+	}{
+		{"GNU build ID", gnuBuildId, hex.EncodeToString},
+		{"Go build ID", goBuildId, func(b []byte) string { return string(b) }},
+	}
+	for _, id := range ids {
+		eid, did := id.get(ef), id.get(df)
+		switch {
+		case eid == nil && did == nil:
+			verb(1, "no %s in either file", id.what)
+		case eid == nil || did == nil:
+			mismatch("%s present in only one file (%s: %q, %s: %q)",
+				id.what, exe, id.fmt(eid), dbgfile, id.fmt(did))
+		case !bytes.Equal(eid, did):
+			mismatch("%s differs (%s: %s, %s: %s)",
+				id.what, exe, id.fmt(eid), dbgfile, id.fmt(did))
+		default:
+			verb(1, "%s matches: %s", id.what, id.fmt(eid))
+		}
+	}
+
+	// Debuglink CRC.
+	name, crc, haveLink, err := debugLink(ef)
+	if err != nil {
+		mismatch("%s: %v", exe, err)
+	} else if haveLink {
+		if name != filepath.Base(dbgfile) {
+			warn("note: .gnu_debuglink in %s names %q, not %q",
+				exe, name, filepath.Base(dbgfile))
+		}
+		got, err := fileCRC32(dbgfile)
+		if err != nil {
+			mismatch("%v", err)
+		} else if got != crc {
+			mismatch(".gnu_debuglink CRC 0x%08x does not match %s CRC 0x%08x",
+				crc, dbgfile, got)
+		} else {
+			verb(1, ".gnu_debuglink CRC matches: 0x%08x", crc)
+		}
+	}
+
+	// Section layout.
+	compared := 0
+	for _, es := range ef.Sections {
+		if es.Flags&elf.SHF_ALLOC == 0 {
+			continue
+		}
+		ds := df.Section(es.Name)
+		if ds == nil {
+			if es.Name == ".text" {
+				mismatch("%s has no .text section header", dbgfile)
+			}
+			continue
+		}
+		compared++
+		if es.Addr != ds.Addr || es.Size != ds.Size {
+			mismatch("section %s at 0x%x size 0x%x in %s, but at 0x%x size 0x%x in %s",
+				es.Name, es.Addr, es.Size, exe, ds.Addr, ds.Size, dbgfile)
+		}
+	}
+	verb(1, "compared %d allocated sections", compared)
+
+	if !elfHasDebugInfo(df) {
+		mismatch("%s contains no .debug_info", dbgfile)
+	}
+	return ok
+}
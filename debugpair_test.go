@@ -0,0 +1,38 @@
+package main
+
+import (
+	"debug/elf"
+	"os/exec"
+	"testing"
+)
+
+func TestVerifyDebugPair(t *testing.T) {
+	objcopy, err := exec.LookPath("objcopy")
+	if err != nil {
+		t.Skip("no objcopy available")
+	}
+	dir := t.TempDir()
+	exe := buildSelf(t, dir, noExtra)
+	if _, err := elf.Open(exe); err != nil {
+		t.Skip("test requires ELF binaries")
+	}
+	dbg := exe + ".debug"
+	for _, args := range [][]string{
+		{"--only-keep-debug", exe, dbg},
+		{"--strip-debug", "--add-gnu-debuglink=" + dbg, exe},
+	} {
+		if b, err := exec.Command(objcopy, args...).CombinedOutput(); err != nil {
+			t.Logf("objcopy: %s\n", b)
+			t.Fatalf("objcopy %v: %v", args, err)
+		}
+	}
+	if !verifyDebugPair(exe, dbg) {
+		t.Errorf("verifyDebugPair failed for matching pair")
+	}
+
+	// Pair the debug file with an unrelated executable.
+	other := buildFixture(t, dir, "layout.go", noExtra)
+	if verifyDebugPair(other, dbg) {
+		t.Errorf("verifyDebugPair succeeded for mismatched pair")
+	}
+}
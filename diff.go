@@ -0,0 +1,450 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// diffCoverageThreshold is the change, in percentage points, in a
+// package's or function's location coverage that 'diff' reports.
+const diffCoverageThreshold = 1.0
+
+// sectionDelta is the change in size of a section between two builds;
+// 'old' or 'new' is -1 if the section is absent from that build.
+type sectionDelta struct {
+	name     string
+	old, new int64
+}
+
+// inlineDelta is the change in the inline tree of a function: the
+// number of inlined copies gained and lost at each inline path.
+type inlineDelta struct {
+	fn             string
+	added, removed map[string]int
+}
+
+// coverageDelta is the change in location coverage of a package or
+// function.
+type coverageDelta struct {
+	old, new *locStats
+}
+
+// layoutDelta is a named type whose layout differs between two builds.
+type layoutDelta struct {
+	name     string
+	old, new dwarf.Type
+}
+
+// dwarfDiff holds the differences in DWARF between two builds of a
+// program.
+type dwarfDiff struct {
+	sections       []sectionDelta
+	added, removed []string // functions
+	inlines        []inlineDelta
+	binary         coverageDelta
+	packages       []coverageDelta
+	funcs          []coverageDelta
+	layouts        []layoutDelta
+}
+
+// sectionSizes returns the size of each section of 'of', as stored in
+// the file (so compressed debug sections count at their compressed
+// size).
+func sectionSizes(of *objFile) map[string]int64 {
+	rv := make(map[string]int64)
+	switch {
+	case of.ef != nil:
+		for _, s := range of.ef.Sections {
+			if s.Name != "" {
+				rv[s.Name] += int64(s.FileSize)
+			}
+		}
+	case of.mf != nil:
+		for _, s := range of.mf.Sections {
+			rv[s.Seg+","+s.Name] += int64(s.Size)
+		}
+	case of.pf != nil:
+		for _, s := range of.pf.Sections {
+			rv[s.Name] += int64(s.Size)
+		}
+	}
+	return rv
+}
+
+// diffSections returns the sections whose size differs, by name.
+func diffSections(old, new map[string]int64) []sectionDelta {
+	var rv []sectionDelta
+	for name, o := range old {
+		n, ok := new[name]
+		if !ok {
+			n = -1
+		}
+		if n != o {
+			rv = append(rv, sectionDelta{name: name, old: o, new: n})
+		}
+	}
+	for name, n := range new {
+		if _, ok := old[name]; !ok {
+			rv = append(rv, sectionDelta{name: name, old: -1, new: n})
+		}
+	}
+	sort.Slice(rv, func(i, j int) bool { return rv[i].name < rv[j].name })
+	return rv
+}
+
+// diffSets returns the names in 'new' but not 'old', and those in
+// 'old' but not 'new', sorted.
+func diffSets(old, new map[string]bool) ([]string, []string) {
+	var added, removed []string
+	for name := range new {
+		if !old[name] {
+			added = append(added, name)
+		}
+	}
+	for name := range old {
+		if !new[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// diffInlineTrees returns the changes in the inline trees of the
+// functions present in both builds, the most changed first.
+func diffInlineTrees(old, new inlineTrees) []inlineDelta {
+	var rv []inlineDelta
+	for fn, ot := range old {
+		nt, ok := new[fn]
+		if !ok {
+			continue
+		}
+		id := inlineDelta{fn: fn, added: make(map[string]int), removed: make(map[string]int)}
+		for path, n := range nt {
+			if n > ot[path] {
+				id.added[path] = n - ot[path]
+			}
+		}
+		for path, o := range ot {
+			if o > nt[path] {
+				id.removed[path] = o - nt[path]
+			}
+		}
+		if len(id.added)+len(id.removed) != 0 {
+			rv = append(rv, id)
+		}
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		ci := len(rv[i].added) + len(rv[i].removed)
+		cj := len(rv[j].added) + len(rv[j].removed)
+		if ci != cj {
+			return ci > cj
+		}
+		return rv[i].fn < rv[j].fn
+	})
+	return rv
+}
+
+// diffCoverage pairs up the entries of 'old' and 'new' by key and
+// returns those whose coverage changed by at least
+// diffCoverageThreshold, the largest changes first.
+func diffCoverage(old, new []*locStats) []coverageDelta {
+	byKey := make(map[string]*locStats)
+	for _, ls := range old {
+		byKey[ls.key()] = ls
+	}
+	var rv []coverageDelta
+	for _, n := range new {
+		o := byKey[n.key()]
+		if o == nil {
+			continue
+		}
+		if d := n.coverage() - o.coverage(); d >= diffCoverageThreshold || -d >= diffCoverageThreshold {
+			rv = append(rv, coverageDelta{old: o, new: n})
+		}
+	}
+	abs := func(cd coverageDelta) float64 {
+		d := cd.new.coverage() - cd.old.coverage()
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		if abs(rv[i]) != abs(rv[j]) {
+			return abs(rv[i]) > abs(rv[j])
+		}
+		return rv[i].new.key() < rv[j].new.key()
+	})
+	return rv
+}
+
+// singleLayouts returns the named types that have a single layout in
+// 'd', keyed as by collectODR, with the offset of their DIE.
+func singleLayouts(d *dwarf.Data) (map[string]*odrVariant, error) {
+	variants, err := collectODR(d)
+	if err != nil {
+		return nil, err
+	}
+	rv := make(map[string]*odrVariant)
+	for key, vs := range variants {
+		if len(vs) == 1 {
+			rv[key] = vs[0]
+		}
+	}
+	return rv, nil
+}
+
+// diffLayouts returns the named types present in both builds whose
+// layout differs. Types with conflicting layouts within one build
+// (see -checkodr) are skipped.
+func diffLayouts(od, nd *dwarf.Data) ([]layoutDelta, error) {
+	old, err := singleLayouts(od)
+	if err != nil {
+		return nil, err
+	}
+	new, err := singleLayouts(nd)
+	if err != nil {
+		return nil, err
+	}
+	var rv []layoutDelta
+	for key, ov := range old {
+		nv, ok := new[key]
+		if !ok || nv.hash == ov.hash {
+			continue
+		}
+		ot, err := od.Type(ov.offset)
+		if err != nil {
+			return nil, err
+		}
+		nt, err := nd.Type(nv.offset)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, layoutDelta{name: key, old: ot, new: nt})
+	}
+	sort.Slice(rv, func(i, j int) bool { return rv[i].name < rv[j].name })
+	return rv, nil
+}
+
+// computeDiff compares the DWARF of two builds of a program.
+func computeDiff(oof *objFile, od *dwarf.Data, nof *objFile, nd *dwarf.Data) (*dwarfDiff, error) {
+	dd := &dwarfDiff{sections: diffSections(sectionSizes(oof), sectionSizes(nof))}
+
+	funcNames := func(d *dwarf.Data) (map[string]bool, error) {
+		funcs, err := collectDwarfFuncs(d)
+		if err != nil {
+			return nil, err
+		}
+		names := make(map[dwarf.Offset]string)
+		rv := make(map[string]bool)
+		for _, f := range funcs {
+			name := f.name
+			if name == "" {
+				name = originName(d, f.off, names)
+			}
+			rv[name] = true
+		}
+		return rv, nil
+	}
+	of, err := funcNames(od)
+	if err != nil {
+		return nil, err
+	}
+	nf, err := funcNames(nd)
+	if err != nil {
+		return nil, err
+	}
+	dd.added, dd.removed = diffSets(of, nf)
+
+	ot, err := collectInlineTrees(od)
+	if err != nil {
+		return nil, err
+	}
+	nt, err := collectInlineTrees(nd)
+	if err != nil {
+		return nil, err
+	}
+	dd.inlines = diffInlineTrees(ot, nt)
+
+	ol, err := collectLocStats(oof, od)
+	if err != nil {
+		return nil, err
+	}
+	nl, err := collectLocStats(nof, nd)
+	if err != nil {
+		return nil, err
+	}
+	dd.binary = coverageDelta{old: &ol.Binary, new: &nl.Binary}
+	dd.packages = diffCoverage(ol.Packages, nl.Packages)
+	dd.funcs = diffCoverage(ol.Functions, nl.Functions)
+
+	// debug/dwarf can't decode every type; that shouldn't stop the
+	// rest of the comparison.
+	if dd.layouts, err = diffLayouts(od, nd); err != nil {
+		warn("not comparing type layouts: %v", err)
+	}
+	return dd, nil
+}
+
+// sizeString formats a section size, or "-" if it is absent.
+func sizeString(n int64) string {
+	if n < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+// dumpDiff prints 'dd', listing at most 'max' entries of each kind
+// (all of them if 'max' is zero).
+func dumpDiff(dd *dwarfDiff, max int) {
+	more := func(i, n int) bool {
+		if max > 0 && i == max {
+			fmt.Printf("    ... and %d more\n", n-i)
+			return false
+		}
+		return true
+	}
+
+	fmt.Printf("sections: %d changed in size\n", len(dd.sections))
+	for _, s := range dd.sections {
+		delta := ""
+		if s.old >= 0 && s.new >= 0 {
+			delta = fmt.Sprintf(" (%+d", s.new-s.old)
+			if s.old != 0 {
+				delta += fmt.Sprintf(", %+.1f%%", 100*float64(s.new-s.old)/float64(s.old))
+			}
+			delta += ")"
+		}
+		fmt.Printf("    %-30s %12s -> %12s%s\n", s.name, sizeString(s.old), sizeString(s.new), delta)
+	}
+
+	fmt.Printf("functions: %d added, %d removed\n", len(dd.added), len(dd.removed))
+	for i, name := range dd.added {
+		if !more(i, len(dd.added)) {
+			break
+		}
+		fmt.Printf("    + %s\n", name)
+	}
+	for i, name := range dd.removed {
+		if !more(i, len(dd.removed)) {
+			break
+		}
+		fmt.Printf("    - %s\n", name)
+	}
+
+	fmt.Printf("inline trees: %d functions changed\n", len(dd.inlines))
+	for i, id := range dd.inlines {
+		if !more(i, len(dd.inlines)) {
+			break
+		}
+		var lines []string
+		nadd, nrem := 0, 0
+		for _, p := range sortedKeys(id.added) {
+			lines = append(lines, fmt.Sprintf("+ %s (%d)", p, id.added[p]))
+			nadd += id.added[p]
+		}
+		for _, p := range sortedKeys(id.removed) {
+			lines = append(lines, fmt.Sprintf("- %s (%d)", p, id.removed[p]))
+			nrem += id.removed[p]
+		}
+		fmt.Printf("    %s: %d inlined copies gained, %d lost\n", id.fn, nadd, nrem)
+		for j, l := range lines {
+			if !more(j, len(lines)) {
+				break
+			}
+			fmt.Printf("        %s\n", l)
+		}
+	}
+
+	b := dd.binary
+	fmt.Printf("location coverage: %.1f%% -> %.1f%% of variables available, %.1f%% -> %.1f%% of scope bytes covered\n",
+		b.old.availability(), b.new.availability(), b.old.coverage(), b.new.coverage())
+	for _, l := range []struct {
+		what string
+		cds  []coverageDelta
+	}{{"packages", dd.packages}, {"functions", dd.funcs}} {
+		fmt.Printf("    %d %s changed by %.1f percentage points or more\n", len(l.cds), l.what, diffCoverageThreshold)
+		var news []*locStats
+		for _, cd := range l.cds {
+			news = append(news, cd.new)
+		}
+		dups := dupNames(news)
+		for i, cd := range l.cds {
+			if !more(i, len(l.cds)) {
+				break
+			}
+			fmt.Printf("        %-50s %5.1f%% -> %5.1f%%\n", shortName(cd.new.label(dups), 50),
+				cd.old.coverage(), cd.new.coverage())
+		}
+	}
+
+	fmt.Printf("type layouts: %d changed\n", len(dd.layouts))
+	for i, ld := range dd.layouts {
+		if !more(i, len(dd.layouts)) {
+			break
+		}
+		fmt.Printf("    %s: size %d -> %d\n", ld.name, ld.old.Size(), ld.new.Size())
+	}
+}
+
+// sortedKeys returns the keys of 'm' in order.
+func sortedKeys(m map[string]int) []string {
+	rv := make([]string, 0, len(m))
+	for k := range m {
+		rv = append(rv, k)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// loadForDiff opens 'filename' and loads its DWARF, reporting any
+// problem. Universal Mach-O binaries and archives aren't supported.
+func loadForDiff(filename string, o options) (*objFile, *dwarf.Data, *os.File) {
+	f, err := os.Open(filename)
+	if err != nil {
+		warn("%v", err)
+		setExit(exitNotObject)
+		return nil, nil, nil
+	}
+	format := sniffFormat(f)
+	if format == fatFormat || isArchive(f) {
+		warn("%s: diff of universal binaries and archives is not supported", filename)
+		setExit(exitUsage)
+		f.Close()
+		return nil, nil, nil
+	}
+	of, d := openObject(filename, f, format, o)
+	if of == nil {
+		f.Close()
+		return nil, nil, nil
+	}
+	return of, d, f
+}
+
+// diffFiles reports the differences in DWARF between the builds
+// 'oldfile' and 'newfile'. Returns false if either couldn't be read.
+func diffFiles(oldfile, newfile string, o options, max int) bool {
+	oof, od, of := loadForDiff(oldfile, o)
+	if oof == nil {
+		return false
+	}
+	defer of.Close()
+	defer oof.close()
+	nof, nd, nf := loadForDiff(newfile, o)
+	if nof == nil {
+		return false
+	}
+	defer nf.Close()
+	defer nof.close()
+	dd, err := computeDiff(oof, od, nof, nd)
+	if err != nil {
+		warn("error comparing %s and %s: %v", oldfile, newfile, err)
+		return false
+	}
+	dumpDiff(dd, max)
+	return true
+}
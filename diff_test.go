@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSections(t *testing.T) {
+	old := map[string]int64{".text": 100, ".debug_info": 50, ".debug_loc": 10}
+	new := map[string]int64{".text": 120, ".debug_info": 50, ".debug_loclists": 12}
+	got := diffSections(old, new)
+	want := []sectionDelta{
+		{".debug_loc", 10, -1},
+		{".debug_loclists", -1, 12},
+		{".text", 100, 120},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffSections = %v, want %v", got, want)
+	}
+}
+
+func TestDiffInlineTrees(t *testing.T) {
+	old := inlineTrees{
+		"f": {"a": 2, "a > b": 1},
+		"g": {"c": 1},
+		"h": {},
+	}
+	new := inlineTrees{
+		"f": {"a": 1, "a > b": 1, "d": 1},
+		"g": {"c": 1},
+	}
+	got := diffInlineTrees(old, new)
+	if len(got) != 1 || got[0].fn != "f" ||
+		!reflect.DeepEqual(got[0].added, map[string]int{"d": 1}) ||
+		!reflect.DeepEqual(got[0].removed, map[string]int{"a": 1}) {
+		t.Errorf("diffInlineTrees = %+v", got)
+	}
+}
+
+func TestDiffCoverage(t *testing.T) {
+	// Same-named functions are paired by linkage name or unit.
+	fn := func(name, linkage, unit string, covered uint64) *locStats {
+		return &locStats{Name: name, LinkageName: linkage, Unit: unit, ScopeBytes: 100, CoveredBytes: covered}
+	}
+	old := []*locStats{
+		fn("f", "_Z1fi", "", 50),
+		fn("f", "_Z1fd", "", 80),
+		fn("helper", "", "a.c", 10),
+		fn("helper", "", "b.c", 90),
+	}
+	new := []*locStats{
+		fn("f", "_Z1fd", "", 80),
+		fn("f", "_Z1fi", "", 60),
+		fn("helper", "", "b.c", 90),
+		fn("helper", "", "a.c", 40),
+	}
+	got := diffCoverage(old, new)
+	if len(got) != 2 || got[0].new.Unit != "a.c" || got[0].old.Unit != "a.c" ||
+		got[1].new.LinkageName != "_Z1fi" || got[1].old.LinkageName != "_Z1fi" {
+		t.Errorf("diffCoverage = %+v", got)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	exe := buildSelf(t, t.TempDir(), noExtra)
+	inl := buildSelf(t, t.TempDir(), moreInlExtra)
+	of, d := loadObj(t, exe)
+	iof, id := loadObj(t, inl)
+
+	same, err := computeDiff(of, d, of, d)
+	if err != nil {
+		t.Fatalf("computeDiff: %v", err)
+	}
+	if len(same.sections)+len(same.added)+len(same.removed)+len(same.inlines)+
+		len(same.packages)+len(same.funcs)+len(same.layouts) != 0 {
+		t.Errorf("differences between a build and itself: %+v", same)
+	}
+
+	dd, err := computeDiff(of, d, iof, id)
+	if err != nil {
+		t.Fatalf("computeDiff: %v", err)
+	}
+	if len(dd.inlines) == 0 {
+		t.Errorf("no inline tree changes with %s", moreInlExtra)
+	}
+	if len(dd.sections) == 0 {
+		t.Errorf("no section size changes with %s", moreInlExtra)
+	}
+	if len(dd.layouts) != 0 {
+		t.Errorf("type layouts changed with %s: %v", moreInlExtra, dd.layouts)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"debug/macho"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dsymDWARFFile returns the path of the DWARF companion file inside
+// the .dSYM bundle 'bundle', i.e. Contents/Resources/DWARF/<name>
+// where <name> is the bundle name without its ".dSYM" suffix. If that
+// isn't present but the DWARF directory holds a single file, that file
+// is used instead.
+func dsymDWARFFile(bundle string) (string, error) {
+	dir := filepath.Join(bundle, "Contents", "Resources", "DWARF")
+	name := strings.TrimSuffix(filepath.Base(filepath.Clean(bundle)), ".dSYM")
+	cand := filepath.Join(dir, name)
+	if fi, err := os.Stat(cand); err == nil && fi.Mode().IsRegular() {
+		return cand, nil
+	}
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("%s is not a .dSYM bundle: %v", bundle, err)
+	}
+	var files []string
+	for _, fi := range fis {
+		if fi.Mode().IsRegular() {
+			files = append(files, fi.Name())
+		}
+	}
+	if len(files) != 1 {
+		return "", fmt.Errorf("no DWARF file for %q in %s (found %d candidates)", name, dir, len(files))
+	}
+	return filepath.Join(dir, files[0]), nil
+}
+
+// machoUUIDs returns the LC_UUID of each architecture in the Mach-O
+// file at 'path', keyed by CPU type; thin files yield a single entry.
+func machoUUIDs(path string) (map[macho.Cpu][]byte, error) {
+	rv := make(map[macho.Cpu][]byte)
+	ff, err := macho.OpenFat(path)
+	if err == nil {
+		defer ff.Close()
+		for _, arch := range ff.Arches {
+			rv[arch.Cpu] = machoUUID(arch.File)
+		}
+		return rv, nil
+	}
+	f, err := macho.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rv[f.Cpu] = machoUUID(f)
+	return rv, nil
+}
+
+// compareDsymUUIDs checks that the DWARF file from a .dSYM bundle
+// carries the same LC_UUID as the executable 'exe' for every
+// architecture they have in common. Returns false on any mismatch.
+func compareDsymUUIDs(exe, dwfile string) bool {
+	eids, err := machoUUIDs(exe)
+	if err != nil {
+		warn("unable to open %s as Macho: %v", exe, err)
+		return false
+	}
+	dids, err := machoUUIDs(dwfile)
+	if err != nil {
+		warn("unable to open %s as Macho: %v", dwfile, err)
+		return false
+	}
+	ok := true
+	compared := 0
+	for cpu, eid := range eids {
+		did, found := dids[cpu]
+		if !found {
+			continue
+		}
+		compared++
+		cname := machoCPUName(cpu)
+		switch {
+		case eid == nil:
+			warn("mismatch: %s has no %s LC_UUID", exe, cname)
+			ok = false
+		case did == nil:
+			warn("mismatch: %s has no %s LC_UUID", dwfile, cname)
+			ok = false
+		case !bytes.Equal(eid, did):
+			warn("mismatch: %s LC_UUID %s in %s, but %s in %s", cname,
+				formatUUID(eid), exe, formatUUID(did), dwfile)
+			ok = false
+		default:
+			verb(1, "%s LC_UUID matches: %s", cname, formatUUID(eid))
+		}
+	}
+	if compared == 0 {
+		warn("mismatch: %s and %s have no architectures in common", exe, dwfile)
+		ok = false
+	}
+	return ok
+}
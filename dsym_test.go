@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDsymBundle(t *testing.T) {
+	dir := t.TempDir()
+	exe := buildDarwinFixture(t, dir, "layout.go", "arm64")
+	if ids, err := machoUUIDs(exe); err != nil || len(ids) != 1 {
+		t.Fatalf("machoUUIDs(%s) = %v, %v", exe, ids, err)
+	}
+
+	// Fake up a bundle; the Go linker leaves the DWARF in the
+	// executable, so that stands in for dsymutil's output.
+	bundle := filepath.Join(dir, "fixture.dSYM")
+	dwdir := filepath.Join(bundle, "Contents", "Resources", "DWARF")
+	if err := os.MkdirAll(dwdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dwfile := filepath.Join(dwdir, "fixture")
+	if err := ioutil.WriteFile(dwfile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := dsymDWARFFile(bundle); err != nil || got != dwfile {
+		t.Errorf("dsymDWARFFile = %q, %v, want %q", got, err, dwfile)
+	}
+	if _, err := dsymDWARFFile(dir); err == nil {
+		t.Errorf("dsymDWARFFile accepted a non-bundle directory")
+	}
+
+	if !compareDsymUUIDs(exe, dwfile) {
+		t.Errorf("compareDsymUUIDs failed for matching pair")
+	}
+	save := *dsymexeflag
+	defer func() { *dsymexeflag = save }()
+	*dsymexeflag = exe
+	if !examineFile(bundle, options{dc: yesDoAbsChecks}) {
+		t.Errorf("examineFile failed on .dSYM bundle")
+	}
+
+	// Perturb the copy's UUID; the bundle no longer matches.
+	ids, _ := machoUUIDs(exe)
+	for _, id := range ids {
+		i := bytes.Index(content, id)
+		if i < 0 {
+			t.Fatalf("LC_UUID not found in %s", exe)
+		}
+		content[i] ^= 0xff
+	}
+	if err := ioutil.WriteFile(dwfile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if compareDsymUUIDs(exe, dwfile) {
+		t.Errorf("compareDsymUUIDs succeeded for mismatched pair")
+	}
+	if examineFile(bundle, options{dc: yesDoAbsChecks}) {
+		t.Errorf("examineFile succeeded on mismatched .dSYM bundle")
+	}
+}
@@ -16,6 +16,22 @@ type DwExaminer struct {
 	dieOffsets  []dwarf.Offset
 	kids        map[int][]int
 	parent      map[int]int
+	typeUnits   map[uint64][]TypeUnit
+}
+
+// TypeUnit describes a type unit, located either in a DWARF 4
+// .debug_types section or (for DWARF 5) in .debug_info itself.
+type TypeUnit struct {
+	Section    string       // section holding the unit
+	Offset     dwarf.Offset // offset of the unit header within Section
+	Signature  uint64       // 8-byte type signature
+	TypeOffset dwarf.Offset // offset of the type DIE within Section
+
+	// For a unit in .debug_types, an examiner over the DIEs of the
+	// section, and the offset of the type DIE as that examiner sees
+	// it (the section may have been read through a rewritten copy).
+	DIEs      *DwExaminer
+	DIEOffset dwarf.Offset
 }
 
 func NewDwExaminer(rdr *dwarf.Reader) (*DwExaminer, error) {
@@ -24,6 +40,7 @@ func NewDwExaminer(rdr *dwarf.Reader) (*DwExaminer, error) {
 	ds.kids = make(map[int][]int)
 	ds.parent = make(map[int]int)
 	ds.idxByOffset = make(map[dwarf.Offset]int)
+	ds.typeUnits = make(map[uint64][]TypeUnit)
 	var lastOffset dwarf.Offset
 	var nstack []int
 	for entry, err := rdr.Next(); entry != nil; entry, err = rdr.Next() {
@@ -60,6 +77,43 @@ func NewDwExaminer(rdr *dwarf.Reader) (*DwExaminer, error) {
 	return &ds, nil
 }
 
+// AddTypeUnit records a type unit so that DW_FORM_ref_sig8
+// references to its signature can be resolved.
+func (ds *DwExaminer) AddTypeUnit(tu TypeUnit) {
+	ds.typeUnits[tu.Signature] = append(ds.typeUnits[tu.Signature], tu)
+}
+
+// TypeUnits returns all type units defining signature 'sig'. A
+// well-formed module has exactly one for each referenced signature.
+func (ds *DwExaminer) TypeUnits(sig uint64) []TypeUnit {
+	return ds.typeUnits[sig]
+}
+
+// ResolveSignature returns the type DIE for signature 'sig', read
+// from .debug_info for DWARF 5 type units and through the unit's DIEs
+// examiner for those in .debug_types.
+func (ds *DwExaminer) ResolveSignature(sig uint64) (*dwarf.Entry, *TypeUnit, error) {
+	tus := ds.typeUnits[sig]
+	if len(tus) == 0 {
+		return nil, nil, fmt.Errorf("no type unit with signature 0x%x", sig)
+	}
+	tu := &tus[0]
+	var entry *dwarf.Entry
+	var err error
+	switch {
+	case tu.Section == ".debug_info":
+		entry, err = ds.LoadEntryByOffset(tu.TypeOffset)
+	case tu.DIEs != nil:
+		entry, err = tu.DIEs.LoadEntryByOffset(tu.DIEOffset)
+	default:
+		err = fmt.Errorf("DIEs of %s not indexed", tu.Section)
+	}
+	if err != nil {
+		return nil, tu, err
+	}
+	return entry, tu, nil
+}
+
 func (ds *DwExaminer) DieOffsets() []dwarf.Offset {
 	rv := make([]dwarf.Offset, len(ds.dieOffsets))
 	copy(rv, ds.dieOffsets)
@@ -180,6 +234,13 @@ func (ds *DwExaminer) Children(idx int) ([]*dwarf.Entry, error) {
 	return ret, nil
 }
 
+// Returns the ID of the parent of DIE 'idx', and false if the DIE is
+// top level.
+func (ds *DwExaminer) ParentID(idx int) (int, bool) {
+	p, found := ds.parent[idx]
+	return p, found
+}
+
 // Returns parent DIE for DIE 'idx', or nil if the DIE is top level
 func (ds *DwExaminer) Parent(idx int) (*dwarf.Entry, error) {
 	var ret *dwarf.Entry
@@ -166,3 +166,54 @@ func TestBasic(t *testing.T) {
 		t.Errorf("subprogram runtime.main not found")
 	}
 }
+
+func TestTypeUnitIndex(t *testing.T) {
+	tmpdir := t.TempDir()
+	exe := filepath.Join(tmpdir, "out.exe")
+	gotoolpath := filepath.Join(runtime.GOROOT(), "bin", "go")
+	cmd := exec.Command(gotoolpath, "build", "-o", exe, "./testdata/example.go")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Logf("build: %s\n", b)
+		t.Fatalf("build error: %v", err)
+	}
+	f, err := elf.Open(exe)
+	if err != nil {
+		t.Skipf("not an ELF binary: %v", err)
+	}
+	d, err := f.DWARF()
+	if err != nil {
+		t.Fatalf("error reading DWARF: %v", err)
+	}
+	dwx, err := dwexaminer.NewDwExaminer(d.Reader())
+	if err != nil {
+		t.Fatalf("error reading DWARF: %v", err)
+	}
+
+	// Register a fake .debug_types unit whose DIEs weren't read,
+	// another pointing at the first DIE in .debug_info, and a third
+	// reading it through a DIEs examiner.
+	dwx.AddTypeUnit(dwexaminer.TypeUnit{Section: ".debug_types", Signature: 1, TypeOffset: 0x20})
+	first := dwx.DieOffsets()[0]
+	dwx.AddTypeUnit(dwexaminer.TypeUnit{Section: ".debug_info", Signature: 2, TypeOffset: first})
+	dwx.AddTypeUnit(dwexaminer.TypeUnit{Section: ".debug_types", Signature: 4, TypeOffset: 0x20,
+		DIEs: dwx, DIEOffset: first})
+
+	if n := len(dwx.TypeUnits(1)); n != 1 {
+		t.Errorf("TypeUnits(1): got %d units want 1", n)
+	}
+	if n := len(dwx.TypeUnits(3)); n != 0 {
+		t.Errorf("TypeUnits(3): got %d units want 0", n)
+	}
+	if e, tu, err := dwx.ResolveSignature(1); err == nil || tu == nil {
+		t.Errorf("ResolveSignature(1): got %v %v %v, want an error", e, tu, err)
+	}
+	if e, _, err := dwx.ResolveSignature(4); err != nil || e == nil || e.Offset != first {
+		t.Errorf("ResolveSignature(4): got %v %v", e, err)
+	}
+	if e, _, err := dwx.ResolveSignature(2); err != nil || e == nil || e.Offset != first {
+		t.Errorf("ResolveSignature(2): got %v %v", e, err)
+	}
+	if _, _, err := dwx.ResolveSignature(3); err == nil {
+		t.Errorf("ResolveSignature(3): expected error")
+	}
+}
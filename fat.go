@@ -0,0 +1,63 @@
+package main
+
+import (
+	"debug/macho"
+	"fmt"
+	"io"
+)
+
+// machoCPUName returns the Go-style architecture name for a Mach-O
+// CPU type, for labeling the slices of a universal binary.
+func machoCPUName(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.Cpu386:
+		return "386"
+	case macho.CpuAmd64:
+		return "amd64"
+	case macho.CpuArm:
+		return "arm"
+	case macho.CpuArm64:
+		return "arm64"
+	case macho.CpuPpc:
+		return "ppc"
+	case macho.CpuPpc64:
+		return "ppc64"
+	}
+	return fmt.Sprintf("cpu%#x", uint32(cpu))
+}
+
+// examineFat checks each architecture slice of a Mach-O universal
+// ("fat") binary in turn, labeling diagnostics with the slice's CPU
+// type. The second result is false if 'filename' is not a universal
+// binary at all, in which case the caller should try the other
+// object file flavors.
+func examineFat(filename string, r io.ReaderAt, o options) (bool, bool) {
+	ff, err := macho.NewFatFile(r)
+	if err != nil {
+		// Java class files share the universal binary magic number,
+		// so don't give up on the file here.
+		verb(1, "unable to open %s as Macho universal binary: %v", filename, err)
+		return false, false
+	}
+	ok := true
+	save := diagLabel
+	for i := range ff.Arches {
+		arch := &ff.Arches[i]
+		label := fmt.Sprintf("%s[%s]", filename, machoCPUName(arch.Cpu))
+		verb(1, "examining slice %s", label)
+		diagLabel = label
+		if o.db == yesDumpBuildId {
+			dumpMachoBuildId(arch.File)
+		}
+		// loadDWARF names the slice in its diagnostics itself.
+		diagLabel = save
+		of := &objFile{mf: arch.File}
+		d := loadDWARF(label, of)
+		diagLabel = label
+		if d == nil || !examineDwarf(label, of, d, o) {
+			ok = false
+		}
+		diagLabel = save
+	}
+	return ok, true
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// writeFat assembles a Mach-O universal binary from the given
+// thin Mach-O files.
+func writeFat(t *testing.T, out string, thin []string) {
+	const align = 14 // 16K, as lipo uses for arm64
+	var hdr, body bytes.Buffer
+	be := binary.BigEndian
+	binary.Write(&hdr, be, uint32(macho.MagicFat))
+	binary.Write(&hdr, be, uint32(len(thin)))
+	off := uint32(1 << align)
+	for _, path := range thin {
+		f, err := macho.Open(path)
+		if err != nil {
+			t.Fatalf("opening %s: %v", path, err)
+		}
+		cpu, sub := f.Cpu, f.SubCpu
+		f.Close()
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []uint32{uint32(cpu), sub, off, uint32(len(content)), align} {
+			binary.Write(&hdr, be, v)
+		}
+		body.Write(make([]byte, int(off)-(1<<align)-body.Len()))
+		body.Write(content)
+		off += (uint32(len(content)) + (1 << align) - 1) &^ (1<<align - 1)
+	}
+	hdr.Write(make([]byte, (1<<align)-hdr.Len()))
+	hdr.Write(body.Bytes())
+	if err := ioutil.WriteFile(out, hdr.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// buildDarwinFixture cross-compiles testdata/<infile> for
+// darwin/<arch> into <tmpdir>/fixture.<arch>.
+func buildDarwinFixture(t *testing.T, tdir, infile, arch string) string {
+	exe := filepath.Join(tdir, "fixture."+arch)
+	gotoolpath := filepath.Join(runtime.GOROOT(), "bin", "go")
+	cmd := exec.Command(gotoolpath, "build", "-o", exe,
+		filepath.Join("testdata", infile))
+	cmd.Env = append(os.Environ(), "GOOS=darwin", "GOARCH="+arch, "CGO_ENABLED=0")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Logf("build: %s\n", b)
+		t.Fatalf("build error: %v", err)
+	}
+	return exe
+}
+
+func TestFatBinary(t *testing.T) {
+	dir := t.TempDir()
+	var thin []string
+	for _, arch := range []string{"amd64", "arm64"} {
+		thin = append(thin, buildDarwinFixture(t, dir, "layout.go", arch))
+	}
+	fat := filepath.Join(dir, "fixture.fat")
+	writeFat(t, fat, thin)
+
+	f, err := os.Open(fat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ok, isFat := examineFat(fat, f, options{dc: yesDoAbsChecks})
+	if !isFat {
+		t.Fatalf("%s not recognized as a universal binary", fat)
+	}
+	if !ok {
+		t.Errorf("examineFat returned false")
+	}
+	if diagLabel != "" {
+		t.Errorf("diagnostic label %q left set", diagLabel)
+	}
+	if !examineFile(fat, options{dc: yesDoAbsChecks}) {
+		t.Errorf("examineFile returned false for universal binary")
+	}
+
+	// A slice with no DWARF is classified as for a thin file.
+	nodwarf := filepath.Join(dir, "nodwarf.arm64")
+	gotoolpath := filepath.Join(runtime.GOROOT(), "bin", "go")
+	cmd := exec.Command(gotoolpath, "build", "-ldflags=-w", "-o", nodwarf, filepath.Join("testdata", "layout.go"))
+	cmd.Env = append(os.Environ(), "GOOS=darwin", "GOARCH=arm64", "CGO_ENABLED=0")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Logf("build: %s\n", b)
+		t.Fatalf("build error: %v", err)
+	}
+	mixed := filepath.Join(dir, "mixed.fat")
+	writeFat(t, mixed, []string{thin[0], nodwarf})
+	save := st
+	defer func() { st = save }()
+	st = exitOK
+	if examineFile(mixed, options{dc: yesDoAbsChecks}) || st != exitNoDWARF {
+		t.Errorf("%s: examineFile succeeded, or exit status %d, want %d", mixed, st, exitNoDWARF)
+	}
+
+	// Thin files are left to the regular openers.
+	tf, err := os.Open(thin[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tf.Close()
+	if _, isFat := examineFat(thin[0], tf, options{}); isFat {
+		t.Errorf("thin Mach-O file treated as universal binary")
+	}
+}
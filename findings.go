@@ -0,0 +1,183 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// finding is a problem reported by one of the checks. Its
+// fingerprint (the check's ID, the qualified name of the function,
+// type, CU or section concerned, and the attribute or aspect at
+// fault) leaves out offsets and addresses, which change with every
+// build, so that -baseline can recognize findings seen before.
+type finding struct {
+	check string // e.g. "absorigin", "odr", "aranges"
+	name  string
+	attr  string
+	at    site
+	msg   string
+}
+
+// site is where in the program a finding was made, as far as the
+// check knows. The config file's suppression rules match against it.
+type site struct {
+	fn   string         // the function concerned
+	dies []dwarf.Offset // DIEs concerned, locating their CUs
+	pc   uint64         // an address in the code concerned
+}
+
+func (f *finding) fingerprint() string {
+	return f.check + "\t" + f.name + "\t" + f.attr
+}
+
+// baselineEntry is a finding as recorded in a baseline file.
+type baselineEntry struct {
+	Check string `json:"check"`
+	Name  string `json:"name"`
+	Attr  string `json:"attr,omitempty"`
+}
+
+func (e *baselineEntry) fingerprint() string {
+	return e.Check + "\t" + e.Name + "\t" + e.Attr
+}
+
+// baselineFile is the contents of a baseline file.
+type baselineFile struct {
+	Findings []baselineEntry `json:"findings"`
+}
+
+// findingBaseline holds the findings of an earlier run, which are
+// not reported again, and the findings of this run.
+type findingBaseline struct {
+	path       string
+	write      bool // record this run's findings rather than suppress
+	known      map[string]baselineEntry
+	seen       map[string]baselineEntry
+	suppressed int
+}
+
+// baseline is the baseline in effect, or nil if -baseline wasn't
+// given.
+var baseline *findingBaseline
+
+// loadBaseline reads the baseline file 'path'. If 'write' is set the
+// file is not read; instead this run's findings are written to it by
+// finish.
+func loadBaseline(path string, write bool) (*findingBaseline, error) {
+	b := &findingBaseline{
+		path:  path,
+		write: write,
+		known: make(map[string]baselineEntry),
+		seen:  make(map[string]baselineEntry),
+	}
+	if write {
+		return b, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var bf baselineFile
+	if err := json.Unmarshal(data, &bf); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, e := range bf.Findings {
+		b.known[e.fingerprint()] = e
+	}
+	return b, nil
+}
+
+// isSuppressed records finding 'f' and reports whether the baseline
+// suppresses it.
+func (b *findingBaseline) isSuppressed(f *finding) bool {
+	fp := f.fingerprint()
+	b.seen[fp] = baselineEntry{Check: f.check, Name: f.name, Attr: f.attr}
+	if b.write {
+		return false
+	}
+	if _, ok := b.known[fp]; ok {
+		b.suppressed++
+		return true
+	}
+	return false
+}
+
+// finish writes the baseline file if requested. Otherwise it notes
+// how many findings were suppressed and, if 'showFixed' is set, lists
+// the baseline's findings that no longer occur.
+func (b *findingBaseline) finish(showFixed bool) error {
+	if !b.write {
+		verb(1, "%d findings suppressed by baseline %s", b.suppressed, b.path)
+		if !showFixed {
+			return nil
+		}
+		var gone []baselineEntry
+		for fp, e := range b.known {
+			if _, ok := b.seen[fp]; !ok {
+				gone = append(gone, e)
+			}
+		}
+		sortBaselineEntries(gone)
+		for _, e := range gone {
+			fmt.Fprintf(os.Stderr, "fixed: %s finding for %q", e.Check, e.Name)
+			if e.Attr != "" {
+				fmt.Fprintf(os.Stderr, " (%s)", e.Attr)
+			}
+			fmt.Fprintf(os.Stderr, " is no longer present\n")
+		}
+		return nil
+	}
+	bf := baselineFile{Findings: []baselineEntry{}}
+	for _, e := range b.seen {
+		bf.Findings = append(bf.Findings, e)
+	}
+	sortBaselineEntries(bf.Findings)
+	data, err := json.MarshalIndent(&bf, "", "  ")
+	if err != nil {
+		return err
+	}
+	verb(1, "writing %d findings to baseline %s", len(bf.Findings), b.path)
+	return ioutil.WriteFile(b.path, append(data, '\n'), 0644)
+}
+
+func sortBaselineEntries(es []baselineEntry) {
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].Check != es[j].Check {
+			return es[i].Check < es[j].Check
+		}
+		if es[i].Name != es[j].Name {
+			return es[i].Name < es[j].Name
+		}
+		return es[i].Attr < es[j].Attr
+	})
+}
+
+// suppressed reports whether finding 'f' is to be left out of the
+// diagnostics, because the config file or the baseline says so.
+// Checks that print their findings themselves must consult it first.
+func suppressed(f *finding) bool {
+	// The baseline sees every finding, so that one the config also
+	// suppresses isn't taken to be fixed.
+	inBaseline := baseline != nil && baseline.isSuppressed(f)
+	return inBaseline || (config != nil && config.isSuppressed(f))
+}
+
+// report emits finding 'f' unless it is suppressed. Returns true if
+// it was emitted, in which case the check has failed.
+func report(f finding) bool {
+	if suppressed(&f) {
+		return false
+	}
+	warn("%s", f.msg)
+	return true
+}
+
+// reportf is report for a finding made at 'at', whose message is
+// given by 'format' and 'a'.
+func reportf(check, name, attr string, at site, format string, a ...interface{}) bool {
+	return report(finding{check: check, name: name, attr: attr, at: at, msg: fmt.Sprintf(format, a...)})
+}
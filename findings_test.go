@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBaseline(t *testing.T) {
+	defer func(b *findingBaseline) { baseline = b }(baseline)
+	path := filepath.Join(t.TempDir(), "baseline.json")
+
+	// Record two findings; in write mode they are still reported.
+	b, err := loadBaseline(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseline = b
+	if !reportf("odr", "struct S", "layout", site{}, "S at 0x%x", 0x10) {
+		t.Errorf("finding suppressed while writing baseline")
+	}
+	reportf("syms", "f", "size", site{}, "f at 0x%x", 0x1000)
+	if err := b.finish(false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same findings at different offsets are suppressed; new ones
+	// aren't.
+	b, err = loadBaseline(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseline = b
+	if reportf("odr", "struct S", "layout", site{}, "S at 0x%x", 0x20) {
+		t.Errorf("baseline finding reported")
+	}
+	if !reportf("odr", "struct T", "layout", site{}, "T at 0x%x", 0x30) {
+		t.Errorf("new finding suppressed")
+	}
+	if !reportf("syms", "f", "no symbol", site{}, "f at 0x%x", 0x1000) {
+		t.Errorf("finding for another attribute suppressed")
+	}
+	if b.suppressed != 1 {
+		t.Errorf("%d findings suppressed, want 1", b.suppressed)
+	}
+	var gone []string
+	for fp, e := range b.known {
+		if _, ok := b.seen[fp]; !ok {
+			gone = append(gone, e.Name)
+		}
+	}
+	if len(gone) != 1 || gone[0] != "f" {
+		t.Errorf("fixed findings %v, want [f]", gone)
+	}
+
+	if _, err := loadBaseline(filepath.Join(t.TempDir(), "missing.json"), false); err == nil {
+		t.Errorf("loading a missing baseline succeeded")
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/pe"
+	"fmt"
+	"reflect"
+)
+
+type goTypesCheckMode int
+
+const (
+	noGoTypesCheck  goTypesCheckMode = 0
+	yesGoTypesCheck goTypesCheckMode = 1
+)
+
+// Vendor attributes emitted by the Go linker for types.
+const (
+	dwAtGoKind        dwarf.Attr = 0x2900
+	dwAtGoKey         dwarf.Attr = 0x2901
+	dwAtGoElem        dwarf.Attr = 0x2902
+	dwAtGoRuntimeType dwarf.Attr = 0x2904
+)
+
+// dwLangGo is the DW_AT_language value for Go.
+const dwLangGo = 0x16
+
+// goTypeDescs describes where the Go runtime's type descriptors live:
+// the range [lo, hi) between runtime.types and runtime.etypes, and its
+// contents if they could be read. DW_AT_go_runtime_type is an offset
+// from runtime.types (or, before Go 1.21, the descriptor's address).
+type goTypeDescs struct {
+	lo, hi  uint64
+	data    []byte
+	ptrSize int
+}
+
+// kindOffset returns the offset of the kind byte in a type
+// descriptor (the Kind_ field of internal/abi.Type, which follows
+// two uintptrs, a uint32 hash and three bytes).
+func (td *goTypeDescs) kindOffset() uint64 {
+	return uint64(2*td.ptrSize + 7)
+}
+
+// goKindFitsTag reports whether a DIE with tag 'tag' may carry
+// DW_AT_go_kind 'kind'. Kind 0 marks types the linker synthesizes,
+// such as the pointed-to structs of maps and channels.
+func goKindFitsTag(tag dwarf.Tag, kind reflect.Kind) bool {
+	switch tag {
+	case dwarf.TagBaseType:
+		return kind >= reflect.Bool && kind <= reflect.Complex128
+	case dwarf.TagArrayType:
+		return kind == reflect.Array
+	case dwarf.TagPointerType:
+		return kind == reflect.Invalid || kind == reflect.Ptr || kind == reflect.UnsafePointer
+	case dwarf.TagStructType:
+		return kind == reflect.Invalid || kind == reflect.Slice || kind == reflect.String || kind == reflect.Struct
+	case dwarf.TagSubroutineType:
+		return kind == reflect.Func
+	case dwarf.TagTypedef:
+		return kind == reflect.Chan || kind == reflect.Interface || kind == reflect.Map
+	}
+	return false
+}
+
+// goKindRequired reports whether a Go type DIE must have
+// DW_AT_go_kind. Named types are typedefs, which only have a kind for
+// channels, interfaces and maps; unsafe.Pointer, and types defined
+// as it, are pointer DIEs with no DW_AT_type and no kind.
+func goKindRequired(tag dwarf.Tag, bare bool) bool {
+	switch tag {
+	case dwarf.TagBaseType, dwarf.TagArrayType, dwarf.TagStructType, dwarf.TagSubroutineType:
+		return true
+	case dwarf.TagPointerType:
+		return !bare
+	}
+	return false
+}
+
+// goMember is a member of a slice or string struct.
+type goMember struct {
+	name string
+	typ  dwarf.Offset
+}
+
+// goType is a Go type DIE whose references are checked once all DIEs
+// have been read.
+type goType struct {
+	off     dwarf.Offset
+	name    string
+	kind    reflect.Kind
+	elem    dwarf.Offset
+	key     dwarf.Offset
+	members []goMember
+}
+
+func (t *goType) String() string {
+	return fmt.Sprintf("type %q at 0x%x", t.name, t.off)
+}
+
+// checkGoTypeDIEs checks the Go vendor attributes of the type DIEs in
+// every Go CU of 'd', with 'td' locating the runtime type descriptors
+// (td.hi is zero if they weren't found). Returns the problems found,
+// each attributed to a type and attribute, and the number of types
+// checked.
+func checkGoTypeDIEs(d *dwarf.Data, td *goTypeDescs) ([]finding, int, error) {
+	var probs []finding
+	problem := func(t *goType, attr string, format string, args ...interface{}) {
+		probs = append(probs, finding{check: "gotypes", name: t.name, attr: attr,
+			at: site{dies: []dwarf.Offset{t.off}}, msg: fmt.Sprintf(format, args...)})
+	}
+	isType := make(map[dwarf.Offset]bool)
+	ptrTo := make(map[dwarf.Offset]dwarf.Offset)
+	var types []*goType
+	var cur *goType // slice or string struct whose members are being read
+	ntypes := 0
+	rdr := d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return nil, 0, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag == dwarf.TagCompileUnit {
+			if lang, _ := ent.Val(dwarf.AttrLanguage).(int64); lang != dwLangGo {
+				rdr.SkipChildren()
+			}
+			continue
+		}
+		if ent.Tag == dwarf.TagMember && cur != nil {
+			typ, _ := ent.Val(dwarf.AttrType).(dwarf.Offset)
+			name, _ := ent.Val(dwarf.AttrName).(string)
+			cur.members = append(cur.members, goMember{name: name, typ: typ})
+			continue
+		}
+		cur = nil
+		if !isIndexTypeTag(ent.Tag) {
+			continue
+		}
+		isType[ent.Offset] = true
+		ntypes++
+		t := &goType{off: ent.Offset}
+		t.name, _ = ent.Val(dwarf.AttrName).(string)
+		to, hasType := ent.Val(dwarf.AttrType).(dwarf.Offset)
+		if ent.Tag == dwarf.TagPointerType && hasType {
+			ptrTo[ent.Offset] = to
+		}
+
+		kv := ent.Val(dwAtGoKind)
+		kind, hasKind := kv.(int64)
+		switch {
+		case kv == nil:
+			if goKindRequired(ent.Tag, !hasType) {
+				problem(t, "DW_AT_go_kind", "%v (%v) has no DW_AT_go_kind", t, ent.Tag)
+			}
+		case !hasKind:
+			problem(t, "DW_AT_go_kind", "%v has DW_AT_go_kind of class %v", t, ent.AttrField(dwAtGoKind).Class)
+		case kind < 0 || kind > int64(reflect.UnsafePointer):
+			problem(t, "DW_AT_go_kind", "%v has invalid DW_AT_go_kind %d", t, kind)
+			hasKind = false
+		case !goKindFitsTag(ent.Tag, reflect.Kind(kind)):
+			problem(t, "DW_AT_go_kind", "%v is a %v with DW_AT_go_kind %d (%v)", t, ent.Tag, kind, reflect.Kind(kind))
+		}
+		if hasKind {
+			t.kind = reflect.Kind(kind)
+		}
+
+		for _, a := range []dwarf.Attr{dwAtGoElem, dwAtGoKey} {
+			v := ent.Val(a)
+			if v == nil {
+				continue
+			}
+			ref, ok := v.(dwarf.Offset)
+			if !ok {
+				problem(t, goAttrName(a), "%v has %s of class %v", t, goAttrName(a), ent.AttrField(a).Class)
+				continue
+			}
+			if a == dwAtGoElem {
+				t.elem = ref
+			} else {
+				t.key = ref
+			}
+		}
+		switch t.kind {
+		case reflect.Slice, reflect.Chan, reflect.Map:
+			if t.elem == 0 {
+				problem(t, "DW_AT_go_elem", "%v of kind %v has no DW_AT_go_elem", t, t.kind)
+			}
+		}
+		if t.kind == reflect.Map && t.key == 0 {
+			problem(t, "DW_AT_go_key", "%v of kind map has no DW_AT_go_key", t)
+		}
+
+		var rt uint64
+		switch v := ent.Val(dwAtGoRuntimeType).(type) {
+		case uint64:
+			rt = v
+		case int64:
+			rt = uint64(v)
+		case nil:
+		default:
+			problem(t, "DW_AT_go_runtime_type", "%v has DW_AT_go_runtime_type of class %v", t, ent.AttrField(dwAtGoRuntimeType).Class)
+		}
+		if rt != 0 && td.hi != 0 {
+			checkGoRuntimeType(t, rt, td, problem)
+		}
+
+		types = append(types, t)
+		if t.kind == reflect.Slice || t.kind == reflect.String {
+			cur = t
+		}
+	}
+
+	for _, t := range types {
+		for _, ref := range []struct {
+			a   dwarf.Attr
+			off dwarf.Offset
+		}{{dwAtGoElem, t.elem}, {dwAtGoKey, t.key}} {
+			if ref.off != 0 && !isType[ref.off] {
+				problem(t, goAttrName(ref.a), "%v: %s refers to 0x%x, which is not a Go type DIE", t, goAttrName(ref.a), ref.off)
+			}
+		}
+		switch t.kind {
+		case reflect.Slice:
+			if !goMembersNamed(t.members, "array", "len", "cap") {
+				problem(t, "members", "%v of kind slice has members %s, want array, len, cap", t, goMemberNames(t.members))
+			} else if to, ok := ptrTo[t.members[0].typ]; t.elem != 0 && (!ok || to != t.elem) {
+				problem(t, "members", "%v: member array is not a pointer to DW_AT_go_elem 0x%x", t, t.elem)
+			}
+		case reflect.String:
+			if !goMembersNamed(t.members, "str", "len") {
+				problem(t, "members", "%v of kind string has members %s, want str, len", t, goMemberNames(t.members))
+			}
+		}
+	}
+	return probs, ntypes, nil
+}
+
+// checkGoRuntimeType checks that the DW_AT_go_runtime_type value 'rt'
+// of type 't' falls within the type descriptors, and that the
+// descriptor's kind agrees with DW_AT_go_kind.
+func checkGoRuntimeType(t *goType, rt uint64, td *goTypeDescs, problem func(*goType, string, string, ...interface{})) {
+	var off uint64
+	switch {
+	case rt < td.hi-td.lo:
+		off = rt
+	case rt >= td.lo && rt < td.hi:
+		off = rt - td.lo
+	default:
+		problem(t, "DW_AT_go_runtime_type", "%v: DW_AT_go_runtime_type 0x%x is outside the type descriptors [0x%x,0x%x)",
+			t, rt, td.lo, td.hi)
+		return
+	}
+	k := off + td.kindOffset()
+	if t.kind == reflect.Invalid || k >= uint64(len(td.data)) {
+		return
+	}
+	// The low five bits of Kind_ are the kind; the rest are flags.
+	if dk := reflect.Kind(td.data[k] & 0x1f); dk != t.kind {
+		problem(t, "DW_AT_go_runtime_type", "%v: runtime type descriptor at offset 0x%x has kind %v, but DW_AT_go_kind is %v",
+			t, off, dk, t.kind)
+	}
+}
+
+func goAttrName(a dwarf.Attr) string {
+	switch a {
+	case dwAtGoElem:
+		return "DW_AT_go_elem"
+	case dwAtGoKey:
+		return "DW_AT_go_key"
+	}
+	return a.String()
+}
+
+func goMembersNamed(ms []goMember, names ...string) bool {
+	if len(ms) != len(names) {
+		return false
+	}
+	for i, m := range ms {
+		if m.name != names[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func goMemberNames(ms []goMember) string {
+	s := "["
+	for i, m := range ms {
+		if i > 0 {
+			s += " "
+		}
+		s += m.name
+	}
+	return s + "]"
+}
+
+// findGoTypeDescs locates the Go type descriptors using the
+// runtime.types and runtime.etypes symbols, falling back to the
+// .go.type section (__go_type on Mach-O). Returns hi == 0 if they
+// can't be found.
+func findGoTypeDescs(of *objFile) *goTypeDescs {
+	td := &goTypeDescs{ptrSize: of.addrSize()}
+	var types, etypes uint64
+	switch {
+	case of.ef != nil:
+		if syms, err := of.ef.Symbols(); err == nil {
+			for _, s := range syms {
+				switch s.Name {
+				case "runtime.types":
+					types = s.Value
+				case "runtime.etypes":
+					etypes = s.Value
+				}
+			}
+		}
+		if s := of.ef.Section(".go.type"); s != nil && etypes == 0 {
+			types, etypes = s.Addr, s.Addr+s.Size
+		}
+	case of.mf != nil:
+		if of.mf.Symtab != nil {
+			for _, s := range of.mf.Symtab.Syms {
+				switch s.Name {
+				case "runtime.types":
+					types = s.Value
+				case "runtime.etypes":
+					etypes = s.Value
+				}
+			}
+		}
+		if s := of.mf.Section("__go_type"); s != nil && etypes == 0 {
+			types, etypes = s.Addr, s.Addr+s.Size
+		}
+	case of.pf != nil:
+		var base uint64
+		switch oh := of.pf.OptionalHeader.(type) {
+		case *pe.OptionalHeader32:
+			base = uint64(oh.ImageBase)
+		case *pe.OptionalHeader64:
+			base = oh.ImageBase
+		}
+		for _, s := range of.pf.Symbols {
+			if s.SectionNumber <= 0 || int(s.SectionNumber) > len(of.pf.Sections) {
+				continue
+			}
+			addr := base + uint64(of.pf.Sections[s.SectionNumber-1].VirtualAddress) + uint64(s.Value)
+			switch s.Name {
+			case "runtime.types":
+				types = addr
+			case "runtime.etypes":
+				etypes = addr
+			}
+		}
+	}
+	if etypes <= types {
+		return td
+	}
+	td.lo, td.hi = types, etypes
+	td.data = of.codeBytes(types, etypes)
+	return td
+}
+
+// checkGoTypes checks the Go vendor attributes on the types of Go
+// CUs: that DW_AT_go_kind is present and consistent with the tag and
+// layout, that DW_AT_go_elem and DW_AT_go_key refer to types, and
+// that DW_AT_go_runtime_type refers to a type descriptor of the same
+// kind. Returns false if problems were found.
+func checkGoTypes(of *objFile, d *dwarf.Data) (bool, error) {
+	td := findGoTypeDescs(of)
+	if td.hi == 0 {
+		verb(1, "Go type descriptors not found; not checking DW_AT_go_runtime_type")
+	} else if td.data == nil {
+		verb(1, "Go type descriptors [0x%x,0x%x) have no contents; not checking their kinds", td.lo, td.hi)
+	}
+	probs, n, err := checkGoTypeDIEs(d, td)
+	if err != nil {
+		return false, err
+	}
+	ok := true
+	for _, p := range probs {
+		if report(p) {
+			ok = false
+		}
+	}
+	verb(1, "checked %d Go types: %d problems", n, len(probs))
+	return ok, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"debug/dwarf"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGoKindFitsTag(t *testing.T) {
+	tests := []struct {
+		tag  dwarf.Tag
+		kind reflect.Kind
+		want bool
+	}{
+		{dwarf.TagBaseType, reflect.Int, true},
+		{dwarf.TagBaseType, reflect.String, false},
+		{dwarf.TagStructType, reflect.Slice, true},
+		{dwarf.TagStructType, reflect.Invalid, true},
+		{dwarf.TagPointerType, reflect.UnsafePointer, true},
+		{dwarf.TagTypedef, reflect.Map, true},
+		{dwarf.TagTypedef, reflect.Struct, false},
+		{dwarf.TagSubroutineType, reflect.Func, true},
+		{dwarf.TagArrayType, reflect.Slice, false},
+	}
+	for _, tc := range tests {
+		if got := goKindFitsTag(tc.tag, tc.kind); got != tc.want {
+			t.Errorf("goKindFitsTag(%v, %v) = %v, want %v", tc.tag, tc.kind, got, tc.want)
+		}
+	}
+}
+
+func TestCheckGoTypes(t *testing.T) {
+	exe := buildSelf(t, t.TempDir(), noExtra)
+	of, d := loadObj(t, exe)
+	if ok, err := checkGoTypes(of, d); err != nil || !ok {
+		t.Errorf("checkGoTypes = %v, %v", ok, err)
+	}
+
+	td := findGoTypeDescs(of)
+	if td.hi == 0 || td.data == nil {
+		t.Fatalf("type descriptors not found: %+v", td)
+	}
+
+	// With the descriptors' kind bytes clobbered, every type with a
+	// runtime type disagrees.
+	bad := *td
+	bad.data = make([]byte, len(td.data))
+	probs, _, err := checkGoTypeDIEs(d, &bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(probs) == 0 || !strings.Contains(probs[0].msg, "runtime type descriptor at offset") {
+		t.Errorf("with zeroed descriptors got %d problems: %v", len(probs), probs)
+	}
+
+	// A descriptor range that's too small leaves runtime types outside it.
+	bad = *td
+	bad.hi = bad.lo + 8
+	bad.data = nil
+	probs, _, err = checkGoTypeDIEs(d, &bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(probs) == 0 || !strings.Contains(probs[0].msg, "is outside the type descriptors") {
+		t.Errorf("with truncated descriptors got %d problems: %v", len(probs), probs)
+	}
+}
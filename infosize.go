@@ -0,0 +1,289 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"sort"
+)
+
+// isTypeDefTag returns true for DIE tags that define types.
+func isTypeDefTag(t dwarf.Tag) bool {
+	switch t {
+	case dwarf.TagArrayType, dwarf.TagBaseType, dwarf.TagClassType,
+		dwarf.TagConstType, dwarf.TagEnumerationType, dwarf.TagPointerType,
+		dwarf.TagPtrToMemberType, dwarf.TagReferenceType,
+		dwarf.TagRvalueReferenceType, dwarf.TagRestrictType,
+		dwarf.TagStructType, dwarf.TagSubrangeType, dwarf.TagSubroutineType,
+		dwarf.TagTypedef, dwarf.TagUnionType, dwarf.TagUnspecifiedType,
+		dwarf.TagVolatileType, dwarf.TagAtomicType:
+		return true
+	}
+	return false
+}
+
+// sizeBucket accumulates a byte count and number of items.
+type sizeBucket struct {
+	name  string
+	bytes int64
+	count int
+}
+
+// typeTree tracks the outermost type definition DIE currently being
+// visited, so that the bytes of its entire subtree can be attributed
+// to it and its structure hashed.
+type typeTree struct {
+	name  string
+	cu    int
+	start int64
+	depth int
+	h     hash.Hash64
+}
+
+// infoAttribution is the result of attributing .debug_info bytes.
+type infoAttribution struct {
+	total    int64
+	byCU     []*sizeBucket
+	byTag    []*sizeBucket
+	byType   []*sizeBucket
+	dupBytes int64 // bytes in type trees identical to one in another CU
+	dupTrees int   // number of such redundant copies
+	dupTypes int   // number of distinct types with redundant copies
+}
+
+// typeTreeGroup collects the copies of a structurally identical type
+// tree, by CU.
+type typeTreeGroup struct {
+	cus   map[int]bool
+	sizes []int64
+}
+
+// shortName truncates long (typically anonymous struct) names for
+// tabular output.
+func shortName(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	return name[:max-3] + "..."
+}
+
+func sortBuckets(m map[string]*sizeBucket) []*sizeBucket {
+	rv := make([]*sizeBucket, 0, len(m))
+	for _, b := range m {
+		rv = append(rv, b)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].bytes != rv[j].bytes {
+			return rv[i].bytes > rv[j].bytes
+		}
+		return rv[i].name < rv[j].name
+	})
+	return rv
+}
+
+// hashEntry feeds a DIE's tag and attributes into h. Reference
+// attributes are hashed by the name of the DIE they point to (CU
+// relative offsets differ between otherwise identical copies), and
+// declaration coordinates are skipped since file indices are CU
+// specific.
+func hashEntry(h hash.Hash64, ent *dwarf.Entry, depth int, names map[dwarf.Offset]string) {
+	fmt.Fprintf(h, "%d:%v", depth, ent.Tag)
+	for _, f := range ent.Field {
+		switch f.Attr {
+		case dwarf.AttrSibling, dwarf.AttrDeclFile, dwarf.AttrDeclLine, dwarf.AttrDeclColumn:
+			continue
+		}
+		if f.Class == dwarf.ClassReference {
+			if off, ok := f.Val.(dwarf.Offset); ok {
+				fmt.Fprintf(h, "|%v=>%s", f.Attr, names[off])
+				continue
+			}
+		}
+		fmt.Fprintf(h, "|%v=%v", f.Attr, f.Val)
+	}
+	h.Write([]byte{'\n'})
+}
+
+// attributeInfo walks every DIE, charging each DIE's encoded bytes to
+// its tag, each unit's bytes to its CU name, and the bytes of each
+// outermost type definition subtree to that type's name.
+func attributeInfo(d *dwarf.Data, units []unitHeader) (*infoAttribution, error) {
+	// First pass: record DIE names, so that references can be hashed
+	// symbolically.
+	names := make(map[dwarf.Offset]string)
+	rdr := d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		if name, ok := ent.Val(dwarf.AttrName).(string); ok {
+			names[ent.Offset] = name
+		}
+	}
+
+	ia := &infoAttribution{}
+	cus := make(map[string]*sizeBucket)
+	tags := make(map[string]*sizeBucket)
+	types := make(map[string]*sizeBucket)
+	groups := make(map[uint64]*typeTreeGroup)
+	for _, u := range units {
+		ia.total += u.end - u.off
+	}
+
+	ui := -1
+	depth := 0
+	var tt *typeTree
+	var pendOff int64 = -1
+	var pendTag dwarf.Tag
+
+	// finish closes out the pending DIE and (if we've left its
+	// subtree) the current type tree, now that the next DIE is
+	// known to begin at 'next'.
+	finish := func(next int64) {
+		if pendOff >= 0 {
+			tn := pendTag.String()
+			b := tags[tn]
+			if b == nil {
+				b = &sizeBucket{name: tn}
+				tags[tn] = b
+			}
+			b.bytes += next - pendOff
+			b.count++
+			pendOff = -1
+		}
+		if tt != nil && depth <= tt.depth {
+			sz := next - tt.start
+			b := types[tt.name]
+			if b == nil {
+				b = &sizeBucket{name: tt.name}
+				types[tt.name] = b
+			}
+			b.bytes += sz
+			b.count++
+			g := groups[tt.h.Sum64()]
+			if g == nil {
+				g = &typeTreeGroup{cus: make(map[int]bool)}
+				groups[tt.h.Sum64()] = g
+			}
+			g.cus[tt.cu] = true
+			g.sizes = append(g.sizes, sz)
+			tt = nil
+		}
+	}
+
+	rdr = d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag == 0 {
+			depth--
+			continue
+		}
+		off := int64(ent.Offset)
+		if ui < 0 || off >= units[ui].end {
+			// Moving to a new unit; close out the previous one.
+			if ui >= 0 {
+				depth = 0
+				finish(units[ui].end)
+			}
+			for ui++; ui < len(units) && off >= units[ui].end; ui++ {
+			}
+			if ui >= len(units) {
+				return nil, fmt.Errorf("DIE at offset 0x%x lies outside any unit", off)
+			}
+			name, _ := ent.Val(dwarf.AttrName).(string)
+			b := cus[name]
+			if b == nil {
+				b = &sizeBucket{name: name}
+				cus[name] = b
+			}
+			b.bytes += units[ui].end - units[ui].off
+			b.count++
+		}
+		finish(off)
+		pendOff, pendTag = off, ent.Tag
+		if tt == nil && isTypeDefTag(ent.Tag) {
+			name, ok := ent.Val(dwarf.AttrName).(string)
+			if !ok {
+				name = "<anonymous " + ent.Tag.String() + ">"
+			}
+			tt = &typeTree{name: name, cu: ui, start: off, depth: depth, h: fnv.New64a()}
+		}
+		if tt != nil {
+			hashEntry(tt.h, ent, depth-tt.depth, names)
+		}
+		if ent.Children {
+			depth++
+		}
+	}
+	if ui >= 0 {
+		depth = 0
+		finish(units[ui].end)
+	}
+
+	for _, g := range groups {
+		if len(g.cus) < 2 {
+			continue
+		}
+		ia.dupTypes++
+		for _, sz := range g.sizes[1:] {
+			ia.dupBytes += sz
+			ia.dupTrees++
+		}
+	}
+	ia.byCU = sortBuckets(cus)
+	ia.byTag = sortBuckets(tags)
+	ia.byType = sortBuckets(types)
+	return ia, nil
+}
+
+// dumpInfoAttribution prints the .debug_info attribution tables,
+// showing at most 'max' rows per table (all rows if zero).
+func dumpInfoAttribution(of *objFile, d *dwarf.Data, max int) error {
+	info, err := of.sectionData(".debug_info")
+	if err != nil {
+		return err
+	}
+	units, err := parseUnitHeaders(info, of.byteOrder(), false)
+	if err != nil {
+		return err
+	}
+	ia, err := attributeInfo(d, units)
+	if err != nil {
+		return err
+	}
+	perc := func(v int64) string {
+		if ia.total == 0 {
+			return "0%"
+		}
+		return fmt.Sprintf("%2.2f%%", float64(v)/float64(ia.total)*100.0)
+	}
+	table := func(title, what string, bs []*sizeBucket) {
+		fmt.Printf("%s:\n", title)
+		for i, b := range bs {
+			if max > 0 && i >= max {
+				fmt.Printf("  ... %d more\n", len(bs)-i)
+				break
+			}
+			fmt.Printf("  %-40s %10d bytes %7s %6d %s\n",
+				shortName(b.name, 60), b.bytes, perc(b.bytes), b.count, what)
+		}
+	}
+	fmt.Printf(".debug_info: %d bytes\n", ia.total)
+	table(".debug_info by compilation unit", "CUs", ia.byCU)
+	table(".debug_info by DIE tag", "DIEs", ia.byTag)
+	table(".debug_info by type definition", "defs", ia.byType)
+	fmt.Printf("duplicated type trees: %d bytes (%s) in %d redundant copies of %d types\n",
+		ia.dupBytes, perc(ia.dupBytes), ia.dupTrees, ia.dupTypes)
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestInfoAttribution(t *testing.T) {
+	exe := buildSelf(t, t.TempDir(), noExtra)
+	of, d := loadObj(t, exe)
+	info, err := of.sectionData(".debug_info")
+	if err != nil || info == nil {
+		t.Fatalf("reading .debug_info: %v", err)
+	}
+	units, err := parseUnitHeaders(info, of.byteOrder(), false)
+	if err != nil {
+		t.Fatalf("parseUnitHeaders: %v", err)
+	}
+	ia, err := attributeInfo(d, units)
+	if err != nil {
+		t.Fatalf("attributeInfo: %v", err)
+	}
+	if ia.total != int64(len(info)) {
+		t.Errorf("total %d does not match .debug_info size %d", ia.total, len(info))
+	}
+
+	// Every byte should be charged to exactly one CU, and every
+	// byte outside of unit headers to exactly one DIE tag.
+	cuTot := int64(0)
+	for _, b := range ia.byCU {
+		cuTot += b.bytes
+	}
+	if cuTot != ia.total {
+		t.Errorf("CU bytes %d, want %d", cuTot, ia.total)
+	}
+	tagTot := int64(0)
+	for _, b := range ia.byTag {
+		tagTot += b.bytes
+	}
+	for _, u := range units {
+		tagTot += u.dieOff - u.off
+	}
+	if tagTot != ia.total {
+		t.Errorf("tag bytes plus headers %d, want %d", tagTot, ia.total)
+	}
+	if len(ia.byType) == 0 {
+		t.Errorf("no type definitions found")
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"sort"
+)
+
+type inlinesMode int
+
+const (
+	noInlines  inlinesMode = 0
+	yesInlines inlinesMode = 1
+)
+
+// inlineSitesShown is the number of call sites listed per callee.
+const inlineSitesShown = 5
+
+// inlineSite is a source position at which a callee was inlined.
+type inlineSite struct {
+	file string
+	line int64
+}
+
+func (s inlineSite) String() string {
+	if s.file == "" {
+		return fmt.Sprintf("?:%d", s.line)
+	}
+	return fmt.Sprintf("%s:%d", s.file, s.line)
+}
+
+// inlinedCallee summarizes the inlined copies of one function.
+type inlinedCallee struct {
+	name     string
+	count    int
+	bytes    uint64
+	maxDepth int
+	sites    map[inlineSite]int
+}
+
+// sortedSites returns the callee's call sites, most frequent first.
+func (ic *inlinedCallee) sortedSites() []inlineSite {
+	rv := make([]inlineSite, 0, len(ic.sites))
+	for s := range ic.sites {
+		rv = append(rv, s)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		if ic.sites[rv[i]] != ic.sites[rv[j]] {
+			return ic.sites[rv[i]] > ic.sites[rv[j]]
+		}
+		if rv[i].file != rv[j].file {
+			return rv[i].file < rv[j].file
+		}
+		return rv[i].line < rv[j].line
+	})
+	return rv
+}
+
+// inlineReport is the result of walking the inlined subroutines of a
+// program.
+type inlineReport struct {
+	callees  []*inlinedCallee // sorted by count, then bytes
+	total    int
+	bytes    uint64
+	maxDepth int
+}
+
+// originName returns the name of the function that the DIE at 'off'
+// describes, following DW_AT_abstract_origin and DW_AT_specification.
+func originName(d *dwarf.Data, off dwarf.Offset, cache map[dwarf.Offset]string) string {
+	if name, ok := cache[off]; ok {
+		return name
+	}
+	name := fmt.Sprintf("<unknown at 0x%x>", off)
+	rdr := d.Reader()
+	cur := off
+	for i := 0; i < 8; i++ {
+		rdr.Seek(cur)
+		ent, err := rdr.Next()
+		if err != nil || ent == nil {
+			break
+		}
+		if n, ok := ent.Val(dwarf.AttrName).(string); ok {
+			name = n
+			break
+		}
+		if o, ok := ent.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset); ok {
+			cur = o
+		} else if o, ok := ent.Val(dwarf.AttrSpecification).(dwarf.Offset); ok {
+			cur = o
+		} else {
+			break
+		}
+	}
+	cache[off] = name
+	return name
+}
+
+// collectInlines walks the DW_TAG_inlined_subroutine DIEs in 'd' and
+// summarizes them per callee. The depth of an inlined copy is the
+// number of inlined subroutines enclosing it, plus one.
+func collectInlines(d *dwarf.Data) (*inlineReport, error) {
+	byOrigin := make(map[string]*inlinedCallee)
+	names := make(map[dwarf.Offset]string)
+	rep := &inlineReport{}
+	var files []*dwarf.LineFile
+	// For each open DIE with children, whether it is an inlined
+	// subroutine.
+	var stack []bool
+	depth := 0
+	rdr := d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag == 0 {
+			if n := len(stack); n > 0 {
+				if stack[n-1] {
+					depth--
+				}
+				stack = stack[:n-1]
+			}
+			continue
+		}
+		if ent.Tag == dwarf.TagCompileUnit {
+			files = nil
+			lr, err := d.LineReader(ent)
+			if err != nil {
+				return nil, err
+			}
+			if lr != nil {
+				files = lr.Files()
+			}
+		}
+		inl := ent.Tag == dwarf.TagInlinedSubroutine
+		if inl {
+			depth++
+			origin, _ := ent.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+			name := originName(d, origin, names)
+			ic := byOrigin[name]
+			if ic == nil {
+				ic = &inlinedCallee{name: name, sites: make(map[inlineSite]int)}
+				byOrigin[name] = ic
+			}
+			ic.count++
+			if depth > ic.maxDepth {
+				ic.maxDepth = depth
+			}
+			var site inlineSite
+			if f, ok := ent.Val(dwarf.AttrCallFile).(int64); ok && f >= 0 && f < int64(len(files)) && files[f] != nil {
+				site.file = files[f].Name
+			}
+			site.line, _ = ent.Val(dwarf.AttrCallLine).(int64)
+			ic.sites[site]++
+			ranges, err := d.Ranges(ent)
+			if err != nil {
+				return nil, fmt.Errorf("inlined subroutine at 0x%x: %v", ent.Offset, err)
+			}
+			for _, r := range ranges {
+				if r[1] > r[0] {
+					ic.bytes += r[1] - r[0]
+				}
+			}
+		}
+		if ent.Children {
+			stack = append(stack, inl)
+		} else if inl {
+			depth--
+		}
+	}
+	for _, ic := range byOrigin {
+		rep.callees = append(rep.callees, ic)
+		rep.total += ic.count
+		rep.bytes += ic.bytes
+		if ic.maxDepth > rep.maxDepth {
+			rep.maxDepth = ic.maxDepth
+		}
+	}
+	sort.Slice(rep.callees, func(i, j int) bool {
+		a, b := rep.callees[i], rep.callees[j]
+		if a.count != b.count {
+			return a.count > b.count
+		}
+		if a.bytes != b.bytes {
+			return a.bytes > b.bytes
+		}
+		return a.name < b.name
+	})
+	return rep, nil
+}
+
+// dumpInlines prints the 'max' most frequently inlined functions (or
+// all of them if 'max' is zero), with their most common call sites.
+func dumpInlines(d *dwarf.Data, max int) error {
+	rep, err := collectInlines(d)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d inlined calls of %d functions, %d bytes of inlined code, maximum depth %d\n",
+		rep.total, len(rep.callees), rep.bytes, rep.maxDepth)
+	for i, ic := range rep.callees {
+		if max > 0 && i >= max {
+			break
+		}
+		fmt.Printf("%s: inlined %d times, %d bytes, maximum depth %d\n",
+			ic.name, ic.count, ic.bytes, ic.maxDepth)
+		sites := ic.sortedSites()
+		for j, s := range sites {
+			if j == inlineSitesShown {
+				fmt.Printf("    ... and %d more call sites\n", len(sites)-j)
+				break
+			}
+			fmt.Printf("    %s (%d)\n", s, ic.sites[s])
+		}
+	}
+	return nil
+}
+
+// inlineTrees maps the name of each function with code to its inline
+// tree, as the number of inlined copies at each path of callee names
+// (outermost first, separated by " > ").
+type inlineTrees map[string]map[string]int
+
+// collectInlineTrees returns the inline tree of every function in 'd'.
+func collectInlineTrees(d *dwarf.Data) (inlineTrees, error) {
+	trees := make(inlineTrees)
+	names := make(map[dwarf.Offset]string)
+	// For each open DIE with children, the function and inline path
+	// that DIEs within it belong to.
+	type frame struct {
+		fn   string
+		path string
+	}
+	var stack []frame
+	rdr := d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag == 0 {
+			if n := len(stack); n > 0 {
+				stack = stack[:n-1]
+			}
+			continue
+		}
+		var cur frame
+		if n := len(stack); n > 0 {
+			cur = stack[n-1]
+		}
+		switch ent.Tag {
+		case dwarf.TagCompileUnit:
+			cur = frame{}
+		case dwarf.TagSubprogram:
+			cur = frame{}
+			if ent.Val(dwarf.AttrLowpc) != nil || ent.Val(dwarf.AttrRanges) != nil {
+				cur.fn = originName(d, ent.Offset, names)
+				if trees[cur.fn] == nil {
+					trees[cur.fn] = make(map[string]int)
+				}
+			}
+		case dwarf.TagInlinedSubroutine:
+			if cur.fn == "" {
+				break
+			}
+			origin, _ := ent.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+			callee := originName(d, origin, names)
+			if cur.path == "" {
+				cur.path = callee
+			} else {
+				cur.path += " > " + callee
+			}
+			trees[cur.fn][cur.path]++
+		}
+		if ent.Children {
+			stack = append(stack, cur)
+		}
+	}
+	return trees, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestInlines(t *testing.T) {
+	// main.warn is only inlined with the more aggressive inliner.
+	exe := buildSelf(t, t.TempDir(), moreInlExtra)
+	rep, err := collectInlines(loadDwarf(t, exe))
+	if err != nil {
+		t.Fatalf("collectInlines: %v", err)
+	}
+	if rep.maxDepth < 3 {
+		t.Errorf("maximum inline depth %d, want at least 3", rep.maxDepth)
+	}
+	total := 0
+	var warn *inlinedCallee
+	for _, ic := range rep.callees {
+		total += ic.count
+		if ic.name == "main.warn" {
+			warn = ic
+		}
+	}
+	if total != rep.total {
+		t.Errorf("callee counts sum to %d, total is %d", total, rep.total)
+	}
+	if warn == nil {
+		t.Fatalf("main.warn was not reported as inlined")
+	}
+	if warn.bytes == 0 {
+		t.Errorf("main.warn: no code bytes attributed to inlined copies")
+	}
+	n := 0
+	for s, c := range warn.sites {
+		if filepath.Ext(s.file) != ".go" || s.line <= 0 {
+			t.Errorf("main.warn: bad call site %v", s)
+		}
+		n += c
+	}
+	if n != warn.count {
+		t.Errorf("main.warn: call site counts sum to %d, want %d", n, warn.count)
+	}
+}
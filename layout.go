@@ -0,0 +1,260 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"sort"
+)
+
+type layoutMode int
+
+const (
+	noLayout  layoutMode = 0
+	yesLayout layoutMode = 1
+)
+
+// layoutHole describes a run of unused bytes within a struct, either
+// between two members or (if 'after' is the last member) at the end.
+type layoutHole struct {
+	after  string // name of member preceding the hole
+	offset int64
+	size   int64
+}
+
+// structLayout holds the padding/hole summary for a single named
+// struct type, along with the number of CUs that define it.
+type structLayout struct {
+	name    string
+	size    int64
+	holes   []layoutHole
+	tailPad int64
+	cus     int
+}
+
+func (sl *structLayout) wasted() int64 {
+	tot := sl.tailPad
+	for _, h := range sl.holes {
+		tot += h.size
+	}
+	return tot
+}
+
+// score is the metric used to rank offenders: bytes wasted in a
+// single instance multiplied by the number of CUs defining the type.
+func (sl *structLayout) score() int64 {
+	return sl.wasted() * int64(sl.cus)
+}
+
+// fieldExtent returns the byte range [start,end) occupied by a
+// struct member. Bit fields are rounded out to whole bytes; for
+// older-style bit fields, which have DW_AT_bit_offset ('bitOffset')
+// and only give a storage unit, the entire storage unit is treated
+// as occupied.
+func fieldExtent(f *dwarf.StructField, bitOffset bool) (int64, int64) {
+	if f.BitSize != 0 && !bitOffset {
+		bstart := f.ByteOffset*8 + f.DataBitOffset
+		bend := bstart + f.BitSize
+		return bstart / 8, (bend + 7) / 8
+	}
+	sz := f.ByteSize
+	if sz == 0 && f.Type != nil {
+		sz = f.Type.Size()
+	}
+	if sz < 0 {
+		sz = 0
+	}
+	return f.ByteOffset, f.ByteOffset + sz
+}
+
+// computeStructLayout walks the members of a struct type, along with
+// its base class subobjects 'bases', in offset order and records any
+// internal holes and tail padding. 'bitOffset' holds the members that
+// have DW_AT_bit_offset.
+func computeStructLayout(st *dwarf.StructType, bases []*dwarf.StructField, bitOffset map[*dwarf.StructField]bool) *structLayout {
+	sl := &structLayout{name: st.StructName, size: st.ByteSize}
+	fields := append(append([]*dwarf.StructField(nil), bases...), st.Field...)
+	sort.SliceStable(fields, func(i, j int) bool {
+		si, _ := fieldExtent(fields[i], bitOffset[fields[i]])
+		sj, _ := fieldExtent(fields[j], bitOffset[fields[j]])
+		return si < sj
+	})
+	end := int64(0)
+	prev := ""
+	for _, f := range fields {
+		start, fend := fieldExtent(f, bitOffset[f])
+		if start > end && prev != "" {
+			sl.holes = append(sl.holes, layoutHole{after: prev, offset: end, size: start - end})
+		}
+		if fend > end {
+			end = fend
+		}
+		prev = f.Name
+	}
+	if sl.size > end {
+		sl.tailPad = sl.size - end
+	}
+	return sl
+}
+
+// structBases returns the base class subobjects of the struct or
+// class type 'st' at 'off', as pseudo-members named after the base,
+// since dwarf.StructType leaves out DW_TAG_inheritance. An empty base
+// takes up no space. It also returns the members of 'st' that have
+// DW_AT_bit_offset, which dwarf.StructField doesn't tell apart from
+// DW_AT_data_bit_offset when the offset is zero. Returns false if the
+// location of a base isn't a constant offset, as with virtual bases.
+func structBases(d *dwarf.Data, off dwarf.Offset, st *dwarf.StructType) ([]*dwarf.StructField, map[*dwarf.StructField]bool, bool, error) {
+	rdr := d.Reader()
+	rdr.Seek(off)
+	ent, err := rdr.Next()
+	if err != nil || ent == nil || !ent.Children {
+		return nil, nil, true, err
+	}
+	var rv []*dwarf.StructField
+	bitOffset := make(map[*dwarf.StructField]bool)
+	nmember := 0
+	for {
+		kid, err := rdr.Next()
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if kid == nil || kid.Tag == 0 {
+			break
+		}
+		if kid.Children {
+			rdr.SkipChildren()
+		}
+		if kid.Tag == dwarf.TagMember {
+			// debug/dwarf makes a field of each member, in order.
+			if _, ok := kid.Val(dwarf.AttrBitOffset).(int64); ok && st != nil && nmember < len(st.Field) {
+				bitOffset[st.Field[nmember]] = true
+			}
+			nmember++
+			continue
+		}
+		if kid.Tag != dwarf.TagInheritance {
+			continue
+		}
+		var boff int64
+		switch v := kid.Val(dwarf.AttrDataMemberLoc).(type) {
+		case int64:
+			boff = v
+		case nil:
+		default:
+			return nil, nil, false, nil
+		}
+		toff, ok := kid.Val(dwarf.AttrType).(dwarf.Offset)
+		if !ok {
+			return nil, nil, false, nil
+		}
+		t, err := d.Type(toff)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		size := t.Size()
+		if bst, ok := t.(*dwarf.StructType); ok && len(bst.Field) == 0 {
+			if more, _, _, err := structBases(d, toff, nil); err != nil || len(more) == 0 {
+				size = 0
+			}
+		}
+		rv = append(rv, &dwarf.StructField{Name: "base " + t.String(), ByteOffset: boff, ByteSize: size})
+	}
+	return rv, bitOffset, true, nil
+}
+
+// collectLayouts visits every named, complete struct (or class) type
+// in the DWARF and returns a layout summary for each distinct name.
+// Types that debug/dwarf can't decode are skipped.
+func collectLayouts(d *dwarf.Data) ([]*structLayout, error) {
+	layouts := make(map[string]*structLayout)
+	cusByName := make(map[string]map[dwarf.Offset]bool)
+	var cuOff dwarf.Offset
+	rdr := d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		switch ent.Tag {
+		case dwarf.TagCompileUnit:
+			cuOff = ent.Offset
+			continue
+		case dwarf.TagStructType, dwarf.TagClassType:
+		default:
+			continue
+		}
+		name, ok := ent.Val(dwarf.AttrName).(string)
+		if !ok {
+			continue
+		}
+		if decl, _ := ent.Val(dwarf.AttrDeclaration).(bool); decl {
+			continue
+		}
+		if _, ok := layouts[name]; !ok {
+			t, err := d.Type(ent.Offset)
+			if err != nil {
+				verb(1, "skipping type %q at offset 0x%x: %v", name, ent.Offset, err)
+				continue
+			}
+			st, ok := t.(*dwarf.StructType)
+			if !ok || st.Incomplete || st.ByteSize <= 0 {
+				continue
+			}
+			bases, bitOffset, ok, err := structBases(d, ent.Offset, st)
+			if err != nil {
+				verb(1, "skipping type %q at offset 0x%x: %v", name, ent.Offset, err)
+				continue
+			}
+			if !ok {
+				verb(2, "skipping type %q at offset 0x%x: base at a variable offset", name, ent.Offset)
+				continue
+			}
+			layouts[name] = computeStructLayout(st, bases, bitOffset)
+			cusByName[name] = make(map[dwarf.Offset]bool)
+		}
+		cusByName[name][cuOff] = true
+	}
+	rv := make([]*structLayout, 0, len(layouts))
+	for name, sl := range layouts {
+		sl.cus = len(cusByName[name])
+		rv = append(rv, sl)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].score() != rv[j].score() {
+			return rv[i].score() > rv[j].score()
+		}
+		return rv[i].name < rv[j].name
+	})
+	return rv, nil
+}
+
+// dumpLayouts prints the worst 'max' offenders (or all structs with
+// holes or padding if 'max' is zero).
+func dumpLayouts(d *dwarf.Data, max int) error {
+	layouts, err := collectLayouts(d)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, sl := range layouts {
+		if sl.wasted() == 0 || (max > 0 && n >= max) {
+			break
+		}
+		n++
+		fmt.Printf("struct %s: size %d, %d bytes wasted (%d holes, %d bytes tail padding), defined in %d CUs\n",
+			sl.name, sl.size, sl.wasted(), len(sl.holes), sl.tailPad, sl.cus)
+		for _, h := range sl.holes {
+			fmt.Printf("    hole of %d bytes at offset %d after member %q\n",
+				h.size, h.offset, h.after)
+		}
+		if sl.tailPad != 0 {
+			fmt.Printf("    tail padding of %d bytes at offset %d\n",
+				sl.tailPad, sl.size-sl.tailPad)
+		}
+	}
+	verb(1, "reported %d of %d struct types", n, len(layouts))
+	return nil
+}
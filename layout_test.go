@@ -0,0 +1,92 @@
+package main
+
+import (
+	"debug/dwarf"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestLayout(t *testing.T) {
+	exe := buildFixture(t, t.TempDir(), "layout.go", noExtra)
+	layouts, err := collectLayouts(loadDwarf(t, exe))
+	if err != nil {
+		t.Fatalf("collectLayouts: %v", err)
+	}
+	var sl *structLayout
+	for _, l := range layouts {
+		if l.name == "main.holey" {
+			sl = l
+		}
+	}
+	if sl == nil {
+		t.Fatalf("no layout found for main.holey")
+	}
+	if sl.size != 24 || sl.tailPad != 7 || sl.wasted() != 14 {
+		t.Errorf("main.holey: got size=%d tail=%d wasted=%d, want 24/7/14",
+			sl.size, sl.tailPad, sl.wasted())
+	}
+	if len(sl.holes) != 1 || sl.holes[0].after != "a" || sl.holes[0].offset != 1 {
+		t.Errorf("main.holey: unexpected holes %+v", sl.holes)
+	}
+}
+
+func TestFieldExtent(t *testing.T) {
+	u32 := &dwarf.UintType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 4}}}
+	for _, tc := range []struct {
+		f          dwarf.StructField
+		bitOffset  bool
+		start, end int64
+	}{
+		{dwarf.StructField{ByteOffset: 8, Type: u32}, false, 8, 12},
+		// DW_AT_data_bit_offset of zero.
+		{dwarf.StructField{Type: u32, BitSize: 3}, false, 0, 1},
+		{dwarf.StructField{Type: u32, BitSize: 4, DataBitOffset: 13}, false, 1, 3},
+		// DW_AT_bit_offset: the whole storage unit, even if the offset
+		// is zero.
+		{dwarf.StructField{ByteOffset: 4, ByteSize: 4, Type: u32, BitSize: 3, BitOffset: 29}, true, 4, 8},
+		{dwarf.StructField{ByteOffset: 4, ByteSize: 4, Type: u32, BitSize: 3}, true, 4, 8},
+	} {
+		if start, end := fieldExtent(&tc.f, tc.bitOffset); start != tc.start || end != tc.end {
+			t.Errorf("fieldExtent(%+v, %v) = [%d,%d), want [%d,%d)", tc.f, tc.bitOffset, start, end, tc.start, tc.end)
+		}
+	}
+}
+
+func TestLayoutCXX(t *testing.T) {
+	cxx, err := exec.LookPath("g++")
+	if err != nil {
+		t.Skip("no g++ available")
+	}
+	dir := t.TempDir()
+	for _, dwarfVersion := range []string{"-gdwarf-4", "-gdwarf-5"} {
+		exe := filepath.Join(dir, "layout.exe")
+		cmd := exec.Command(cxx, "-g", dwarfVersion, "-o", exe, filepath.Join("testdata", "layout.cc"))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Logf("build: %s\n", out)
+			t.Fatalf("build error: %v", err)
+		}
+		layouts, err := collectLayouts(loadDwarf(t, exe))
+		if err != nil {
+			t.Fatalf("%s: collectLayouts: %v", dwarfVersion, err)
+		}
+		got := make(map[string]*structLayout)
+		for _, l := range layouts {
+			got[l.name] = l
+		}
+		if sl := got["Derived"]; sl == nil || sl.tailPad != 4 || len(sl.holes) != 0 {
+			t.Errorf("%s: Derived: got %+v, want 4 bytes tail padding", dwarfVersion, sl)
+		}
+		if sl := got["OnEmpty"]; sl == nil || sl.wasted() != 0 {
+			t.Errorf("%s: OnEmpty: got %+v, want no waste", dwarfVersion, sl)
+		}
+		if sl := got["HighBits"]; sl == nil || len(sl.holes) != 0 {
+			t.Errorf("%s: HighBits: got %+v, want no holes", dwarfVersion, sl)
+		}
+		if dwarfVersion == "-gdwarf-5" {
+			if sl := got["Bits"]; sl == nil || len(sl.holes) != 1 || sl.holes[0].offset != 2 || sl.holes[0].size != 2 {
+				t.Errorf("%s: Bits: got %+v, want a 2 byte hole at offset 2", dwarfVersion, sl)
+			}
+		}
+	}
+}
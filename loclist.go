@@ -0,0 +1,367 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+)
+
+// locListEntry is a single entry in a location list: the location
+// described by 'expr' applies to PCs in [lowpc, highpc).
+type locListEntry struct {
+	lowpc, highpc uint64
+	expr          []byte
+	isDefault     bool // DW_LLE_default_location
+}
+
+// DWARF 5 location list entry kinds.
+const (
+	dwLleEndOfList    = 0x00
+	dwLleBaseAddressx = 0x01
+	dwLleStartxEndx   = 0x02
+	dwLleStartxLength = 0x03
+	dwLleOffsetPair   = 0x04
+	dwLleDefaultLoc   = 0x05
+	dwLleBaseAddress  = 0x06
+	dwLleStartEnd     = 0x07
+	dwLleStartLength  = 0x08
+	dwLleGNUViewPair  = 0x09
+)
+
+// maxLocListEntries guards against runaway decoding of corrupt lists.
+const maxLocListEntries = 1 << 20
+
+// locListReader decodes location lists from either a pre-DWARF 5
+// .debug_loc section or a DWARF 5 .debug_loclists section.
+type locListReader struct {
+	loc      []byte // .debug_loc contents
+	loclists []byte // .debug_loclists contents
+	addr     []byte // .debug_addr contents
+	order    binary.ByteOrder
+}
+
+// newLocListReader loads the sections needed to decode location
+// lists from 'of'.
+func newLocListReader(of *objFile) (*locListReader, error) {
+	lr := &locListReader{order: of.byteOrder()}
+	var err error
+	if lr.loc, err = of.sectionData(".debug_loc"); err != nil {
+		return nil, err
+	}
+	if lr.loclists, err = of.sectionData(".debug_loclists"); err != nil {
+		return nil, err
+	}
+	if lr.addr, err = of.sectionData(".debug_addr"); err != nil {
+		return nil, err
+	}
+	return lr, nil
+}
+
+// locListCU carries the per-CU state needed to decode its lists.
+type locListCU struct {
+	version  int
+	addrSize int
+	is64     bool
+	lowpc    uint64 // CU base address
+	addrBase uint64 // DW_AT_addr_base
+	listBase uint64 // DW_AT_loclists_base
+}
+
+// newLocListCU captures base information from a CU's DIE.
+func newLocListCU(u *unitHeader, cu *dwarf.Entry) *locListCU {
+	lc := &locListCU{version: u.version, addrSize: u.addrSize, is64: u.is64}
+	if v, ok := cu.Val(dwarf.AttrLowpc).(uint64); ok {
+		lc.lowpc = v
+	}
+	if v, ok := cu.Val(dwarf.AttrAddrBase).(int64); ok {
+		lc.addrBase = uint64(v)
+	}
+	if v, ok := cu.Val(dwarf.AttrLoclistsBase).(int64); ok {
+		lc.listBase = uint64(v)
+	}
+	return lc
+}
+
+// listOffset returns the section offset of the location list named by
+// attribute field 'f', which must be of class ClassLocListPtr or
+// ClassLocList.
+func (lr *locListReader) listOffset(lc *locListCU, f *dwarf.Field) (int64, error) {
+	switch v := f.Val.(type) {
+	case int64:
+		return v, nil
+	case uint64:
+		// DW_FORM_loclistx: index into the offsets array that
+		// follows the CU's .debug_loclists header.
+		osz := uint64(4)
+		if lc.is64 {
+			osz = 8
+		}
+		p := lc.listBase + v*osz
+		if p+osz > uint64(len(lr.loclists)) {
+			return 0, fmt.Errorf("loclistx index %d out of range", v)
+		}
+		var rel uint64
+		if lc.is64 {
+			rel = lr.order.Uint64(lr.loclists[p:])
+		} else {
+			rel = uint64(lr.order.Uint32(lr.loclists[p:]))
+		}
+		return int64(lc.listBase + rel), nil
+	}
+	return 0, fmt.Errorf("unexpected location list value %v", f.Val)
+}
+
+// llbuf is a simple cursor for decoding location list bytes (and
+// other DWARF encoded data, as named by 'what').
+type llbuf struct {
+	data  []byte
+	off   int64
+	order binary.ByteOrder
+	err   error
+	what  string
+}
+
+func (b *llbuf) need(n int64) bool {
+	if b.err != nil {
+		return false
+	}
+	if n < 0 || b.off+n > int64(len(b.data)) {
+		what := b.what
+		if what == "" {
+			what = "location list"
+		}
+		b.err = fmt.Errorf("%s truncated at offset 0x%x", what, b.off)
+		return false
+	}
+	return true
+}
+
+func (b *llbuf) u8() uint64 {
+	if !b.need(1) {
+		return 0
+	}
+	v := b.data[b.off]
+	b.off++
+	return uint64(v)
+}
+
+func (b *llbuf) u16() uint64 {
+	if !b.need(2) {
+		return 0
+	}
+	v := b.order.Uint16(b.data[b.off:])
+	b.off += 2
+	return uint64(v)
+}
+
+func (b *llbuf) u32() uint64 {
+	if !b.need(4) {
+		return 0
+	}
+	v := b.order.Uint32(b.data[b.off:])
+	b.off += 4
+	return uint64(v)
+}
+
+func (b *llbuf) u64() uint64 {
+	if !b.need(8) {
+		return 0
+	}
+	v := b.order.Uint64(b.data[b.off:])
+	b.off += 8
+	return v
+}
+
+func (b *llbuf) addr(size int) uint64 {
+	if !b.need(int64(size)) {
+		return 0
+	}
+	var v uint64
+	switch size {
+	case 4:
+		v = uint64(b.order.Uint32(b.data[b.off:]))
+	case 8:
+		v = b.order.Uint64(b.data[b.off:])
+	default:
+		b.err = fmt.Errorf("unsupported address size %d", size)
+		return 0
+	}
+	b.off += int64(size)
+	return v
+}
+
+func (b *llbuf) uleb() uint64 {
+	var v uint64
+	var shift uint
+	for {
+		if !b.need(1) {
+			return 0
+		}
+		c := b.data[b.off]
+		b.off++
+		if shift < 64 {
+			v |= uint64(c&0x7f) << shift
+		}
+		shift += 7
+		if c&0x80 == 0 {
+			return v
+		}
+	}
+}
+
+func (b *llbuf) sleb() int64 {
+	var v int64
+	var shift uint
+	for {
+		if !b.need(1) {
+			return 0
+		}
+		c := b.data[b.off]
+		b.off++
+		if shift < 64 {
+			v |= int64(c&0x7f) << shift
+		}
+		shift += 7
+		if c&0x80 == 0 {
+			if shift < 64 && c&0x40 != 0 {
+				v |= -1 << shift
+			}
+			return v
+		}
+	}
+}
+
+// cstring reads a NUL-terminated string.
+func (b *llbuf) cstring() string {
+	start := b.off
+	for b.need(1) {
+		c := b.data[b.off]
+		b.off++
+		if c == 0 {
+			return string(b.data[start : b.off-1])
+		}
+	}
+	return ""
+}
+
+func (b *llbuf) bytes(n int64) []byte {
+	if !b.need(n) {
+		return nil
+	}
+	v := b.data[b.off : b.off+n]
+	b.off += n
+	return v
+}
+
+// debugAddr returns entry 'idx' from the CU's .debug_addr table.
+func (lr *locListReader) debugAddr(lc *locListCU, idx uint64) (uint64, error) {
+	p := lc.addrBase + idx*uint64(lc.addrSize)
+	if p+uint64(lc.addrSize) > uint64(len(lr.addr)) {
+		return 0, fmt.Errorf("debug_addr index %d out of range", idx)
+	}
+	b := llbuf{data: lr.addr, off: int64(p), order: lr.order}
+	v := b.addr(lc.addrSize)
+	return v, b.err
+}
+
+// read decodes the location list at section offset 'off', returning
+// its entries and the offset just past the end of the list.
+func (lr *locListReader) read(lc *locListCU, off int64) ([]locListEntry, int64, error) {
+	if lc.version >= 5 {
+		return lr.read5(lc, off)
+	}
+	b := llbuf{data: lr.loc, off: off, order: lr.order}
+	maxAddr := ^uint64(0)
+	if lc.addrSize == 4 {
+		maxAddr = 0xffffffff
+	}
+	base := lc.lowpc
+	var rv []locListEntry
+	for b.err == nil {
+		lo := b.addr(lc.addrSize)
+		hi := b.addr(lc.addrSize)
+		if b.err != nil {
+			break
+		}
+		if lo == 0 && hi == 0 {
+			return rv, b.off, nil
+		}
+		if lo == maxAddr {
+			base = hi
+			continue
+		}
+		n := b.u16()
+		expr := b.bytes(int64(n))
+		rv = append(rv, locListEntry{lowpc: base + lo, highpc: base + hi, expr: expr})
+		if len(rv) > maxLocListEntries {
+			return rv, b.off, fmt.Errorf("location list at 0x%x is unterminated", off)
+		}
+	}
+	return rv, b.off, b.err
+}
+
+func (lr *locListReader) read5(lc *locListCU, off int64) ([]locListEntry, int64, error) {
+	b := llbuf{data: lr.loclists, off: off, order: lr.order}
+	base := lc.lowpc
+	var rv []locListEntry
+	addrx := func() uint64 {
+		idx := b.uleb()
+		if b.err != nil {
+			return 0
+		}
+		a, err := lr.debugAddr(lc, idx)
+		if err != nil {
+			b.err = err
+		}
+		return a
+	}
+	expr := func() []byte {
+		return b.bytes(int64(b.uleb()))
+	}
+	for b.err == nil {
+		kind := b.u8()
+		if b.err != nil {
+			break
+		}
+		var e locListEntry
+		switch kind {
+		case dwLleEndOfList:
+			return rv, b.off, nil
+		case dwLleBaseAddressx:
+			base = addrx()
+			continue
+		case dwLleBaseAddress:
+			base = b.addr(lc.addrSize)
+			continue
+		case dwLleStartxEndx:
+			e.lowpc = addrx()
+			e.highpc = addrx()
+		case dwLleStartxLength:
+			e.lowpc = addrx()
+			e.highpc = e.lowpc + b.uleb()
+		case dwLleOffsetPair:
+			e.lowpc = base + b.uleb()
+			e.highpc = base + b.uleb()
+		case dwLleDefaultLoc:
+			e.isDefault = true
+		case dwLleStartEnd:
+			e.lowpc = b.addr(lc.addrSize)
+			e.highpc = b.addr(lc.addrSize)
+		case dwLleStartLength:
+			e.lowpc = b.addr(lc.addrSize)
+			e.highpc = e.lowpc + b.uleb()
+		case dwLleGNUViewPair:
+			b.uleb()
+			b.uleb()
+			continue
+		default:
+			return rv, b.off, fmt.Errorf("unknown location list entry kind 0x%x at offset 0x%x", kind, b.off-1)
+		}
+		e.expr = expr()
+		rv = append(rv, e)
+		if len(rv) > maxLocListEntries {
+			return rv, b.off, fmt.Errorf("location list at 0x%x is unterminated", off)
+		}
+	}
+	return rv, b.off, b.err
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+type locStatsMode int
+
+const (
+	noLocStats   locStatsMode = 0
+	textLocStats locStatsMode = 1
+	jsonLocStats locStatsMode = 2
+)
+
+// locStats accumulates location coverage for the formal parameters
+// and local variables of a function, a package (CU name) or the
+// whole binary. A variable's scope is the PC range of the innermost
+// enclosing lexical block, inlined subroutine or subprogram; the
+// bytes of the scope where its location is known are "covered".
+// Functions are told apart by linkage name; those that aren't
+// external also by the unit that defines them.
+type locStats struct {
+	Name         string `json:"name"`
+	LinkageName  string `json:"linkage_name,omitempty"`
+	Unit         string `json:"unit,omitempty"`
+	Params       int    `json:"params"`
+	Locals       int    `json:"locals"`
+	Available    int    `json:"available"`     // with some coverage
+	Full         int    `json:"fully_covered"` // covering their whole scope
+	ScopeBytes   uint64 `json:"scope_bytes"`
+	CoveredBytes uint64 `json:"covered_bytes"`
+}
+
+// key identifies the function (or package) across builds.
+func (ls *locStats) key() string {
+	name := ls.Name
+	if ls.LinkageName != "" {
+		name = ls.LinkageName
+	}
+	if ls.Unit != "" {
+		return ls.Unit + ":" + name
+	}
+	return name
+}
+
+// label returns the name to display for 'ls', qualified by its unit
+// or linkage name if another entry in 'dups' has the same name.
+func (ls *locStats) label(dups map[string]bool) string {
+	switch {
+	case !dups[ls.Name]:
+		return ls.Name
+	case ls.Unit != "":
+		return ls.Name + " (" + ls.Unit + ")"
+	case ls.LinkageName != "":
+		return ls.Name + " (" + ls.LinkageName + ")"
+	}
+	return ls.Name
+}
+
+// dupNames returns the names shared by more than one entry of 'lss'.
+func dupNames(lss []*locStats) map[string]bool {
+	seen := make(map[string]bool)
+	dups := make(map[string]bool)
+	for _, ls := range lss {
+		dups[ls.Name] = dups[ls.Name] || seen[ls.Name]
+		seen[ls.Name] = true
+	}
+	return dups
+}
+
+func (ls *locStats) vars() int {
+	return ls.Params + ls.Locals
+}
+
+// coverage returns the percentage of scope bytes covered.
+func (ls *locStats) coverage() float64 {
+	if ls.ScopeBytes == 0 {
+		return 0
+	}
+	return 100 * float64(ls.CoveredBytes) / float64(ls.ScopeBytes)
+}
+
+// availability returns the percentage of variables with a location
+// for some part of their scope.
+func (ls *locStats) availability() float64 {
+	if ls.vars() == 0 {
+		return 0
+	}
+	return 100 * float64(ls.Available) / float64(ls.vars())
+}
+
+func (ls *locStats) add(param bool, scope, covered uint64) {
+	if param {
+		ls.Params++
+	} else {
+		ls.Locals++
+	}
+	if covered != 0 {
+		ls.Available++
+	}
+	if covered == scope {
+		ls.Full++
+	}
+	ls.ScopeBytes += scope
+	ls.CoveredBytes += covered
+}
+
+// locStatsReport holds coverage for the binary as a whole, for each
+// package, and for each function.
+type locStatsReport struct {
+	Binary    locStats    `json:"binary"`
+	Packages  []*locStats `json:"packages"`
+	Functions []*locStats `json:"functions"`
+}
+
+// rangeBytes returns the number of bytes in the disjoint ranges 'rs'.
+func rangeBytes(rs [][2]uint64) uint64 {
+	n := uint64(0)
+	for _, r := range rs {
+		n += r[1] - r[0]
+	}
+	return n
+}
+
+// locScope is an open DIE with children while walking a CU: the PC
+// ranges that variables within it are live over (nil outside code),
+// the function they are attributed to, and the concrete instance of
+// an abstract function (inlined or out of line) they belong to.
+type locScope struct {
+	ranges [][2]uint64
+	fn     *locStats
+	inst   *locInstance
+}
+
+// locInstance is a concrete instance of an abstract function. The
+// abstract function's variables that have no concrete DIE in the
+// instance are counted as having no location.
+type locInstance struct {
+	origin dwarf.Offset
+	scope  uint64
+	seen   map[dwarf.Offset]bool
+}
+
+// abstractVar is a formal parameter or local variable of an abstract
+// function.
+type abstractVar struct {
+	off   dwarf.Offset
+	param bool
+}
+
+// abstractVars returns the non-artificial parameters and variables of
+// the abstract function at 'off', including those in nested lexical
+// blocks.
+func abstractVars(d *dwarf.Data, off dwarf.Offset, cache map[dwarf.Offset][]abstractVar) ([]abstractVar, error) {
+	if vs, ok := cache[off]; ok {
+		return vs, nil
+	}
+	var vs []abstractVar
+	rdr := d.Reader()
+	rdr.Seek(off)
+	ent, err := rdr.Next()
+	if err != nil {
+		return nil, err
+	}
+	depth := 0
+	if ent != nil && ent.Children {
+		depth = 1
+	}
+	for depth > 0 {
+		ent, err := rdr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag == 0 {
+			depth--
+			continue
+		}
+		if ent.Children {
+			depth++
+		}
+		if ent.Tag != dwarf.TagFormalParameter && ent.Tag != dwarf.TagVariable {
+			continue
+		}
+		if art, _ := ent.Val(dwarf.AttrArtificial).(bool); art {
+			continue
+		}
+		vs = append(vs, abstractVar{off: ent.Offset, param: ent.Tag == dwarf.TagFormalParameter})
+	}
+	cache[off] = vs
+	return vs, nil
+}
+
+// isArtificial reports whether the variable 'ent', or the abstract
+// variable it is an instance of, has DW_AT_artificial.
+func isArtificial(d *dwarf.Data, ent *dwarf.Entry, cache map[dwarf.Offset]bool) bool {
+	if art, ok := ent.Val(dwarf.AttrArtificial).(bool); ok {
+		return art
+	}
+	origin, ok := ent.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+	if !ok {
+		return false
+	}
+	if art, ok := cache[origin]; ok {
+		return art
+	}
+	art := false
+	rdr := d.Reader()
+	rdr.Seek(origin)
+	if oent, err := rdr.Next(); err == nil && oent != nil {
+		art, _ = oent.Val(dwarf.AttrArtificial).(bool)
+	}
+	cache[origin] = art
+	return art
+}
+
+// funcIdent is how a subprogram is identified: its name, linkage
+// name and whether it is external, found on the DIE or on the DIEs
+// it refers to through DW_AT_abstract_origin or DW_AT_specification.
+type funcIdent struct {
+	name     string
+	linkage  string
+	external bool
+}
+
+// funcIdentity returns the identity of the subprogram at 'off'.
+func funcIdentity(d *dwarf.Data, off dwarf.Offset, cache map[dwarf.Offset]funcIdent) funcIdent {
+	if id, ok := cache[off]; ok {
+		return id
+	}
+	var id funcIdent
+	rdr := d.Reader()
+	cur := off
+	for i := 0; i < 8; i++ {
+		rdr.Seek(cur)
+		ent, err := rdr.Next()
+		if err != nil || ent == nil {
+			break
+		}
+		if id.name == "" {
+			id.name, _ = ent.Val(dwarf.AttrName).(string)
+		}
+		if id.linkage == "" {
+			if id.linkage, _ = ent.Val(dwarf.AttrLinkageName).(string); id.linkage == "" {
+				id.linkage, _ = ent.Val(dwAtMIPSLinkageName).(string)
+			}
+		}
+		if ext, _ := ent.Val(dwarf.AttrExternal).(bool); ext {
+			id.external = true
+		}
+		if o, ok := ent.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset); ok {
+			cur = o
+		} else if o, ok := ent.Val(dwarf.AttrSpecification).(dwarf.Offset); ok {
+			cur = o
+		} else {
+			break
+		}
+	}
+	if id.name == "" {
+		id.name = fmt.Sprintf("<unknown at 0x%x>", off)
+	}
+	cache[off] = id
+	return id
+}
+
+// varCoverage returns the number of bytes of 'scope' over which the
+// variable 'ent' has a location.
+func varCoverage(lr *locListReader, lc *locListCU, ent *dwarf.Entry, scope [][2]uint64) (uint64, error) {
+	if ent.Val(dwarf.AttrConstValue) != nil {
+		return rangeBytes(scope), nil
+	}
+	f := ent.AttrField(dwarf.AttrLocation)
+	if f == nil {
+		return 0, nil
+	}
+	switch f.Class {
+	case dwarf.ClassExprLoc, dwarf.ClassBlock:
+		if b, _ := f.Val.([]byte); len(b) > 0 {
+			return rangeBytes(scope), nil
+		}
+		return 0, nil
+	case dwarf.ClassLocListPtr, dwarf.ClassLocList:
+	default:
+		return 0, nil
+	}
+	off, err := lr.listOffset(lc, f)
+	if err != nil {
+		return 0, err
+	}
+	ents, _, err := lr.read(lc, off)
+	if err != nil {
+		return 0, err
+	}
+	var live [][2]uint64
+	for _, e := range ents {
+		if len(e.expr) == 0 {
+			continue
+		}
+		if e.isDefault {
+			return rangeBytes(scope), nil
+		}
+		live = append(live, [2]uint64{e.lowpc, e.highpc})
+	}
+	return rangeBytes(scope) - rangeBytes(subtractRanges(scope, mergeRanges(live))), nil
+}
+
+// collectLocStats computes location coverage for every formal
+// parameter and local variable in a function with code. Artificial
+// variables (such as C++'s "this") are not counted.
+func collectLocStats(of *objFile, d *dwarf.Data) (*locStatsReport, error) {
+	info, err := of.sectionData(".debug_info")
+	if err != nil {
+		return nil, err
+	}
+	units, err := parseUnitHeaders(info, of.byteOrder(), false)
+	if err != nil {
+		return nil, err
+	}
+	lr, err := newLocListReader(of)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &locStatsReport{Binary: locStats{Name: "<binary>"}}
+	pkgs := make(map[string]*locStats)
+	funcs := make(map[string]*locStats)
+	idents := make(map[dwarf.Offset]funcIdent)
+	absVars := make(map[dwarf.Offset][]abstractVar)
+	artificial := make(map[dwarf.Offset]bool)
+	var pkg *locStats
+	var cuName string
+	var lc *locListCU
+	var stack []locScope
+	ui := -1
+
+	// finish counts the variables of the abstract function that
+	// instance 's' has no DIE for.
+	finish := func(s locScope) error {
+		vs, err := abstractVars(d, s.inst.origin, absVars)
+		if err != nil {
+			return err
+		}
+		for _, v := range vs {
+			if !s.inst.seen[v.off] {
+				s.fn.add(v.param, s.inst.scope, 0)
+				pkg.add(v.param, s.inst.scope, 0)
+				rep.Binary.add(v.param, s.inst.scope, 0)
+			}
+		}
+		return nil
+	}
+
+	rdr := d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		var cur locScope
+		if n := len(stack); n > 0 {
+			cur = stack[n-1]
+		}
+		if ent.Tag == 0 {
+			if n := len(stack); n > 0 {
+				stack = stack[:n-1]
+				if s := cur; s.inst != nil && (n == 1 || stack[n-2].inst != s.inst) {
+					if err := finish(s); err != nil {
+						return nil, err
+					}
+				}
+			}
+			continue
+		}
+		switch ent.Tag {
+		case dwarf.TagCompileUnit, dwarf.TagPartialUnit:
+			for ui++; ui < len(units) && int64(ent.Offset) >= units[ui].end; ui++ {
+			}
+			if ui >= len(units) {
+				return nil, fmt.Errorf("DIE at offset 0x%x lies outside any unit", ent.Offset)
+			}
+			lc = newLocListCU(&units[ui], ent)
+			cuName, _ = ent.Val(dwarf.AttrName).(string)
+			if pkg = pkgs[cuName]; pkg == nil {
+				pkg = &locStats{Name: cuName}
+				pkgs[cuName] = pkg
+			}
+			stack = nil
+			cur = locScope{}
+		case dwarf.TagSubprogram, dwarf.TagInlinedSubroutine, dwarf.TagLexDwarfBlock:
+			ranges, err := d.Ranges(ent)
+			if err != nil {
+				return nil, fmt.Errorf("DIE at offset 0x%x: %v", ent.Offset, err)
+			}
+			if rs := mergeRanges(ranges); len(rs) != 0 {
+				cur.ranges = rs
+			} else if ent.Tag == dwarf.TagSubprogram {
+				// An abstract or declaration-only subprogram.
+				cur = locScope{}
+			}
+			if ent.Tag == dwarf.TagSubprogram && cur.ranges != nil {
+				id := funcIdentity(d, ent.Offset, idents)
+				fn := &locStats{Name: id.name, LinkageName: id.linkage}
+				if !id.external {
+					fn.Unit = cuName
+				}
+				if cur.fn = funcs[fn.key()]; cur.fn == nil {
+					cur.fn = fn
+					funcs[fn.key()] = fn
+				}
+			}
+			if origin, ok := ent.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset); ok && ent.Tag != dwarf.TagLexDwarfBlock && cur.fn != nil {
+				cur.inst = &locInstance{origin: origin, scope: rangeBytes(cur.ranges), seen: make(map[dwarf.Offset]bool)}
+				if !ent.Children {
+					if err := finish(cur); err != nil {
+						return nil, err
+					}
+				}
+			}
+		case dwarf.TagFormalParameter, dwarf.TagVariable:
+			if isArtificial(d, ent, artificial) {
+				break
+			}
+			if origin, ok := ent.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset); ok && cur.inst != nil {
+				cur.inst.seen[origin] = true
+			}
+			if cur.fn != nil {
+				covered, err := varCoverage(lr, lc, ent, cur.ranges)
+				if err != nil {
+					return nil, fmt.Errorf("DIE at offset 0x%x: %v", ent.Offset, err)
+				}
+				param := ent.Tag == dwarf.TagFormalParameter
+				scope := rangeBytes(cur.ranges)
+				cur.fn.add(param, scope, covered)
+				pkg.add(param, scope, covered)
+				rep.Binary.add(param, scope, covered)
+			}
+		}
+		if ent.Children {
+			stack = append(stack, cur)
+		}
+	}
+
+	for _, ls := range pkgs {
+		if ls.vars() != 0 {
+			rep.Packages = append(rep.Packages, ls)
+		}
+	}
+	sort.Slice(rep.Packages, func(i, j int) bool { return rep.Packages[i].Name < rep.Packages[j].Name })
+	for _, ls := range funcs {
+		if ls.vars() != 0 {
+			rep.Functions = append(rep.Functions, ls)
+		}
+	}
+	// Functions with the most uncovered bytes first.
+	sort.Slice(rep.Functions, func(i, j int) bool {
+		a, b := rep.Functions[i], rep.Functions[j]
+		ua, ub := a.ScopeBytes-a.CoveredBytes, b.ScopeBytes-b.CoveredBytes
+		if ua != ub {
+			return ua > ub
+		}
+		return a.key() < b.key()
+	})
+	return rep, nil
+}
+
+// dumpLocStats prints the location coverage report for 'd' in the
+// requested format. In text mode only the 'max' functions with the
+// most uncovered bytes are listed (all of them if 'max' is zero).
+func dumpLocStats(of *objFile, d *dwarf.Data, mode locStatsMode, max int) error {
+	rep, err := collectLocStats(of, d)
+	if err != nil {
+		return err
+	}
+	if mode == jsonLocStats {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(rep)
+	}
+	b := &rep.Binary
+	fmt.Printf("%d variables (%d parameters, %d locals): %d (%.1f%%) with a location, %d fully covered; %.1f%% of scope bytes covered\n",
+		b.vars(), b.Params, b.Locals, b.Available, b.availability(), b.Full, b.coverage())
+	dups := dupNames(rep.Functions)
+	row := func(ls *locStats) {
+		fmt.Printf("%-50s %7d %7.1f%% %7d %7.1f%%\n", shortName(ls.label(dups), 50),
+			ls.vars(), ls.availability(), ls.Full, ls.coverage())
+	}
+	fmt.Printf("\n%-50s %7s %8s %7s %8s\n", "package", "vars", "avail", "full", "covered")
+	for _, ls := range rep.Packages {
+		row(ls)
+	}
+	fmt.Printf("\n%-50s %7s %8s %7s %8s\n", "function", "vars", "avail", "full", "covered")
+	for i, ls := range rep.Functions {
+		if max > 0 && i >= max {
+			break
+		}
+		row(ls)
+	}
+	return nil
+}
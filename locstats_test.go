@@ -0,0 +1,119 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestVarCoverage(t *testing.T) {
+	// A .debug_loc list, relative to a CU base of 0x1000: a location
+	// for [0x10,0x20), none for [0x20,0x28), and one for [0x30,0x40).
+	var loc []byte
+	le := binary.LittleEndian
+	entry := func(lo, hi uint64, expr ...byte) {
+		var b [18]byte
+		le.PutUint64(b[0:], lo)
+		le.PutUint64(b[8:], hi)
+		if lo == 0 && hi == 0 {
+			loc = append(loc, b[:16]...)
+			return
+		}
+		le.PutUint16(b[16:], uint16(len(expr)))
+		loc = append(append(loc, b[:]...), expr...)
+	}
+	entry(0x10, 0x20, 0x50)
+	entry(0x20, 0x28)
+	entry(0x30, 0x40, 0x51)
+	entry(0, 0)
+	lr := &locListReader{loc: loc, order: le}
+	lc := &locListCU{version: 4, addrSize: 8, lowpc: 0x1000}
+	scope := [][2]uint64{{0x1000, 0x1038}}
+
+	tests := []struct {
+		name  string
+		field dwarf.Field
+		want  uint64
+	}{
+		{"loclist", dwarf.Field{Attr: dwarf.AttrLocation, Val: int64(0), Class: dwarf.ClassLocListPtr}, 0x18},
+		{"exprloc", dwarf.Field{Attr: dwarf.AttrLocation, Val: []byte{0x91, 0x08}, Class: dwarf.ClassExprLoc}, 0x38},
+		{"empty", dwarf.Field{Attr: dwarf.AttrLocation, Val: []byte{}, Class: dwarf.ClassExprLoc}, 0},
+		{"const", dwarf.Field{Attr: dwarf.AttrConstValue, Val: int64(3), Class: dwarf.ClassConstant}, 0x38},
+		{"none", dwarf.Field{Attr: dwarf.AttrName, Val: "x", Class: dwarf.ClassString}, 0},
+	}
+	for _, tc := range tests {
+		ent := &dwarf.Entry{Tag: dwarf.TagVariable, Field: []dwarf.Field{tc.field}}
+		got, err := varCoverage(lr, lc, ent, scope)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: varCoverage = %#x, %v, want %#x", tc.name, got, err, tc.want)
+		}
+	}
+}
+
+func TestLocStats(t *testing.T) {
+	exe := buildSelf(t, t.TempDir(), noExtra)
+	of, d := loadObj(t, exe)
+	rep, err := collectLocStats(of, d)
+	if err != nil {
+		t.Fatalf("collectLocStats: %v", err)
+	}
+	b := rep.Binary
+	if b.Params == 0 || b.Locals == 0 || b.Available == 0 {
+		t.Errorf("implausible totals %+v", b)
+	}
+	if b.CoveredBytes > b.ScopeBytes || b.Full > b.Available {
+		t.Errorf("inconsistent totals %+v", b)
+	}
+	var sum locStats
+	sawMain := false
+	for _, ls := range rep.Packages {
+		sum.Params += ls.Params
+		sum.Locals += ls.Locals
+		sum.CoveredBytes += ls.CoveredBytes
+		sawMain = sawMain || ls.Name == "main"
+	}
+	if sum.Params != b.Params || sum.Locals != b.Locals || sum.CoveredBytes != b.CoveredBytes {
+		t.Errorf("packages sum to %+v, binary is %+v", sum, b)
+	}
+	if !sawMain {
+		t.Errorf("no statistics for package main")
+	}
+}
+
+func TestLocStatsCXX(t *testing.T) {
+	cxx, err := exec.LookPath("g++")
+	if err != nil {
+		t.Skip("no g++ available")
+	}
+	exe := filepath.Join(t.TempDir(), "locstats.exe")
+	cmd := exec.Command(cxx, "-g", "-gdwarf-4", "-o", exe,
+		filepath.Join("testdata", "locstats1.cc"), filepath.Join("testdata", "locstats2.cc"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Logf("build: %s\n", out)
+		t.Fatalf("build error: %v", err)
+	}
+	of, d := loadObj(t, exe)
+	rep, err := collectLocStats(of, d)
+	if err != nil {
+		t.Fatalf("collectLocStats: %v", err)
+	}
+	// The overloads of f and the two static helpers are each counted
+	// separately.
+	got := make(map[string]int)
+	for _, ls := range rep.Functions {
+		got[ls.key()] = ls.vars()
+	}
+	want := map[string]int{
+		"_Z1fi":                        2,
+		"_Z1fd":                        2,
+		"testdata/locstats1.cc:helper": 2,
+		"testdata/locstats2.cc:helper": 2,
+	}
+	for k, n := range want {
+		if got[k] != n {
+			t.Errorf("%s: %d variables, want %d (have %v)", k, got[k], n, got)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 // This program reads in DWARF info for a given load module (shared
 // library or executable) and inspects it for problems/insanities,
 // primarily abstract origin references that are incorrect.
-// Can be run on object files as well, in theory.
+// Relocatable object files and ar archives of them are also accepted.
 package main
 
 import (
@@ -21,13 +21,56 @@ var memprofilerateflag = flag.Int64("memprofilerate", 0, "set runtime.MemProfile
 var cpuprofileflag = flag.String("cpuprofile", "", "write CPU profile to `file`")
 var psmflag = flag.String("psm", "", "write /proc/self/maps to `file`")
 var checkabsflag = flag.Bool("checkabs", true, "Perform abstract function checks.")
+var checkodrflag = flag.Bool("checkodr", false, "Check for types defined with conflicting layouts in different CUs.")
+var checkcfiflag = flag.Bool("checkcfi", false, "Check .eh_frame/.debug_frame call frame information.")
+var checkunwindflag = flag.Bool("checkunwind", false, "Simulate unwind tables, checking the CFA rule at return points.")
+var checkarangesflag = flag.Bool("checkaranges", false, "Check .debug_aranges against the PC ranges of each CU.")
+var checksymsflag = flag.Bool("checksyms", false, "Check ELF function symbols against DWARF subprograms.")
+var checkpclnflag = flag.Bool("checkpcln", false, "Compare Go pclntab line information with the DWARF line table.")
+var checkgoflag = flag.Bool("checkgo", false, "Check the Go vendor attributes (DW_AT_go_kind etc) on the types of Go CUs.")
+var checknamesflag = flag.Bool("checknames", false, "Check .debug_names, .gdb_index and .debug_pubnames/.debug_pubtypes against the DIEs.")
 var dumptypesflag = flag.Bool("dumptypes", false, "Dumptype information")
 var readlineflag = flag.Bool("readline", false, "Read dwarf line table.")
 var dumplineflag = flag.Bool("dumpline", false, "Dump dwarf line table.")
-var dumpsizeflag = flag.Int("showsize", 0, "Dump size of dwarf sections table.")
+var dumpsizeflag = flag.Int("showsize", 0, "Dump size of dwarf sections table (2: also attribute .debug_info bytes to CUs, DIE tags and types).")
+var showsizetopflag = flag.Int("showsizetop", 20, "Max rows per table for -showsize=2 (0 for all).")
+var cusizesflag = flag.String("cusizes", "", "Dump per-CU sizes of .debug_info/.debug_line/.debug_loc in `format` (text, csv or json).")
+var cusizesortflag = flag.String("cusizesort", "total", "Sort -cusizes output by `key` (name, info, line, loc or total).")
 var dumpbuildidflag = flag.Bool("dumpbuildid", false, "Dump build ids if available.")
+var debugfiledirflag = flag.String("debug-file-directory", "/usr/lib/debug", "List of `dirs` to search for separate debug files.")
+var dsymexeflag = flag.String("dsymexe", "", "Check that .dSYM bundles match the LC_UUIDs of executable `file`.")
+var layoutmaxflag = flag.Int("layoutmax", 20, "Max number of structs to report in 'layout' mode (0 for all).")
+var inlinesmaxflag = flag.Int("inlinesmax", 20, "Max number of callees to report in 'inlines' mode (0 for all).")
+var locstatsformatflag = flag.String("locstatsformat", "text", "Output `format` for 'locstats' mode (text or json).")
+var locstatsmaxflag = flag.Int("locstatsmax", 20, "Max number of functions to report in 'locstats' text mode (0 for all).")
+var diffmaxflag = flag.Int("diffmax", 20, "Max number of entries of each kind to report in 'diff' mode (0 for all).")
+var baselineflag = flag.String("baseline", "", "Don't report findings recorded in baseline `file`.")
+var writebaselineflag = flag.Bool("writebaseline", false, "Record this run's findings in the -baseline file instead.")
+var showfixedflag = flag.Bool("showfixed", false, "List -baseline findings that are no longer present.")
+var configflag = flag.String("config", "", "Read suppression rules from config `file` (default .dwarfcheck.json, if present).")
 
 var st int
+
+// Exit codes, in increasing order of precedence when several files
+// are examined.
+const (
+	exitOK          = 0
+	exitCheckFailed = 1 // DWARF was read, but checks found problems
+	exitUsage       = 2
+	exitNotObject   = 3 // not a (readable) object file
+	exitNoDWARF     = 4 // object file without any DWARF
+	exitNoDebugInfo = 5 // DWARF sections present, but no .debug_info
+	exitParseError  = 6 // DWARF could not be decoded
+)
+
+// setExit records 'code' as the exit status, unless a code of
+// higher precedence has already been recorded.
+func setExit(code int) {
+	if code > st {
+		st = code
+	}
+}
+
 var atExitFuncs []func()
 
 func atExit(f func()) {
@@ -51,7 +94,14 @@ func verb(vlevel int, s string, a ...interface{}) {
 	}
 }
 
+// diagLabel, if non-empty, is prepended to diagnostics; it is used
+// to identify the slice of a universal binary being examined.
+var diagLabel string
+
 func warn(s string, a ...interface{}) {
+	if diagLabel != "" {
+		fmt.Fprintf(os.Stderr, "%s: ", diagLabel)
+	}
 	fmt.Fprintf(os.Stderr, s, a...)
 	fmt.Fprintf(os.Stderr, "\n")
 }
@@ -60,9 +110,109 @@ func usage(msg string) {
 	if len(msg) > 0 {
 		fmt.Fprintf(os.Stderr, "error: %s\n", msg)
 	}
-	fmt.Fprintf(os.Stderr, "usage: dwarf-check [flags] <ELF files>\n")
+	fmt.Fprintf(os.Stderr, "usage: dwarf-check [flags] [subcommand] <ELF files>\n")
+	fmt.Fprintf(os.Stderr, "subcommands:\n")
+	for _, sc := range subcommands {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", sc.name, sc.desc)
+	}
+	fmt.Fprintf(os.Stderr, "flags:\n")
 	flag.PrintDefaults()
-	os.Exit(2)
+	os.Exit(exitUsage)
+}
+
+// subcommand describes an alternate mode of operation, selected by
+// naming it as the first non-flag command line argument.
+type subcommand struct {
+	name string
+	desc string
+	run  func(args []string, o options)
+}
+
+var subcommands []subcommand
+
+// Set up in init() to avoid an initialization cycle with usage().
+func init() {
+	subcommands = []subcommand{
+		{
+			name: "layout",
+			desc: "report holes and tail padding in struct types",
+			run: func(args []string, o options) {
+				o.lo = yesLayout
+				examineFiles(args, o)
+			},
+		},
+		{
+			name: "inlines",
+			desc: "report which functions were inlined, where, and how deeply",
+			run: func(args []string, o options) {
+				o.il = yesInlines
+				examineFiles(args, o)
+			},
+		},
+		{
+			name: "locstats",
+			desc: "report how much of their scope variables have locations for",
+			run: func(args []string, o options) {
+				switch *locstatsformatflag {
+				case "text":
+					o.ls = textLocStats
+				case "json":
+					o.ls = jsonLocStats
+				default:
+					usage(fmt.Sprintf("unknown -locstatsformat %q", *locstatsformatflag))
+				}
+				examineFiles(args, o)
+			},
+		},
+		{
+			name: "diff",
+			desc: "compare the DWARF of two builds <old> <new> of a program",
+			run: func(args []string, o options) {
+				if len(args) != 2 {
+					usage("diff takes two object files")
+				}
+				if !diffFiles(args[0], args[1], o, *diffmaxflag) {
+					setExit(exitCheckFailed)
+				}
+			},
+		},
+		{
+			name: "verify-debug-pair",
+			desc: "check that <exe> <debugfile> belong together",
+			run: func(args []string, o options) {
+				if len(args) != 2 {
+					usage("verify-debug-pair takes an executable and a debug file")
+				}
+				if verifyDebugPair(args[0], args[1]) {
+					fmt.Printf("%s and %s match\n", args[0], args[1])
+				} else {
+					setExit(exitCheckFailed)
+				}
+			},
+		},
+	}
+}
+
+func lookupSubcommand(name string) *subcommand {
+	for i := range subcommands {
+		if subcommands[i].name == name {
+			return &subcommands[i]
+		}
+	}
+	return nil
+}
+
+func examineFiles(files []string, o options) {
+	if len(files) == 0 {
+		usage("please supply one or more ELF files as command line arguments")
+	}
+	for _, arg := range files {
+		for i := 0; i < *iterflag; i++ {
+			if !examineFile(arg, o) {
+				setExit(exitCheckFailed)
+			}
+		}
+	}
 }
 
 func setupMemProfile() {
@@ -139,15 +289,83 @@ func main() {
 	if *checkabsflag {
 		o.dc = yesDoAbsChecks
 	}
+	if *checkodrflag {
+		o.oc = yesOdrCheck
+	}
+	if *checkcfiflag {
+		o.cf = yesCFICheck
+	}
+	if *checkunwindflag {
+		o.uw = yesUnwindCheck
+	}
+	if *checkarangesflag {
+		o.ar = yesArangesCheck
+	}
+	if *checknamesflag {
+		o.nm = yesNamesCheck
+	}
+	if *checksymsflag {
+		o.sy = yesSymsCheck
+	}
+	if *checkpclnflag {
+		o.pc = yesPclnCheck
+	}
+	if *checkgoflag {
+		o.gt = yesGoTypesCheck
+	}
+	switch *cusizesflag {
+	case "":
+	case "text":
+		o.cs = textCUSizes
+	case "csv":
+		o.cs = csvCUSizes
+	case "json":
+		o.cs = jsonCUSizes
+	default:
+		usage(fmt.Sprintf("unknown -cusizes format %q", *cusizesflag))
+	}
+	if err := sortCUSizes(nil, *cusizesortflag); err != nil {
+		usage(fmt.Sprintf("bad -cusizesort: %v", err))
+	}
 	if *dumpsizeflag != 0 {
-		if *dumpsizeflag > 0 {
+		if *dumpsizeflag > 1 {
+			o.sz = attribDumpSize
+		} else if *dumpsizeflag > 0 {
 			o.sz = detailDumpSize
 		}
 	}
-	for _, arg := range flag.Args() {
-		for i := 0; i < *iterflag; i++ {
-			examineFile(arg, o)
+	cfg := *configflag
+	if cfg == "" {
+		if _, err := os.Stat(defaultConfigFile); err == nil {
+			cfg = defaultConfigFile
+		}
+	}
+	if cfg != "" {
+		c, err := loadConfig(cfg)
+		if err != nil {
+			usage(fmt.Sprintf("bad -config: %v", err))
 		}
+		verb(1, "read %d suppression rules from %s", len(c.Suppress), cfg)
+		config = c
+	}
+	if *baselineflag != "" {
+		b, err := loadBaseline(*baselineflag, *writebaselineflag)
+		if err != nil {
+			usage(fmt.Sprintf("bad -baseline: %v", err))
+		}
+		baseline = b
+		atExit(func() {
+			if err := baseline.finish(*showfixedflag); err != nil {
+				warn("error writing baseline: %v", err)
+			}
+		})
+	} else if *writebaselineflag || *showfixedflag {
+		usage("-writebaseline and -showfixed require -baseline")
+	}
+	if sc := lookupSubcommand(flag.Arg(0)); sc != nil {
+		sc.run(flag.Args()[1:], o)
+	} else {
+		examineFiles(flag.Args(), o)
 	}
 	verb(1, "leaving main")
 	Exit(st)
@@ -0,0 +1,947 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type namesCheckMode int
+
+const (
+	noNamesCheck  namesCheckMode = 0
+	yesNamesCheck namesCheckMode = 1
+)
+
+// Symbol kinds, as recorded in .gdb_index CU vectors (version 7 and
+// later) and in the flags of .debug_gnu_pubnames entries.
+// idxKindNonType is our own, for .debug_pubnames entries.
+const (
+	idxKindNone     = 0
+	idxKindType     = 1
+	idxKindVariable = 2
+	idxKindFunction = 3
+	idxKindOther    = 4
+	idxKindNonType  = 5
+)
+
+var idxKindNames = [...]string{"none", "type", "variable", "function", "other", "non-type"}
+
+// DWARF 5 name index attributes and the forms they may use.
+const (
+	dwIdxCompileUnit = 0x01
+	dwIdxTypeUnit    = 0x02
+	dwIdxDieOffset   = 0x03
+	dwIdxParent      = 0x04
+	dwIdxTypeHash    = 0x05
+
+	dwFormData2       = 0x05
+	dwFormData4       = 0x06
+	dwFormData8       = 0x07
+	dwFormData1       = 0x0b
+	dwFormFlag        = 0x0c
+	dwFormSdata       = 0x0d
+	dwFormUdata       = 0x0f
+	dwFormRef1        = 0x11
+	dwFormRef2        = 0x12
+	dwFormRef4        = 0x13
+	dwFormRef8        = 0x14
+	dwFormRefUdata    = 0x15
+	dwFormSecOffset   = 0x17
+	dwFormFlagPresent = 0x19
+	dwFormData16      = 0x1e
+)
+
+// dwAtMIPSLinkageName is the pre-DWARF 4 spelling of DW_AT_linkage_name.
+const dwAtMIPSLinkageName dwarf.Attr = 0x2007
+
+// nameDIE records what the name index checks need to know about a DIE.
+type nameDIE struct {
+	tag      dwarf.Tag
+	cu       int64 // offset of the containing unit's header
+	name     string
+	linkage  string
+	ref      dwarf.Offset // DW_AT_specification or DW_AT_abstract_origin
+	external bool
+	decl     bool
+	defined  bool // a subprogram with code, or a variable with a location
+	visible  bool // at CU scope, or within a named namespace
+	local    bool // within a subprogram or lexical block
+}
+
+// nameCU is a compilation unit as seen by the name index checks.
+// 'names' maps each name used by a DIE in the CU to the kinds
+// (1<<idxKind...) it may be indexed as; bit 0 is always set.
+type nameCU struct {
+	off   int64
+	size  int64
+	die   dwarf.Offset
+	name  string
+	names map[string]int
+}
+
+// nameDIEs holds every DIE in .debug_info's compilation units.
+type nameDIEs struct {
+	dies   map[dwarf.Offset]*nameDIE
+	offs   []dwarf.Offset // DIE offsets in section order
+	cus    map[int64]*nameCU
+	cuDIEs map[dwarf.Offset]bool
+	order  []int64 // CU offsets in section order
+}
+
+// nameScope is an entry in the stack of enclosing DIEs maintained by
+// collectNameDIEs.
+type nameScope struct {
+	visible bool // children are visible outside the CU
+	local   bool // children are within a subprogram or lexical block
+}
+
+// anonNamespace is how indexes name an anonymous namespace.
+const anonNamespace = "(anonymous namespace)"
+
+// isIndexTypeTag returns true for tags that .debug_pubtypes and
+// the type kind of .gdb_index refer to.
+func isIndexTypeTag(t dwarf.Tag) bool {
+	switch t {
+	case dwarf.TagBaseType, dwarf.TagClassType, dwarf.TagStructType,
+		dwarf.TagUnionType, dwarf.TagEnumerationType, dwarf.TagTypedef,
+		dwarf.TagUnspecifiedType, dwarf.TagInterfaceType, dwarf.TagSubrangeType,
+		dwarf.TagPointerType, dwarf.TagReferenceType, dwarf.TagRvalueReferenceType,
+		dwarf.TagConstType, dwarf.TagVolatileType, dwarf.TagRestrictType,
+		dwarf.TagArrayType, dwarf.TagSubroutineType, dwarf.TagPtrToMemberType,
+		dwarf.TagSetType, dwarf.TagStringType, dwarf.TagFileType,
+		dwarf.TagPackedType, dwarf.TagSharedType:
+		return true
+	}
+	return false
+}
+
+// idxKindBits returns the kinds of index entry that may refer to a
+// DIE with tag 't', as a bit mask.
+func idxKindBits(t dwarf.Tag) int {
+	bits := 1
+	switch {
+	case isIndexTypeTag(t), t == dwarf.TagNamespace, t == dwarf.TagModule:
+		bits |= 1 << idxKindType
+	case t == dwarf.TagSubprogram:
+		bits |= 1 << idxKindFunction
+	case t == dwarf.TagVariable, t == dwarf.TagConstant, t == dwarf.TagEnumerator:
+		bits |= 1 << idxKindVariable
+	}
+	if !isIndexTypeTag(t) {
+		bits |= 1 << idxKindNonType
+	}
+	return bits | 1<<idxKindOther | 1<<idxKindNone
+}
+
+// collectNameDIEs walks the compilation units in .debug_info,
+// recording each DIE.
+func collectNameDIEs(of *objFile, d *dwarf.Data) (*nameDIEs, error) {
+	info, err := of.sectionData(".debug_info")
+	if err != nil {
+		return nil, err
+	}
+	units, err := parseUnitHeaders(info, of.byteOrder(), false)
+	if err != nil {
+		return nil, err
+	}
+	nd := &nameDIEs{
+		dies:   make(map[dwarf.Offset]*nameDIE),
+		cus:    make(map[int64]*nameCU),
+		cuDIEs: make(map[dwarf.Offset]bool),
+	}
+	var cu *nameCU
+	var scope []nameScope
+	ui := 0
+	rdr := d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag == 0 {
+			if len(scope) > 0 {
+				scope = scope[:len(scope)-1]
+			}
+			continue
+		}
+		for ui < len(units) && units[ui].end <= int64(ent.Offset) {
+			ui++
+		}
+		if ui >= len(units) {
+			return nil, fmt.Errorf("DIE at 0x%x lies outside any unit", ent.Offset)
+		}
+		if int64(ent.Offset) == units[ui].dieOff {
+			if ent.Tag == dwarf.TagTypeUnit {
+				rdr.SkipChildren()
+				continue
+			}
+			name, _ := ent.Val(dwarf.AttrName).(string)
+			cu = &nameCU{
+				off:   units[ui].off,
+				size:  units[ui].end - units[ui].off,
+				die:   ent.Offset,
+				name:  name,
+				names: make(map[string]int),
+			}
+			nd.cus[cu.off] = cu
+			nd.cuDIEs[ent.Offset] = true
+			nd.order = append(nd.order, cu.off)
+			scope = scope[:0]
+			if ent.Children {
+				scope = append(scope, nameScope{visible: true})
+			}
+			continue
+		}
+		if cu == nil {
+			return nil, fmt.Errorf("DIE at 0x%x precedes any unit DIE", ent.Offset)
+		}
+		x := &nameDIE{tag: ent.Tag, cu: cu.off}
+		if len(scope) > 0 {
+			x.visible = scope[len(scope)-1].visible
+			x.local = scope[len(scope)-1].local
+		}
+		x.name, _ = ent.Val(dwarf.AttrName).(string)
+		anon := ent.Tag == dwarf.TagNamespace && x.name == ""
+		if anon {
+			x.name = anonNamespace
+		}
+		x.linkage, _ = ent.Val(dwarf.AttrLinkageName).(string)
+		if x.linkage == "" {
+			x.linkage, _ = ent.Val(dwAtMIPSLinkageName).(string)
+		}
+		if r, ok := ent.Val(dwarf.AttrSpecification).(dwarf.Offset); ok {
+			x.ref = r
+		} else if r, ok := ent.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset); ok {
+			x.ref = r
+		}
+		x.external, _ = ent.Val(dwarf.AttrExternal).(bool)
+		x.decl, _ = ent.Val(dwarf.AttrDeclaration).(bool)
+		switch ent.Tag {
+		case dwarf.TagSubprogram:
+			x.defined = ent.Val(dwarf.AttrLowpc) != nil || ent.Val(dwarf.AttrRanges) != nil
+		case dwarf.TagVariable:
+			x.defined = ent.Val(dwarf.AttrLocation) != nil
+		}
+		nd.dies[ent.Offset] = x
+		nd.offs = append(nd.offs, ent.Offset)
+		for _, n := range []string{x.name, x.linkage} {
+			if n != "" {
+				cu.names[n] |= idxKindBits(ent.Tag)
+			}
+		}
+		if ent.Children {
+			// Only named namespaces make their contents visible.
+			scope = append(scope, nameScope{
+				visible: x.visible && ent.Tag == dwarf.TagNamespace && !anon,
+				local:   x.local || isLocalScopeTag(ent.Tag),
+			})
+		}
+	}
+	return nd, nil
+}
+
+// chain returns the DIE at 'off' followed by those it completes, via
+// DW_AT_specification or DW_AT_abstract_origin.
+func (nd *nameDIEs) chain(off dwarf.Offset) []dwarf.Offset {
+	var rv []dwarf.Offset
+	for i := 0; i < 8; i++ {
+		x := nd.dies[off]
+		if x == nil {
+			break
+		}
+		rv = append(rv, off)
+		if x.ref == 0 {
+			break
+		}
+		off = x.ref
+	}
+	return rv
+}
+
+// names returns the names (and linkage names) by which an index may
+// refer to the DIE at 'off'.
+func (nd *nameDIEs) names(off dwarf.Offset) []string {
+	var rv []string
+	for _, c := range nd.chain(off) {
+		x := nd.dies[c]
+		for _, n := range []string{x.name, x.linkage} {
+			if n != "" {
+				rv = append(rv, n)
+			}
+		}
+	}
+	return rv
+}
+
+// name returns the DW_AT_name of the DIE at 'off', looking through
+// DW_AT_specification and DW_AT_abstract_origin as needed.
+func (nd *nameDIEs) name(off dwarf.Offset) string {
+	for _, c := range nd.chain(off) {
+		if x := nd.dies[c]; x.name != "" {
+			return x.name
+		}
+	}
+	return ""
+}
+
+// indexKind returns the kind of index entry that the DIE at 'off'
+// requires: functions and variables defined in the CU and visible
+// outside it, and named types at CU or namespace scope. Returns
+// idxKindNone for DIEs that needn't be indexed.
+func (nd *nameDIEs) indexKind(off dwarf.Offset) int {
+	x := nd.dies[off]
+	name := nd.name(off)
+	// GCC names base types it can't otherwise describe "__unknown__",
+	// and never indexes them.
+	if x.decl || name == "" || name == "__unknown__" {
+		return idxKindNone
+	}
+	switch x.tag {
+	case dwarf.TagSubprogram, dwarf.TagVariable:
+		if !x.defined {
+			return idxKindNone
+		}
+		chain := nd.chain(off)
+		for _, c := range chain {
+			// Members of function-local classes, and function-local
+			// statics, may be "external" but can't be looked up.
+			if nd.dies[c].local {
+				return idxKindNone
+			}
+		}
+		for _, c := range chain {
+			if nd.dies[c].external {
+				if x.tag == dwarf.TagSubprogram {
+					return idxKindFunction
+				}
+				return idxKindVariable
+			}
+		}
+	case dwarf.TagBaseType, dwarf.TagClassType, dwarf.TagStructType,
+		dwarf.TagUnionType, dwarf.TagEnumerationType, dwarf.TagTypedef:
+		if x.visible {
+			return idxKindType
+		}
+	}
+	return idxKindNone
+}
+
+// lastComponent strips any C++ scope qualifiers from 'name', so that
+// "ns::Pt::sum" yields "sum"; "::" within template arguments or
+// parentheses doesn't count.
+func lastComponent(name string) string {
+	depth, start := 0, 0
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case '<', '(':
+			depth++
+		case '>', ')':
+			if depth > 0 {
+				depth--
+			}
+		case ':':
+			if depth == 0 && i+1 < len(name) && name[i+1] == ':' {
+				start = i + 2
+				i++
+			}
+		}
+	}
+	return name[start:]
+}
+
+// nameMatches returns true if the index entry name 'ename' refers to
+// a DIE with one of the given names. Index names may be qualified.
+func nameMatches(ename string, names []string) bool {
+	short := lastComponent(ename)
+	for _, n := range names {
+		if ename == n || short == n || strings.HasSuffix(ename, "::"+n) {
+			return true
+		}
+	}
+	return false
+}
+
+// nameEntry is a single entry in a name index.
+type nameEntry struct {
+	name string
+	cu   int64        // unit header offset, or -1 for a type unit
+	die  dwarf.Offset // DIE offset, if recorded
+	tag  dwarf.Tag    // the DIE's stated tag, if recorded
+	kind int          // the DIE's stated kind (idxKind...), if recorded
+}
+
+// nameIndex is the decoded contents of a name index section.
+type nameIndex struct {
+	sect    string
+	entries []nameEntry
+	cus     []int64         // the CUs the index covers
+	cuLens  map[int64]int64 // CU lengths recorded by the index, if any
+	byName  bool            // entries name a CU but not a DIE
+	want    int             // kinds of DIE that must be indexed, as a bit mask
+	strict  bool            // every CU with indexable DIEs must be covered
+	probs   []nameProblem   // problems found while parsing
+}
+
+// parsePubnames decodes a .debug_pubnames or .debug_pubtypes section.
+// In the GNU variants each entry also has a flags byte, which gives
+// the entry's kind; otherwise all entries get 'kind'.
+func parsePubnames(sect string, data []byte, order binary.ByteOrder, gnu bool, kind int) (*nameIndex, error) {
+	idx := &nameIndex{sect: sect, cuLens: make(map[int64]int64)}
+	b := &llbuf{data: data, order: order, what: sect}
+	for b.off < int64(len(data)) {
+		start := b.off
+		length := b.u32()
+		is64 := false
+		if length == 0xffffffff {
+			length = b.u64()
+			is64 = true
+		}
+		end := b.off + int64(length)
+		if b.err != nil {
+			return idx, b.err
+		}
+		if end > int64(len(data)) || end < b.off {
+			return idx, fmt.Errorf("set at 0x%x: length 0x%x overruns section", start, length)
+		}
+		off := b.u32
+		if is64 {
+			off = b.u64
+		}
+		if v := b.u16(); v != 2 {
+			return idx, fmt.Errorf("set at 0x%x: unsupported version %d", start, v)
+		}
+		cu := int64(off())
+		idx.cus = append(idx.cus, cu)
+		idx.cuLens[cu] = int64(off())
+		for b.off < end {
+			pos := b.off
+			die := off()
+			if die == 0 {
+				// Readers stop here, so any entries that follow
+				// are lost. (GCC emits zero offsets for types moved
+				// to type units.)
+				if b.err == nil && strings.Trim(string(data[b.off:end]), "\x00") != "" {
+					idx.probs = append(idx.probs, nameProblem{cu: cu, attr: "terminated set",
+						msg: fmt.Sprintf("set at 0x%x is terminated by the entry at 0x%x, %d bytes before its end",
+							start, pos, end-pos)})
+				}
+				break
+			}
+			e := nameEntry{cu: cu, die: dwarf.Offset(cu + int64(die)), kind: kind}
+			if gnu {
+				e.kind = int(b.u8()>>4) & 7
+			}
+			e.name = b.cstring()
+			if b.err != nil {
+				break
+			}
+			idx.entries = append(idx.entries, e)
+		}
+		if b.err != nil {
+			return idx, fmt.Errorf("set at 0x%x: %v", start, b.err)
+		}
+		b.off = end
+	}
+	return idx, nil
+}
+
+// parseGdbIndex decodes a .gdb_index section (versions 7 through 9).
+// Its symbol table records only the CUs defining each name.
+func parseGdbIndex(data []byte) (*nameIndex, error) {
+	idx := &nameIndex{sect: ".gdb_index", byName: true}
+	b := &llbuf{data: data, order: binary.LittleEndian, what: ".gdb_index"}
+	version := b.u32()
+	if b.err != nil {
+		return idx, b.err
+	}
+	if version < 7 || version > 9 {
+		return idx, fmt.Errorf("unsupported version %d", version)
+	}
+	nhdr := 5
+	if version >= 9 {
+		nhdr = 6 // adds the shortcut table
+	}
+	hdr := make([]int64, nhdr)
+	for i := range hdr {
+		hdr[i] = int64(b.u32())
+		if b.err != nil {
+			return idx, b.err
+		}
+		if hdr[i] > int64(len(data)) || (i > 0 && hdr[i] < hdr[i-1]) {
+			return idx, fmt.Errorf("bad header: table offset 0x%x", hdr[i])
+		}
+	}
+	cuList, tuList, addrArea, symTab, symEnd, pool := hdr[0], hdr[1], hdr[2], hdr[3], hdr[4], hdr[nhdr-1]
+	ncu := (tuList - cuList) / 16
+	ntu := (addrArea - tuList) / 24
+	b.off = cuList
+	for i := int64(0); i < ncu; i++ {
+		idx.cus = append(idx.cus, int64(b.u64()))
+		b.u64() // length
+	}
+	for slot := symTab; slot+8 <= symEnd; slot += 8 {
+		b.off = slot
+		nameOff, vecOff := int64(b.u32()), int64(b.u32())
+		if nameOff == 0 && vecOff == 0 {
+			continue
+		}
+		b.off = pool + nameOff
+		name := b.cstring()
+		b.off = pool + vecOff
+		n := int64(b.u32())
+		if b.err != nil || !b.need(4*n) {
+			return idx, fmt.Errorf("symbol table slot %d: %v", (slot-symTab)/8, b.err)
+		}
+		for i := int64(0); i < n; i++ {
+			v := b.u32()
+			e := nameEntry{name: name, cu: -1, kind: int(v>>28) & 7}
+			switch u := int64(v & 0xffffff); {
+			case u < ncu:
+				e.cu = idx.cus[u]
+			case u >= ncu+ntu:
+				return idx, fmt.Errorf("symbol %q refers to unit %d, but there are only %d", name, u, ncu+ntu)
+			}
+			idx.entries = append(idx.entries, e)
+		}
+	}
+	return idx, nil
+}
+
+// nameAbbrev is an abbreviation from a .debug_names abbreviation table.
+type nameAbbrev struct {
+	tag   dwarf.Tag
+	attrs [][2]uint64 // index attribute and form
+}
+
+// nameIdxValue reads an index attribute value of the given form.
+func (b *llbuf) nameIdxValue(form uint64, is64 bool) (uint64, error) {
+	switch form {
+	case dwFormData1, dwFormRef1, dwFormFlag:
+		return b.u8(), nil
+	case dwFormData2, dwFormRef2:
+		return b.u16(), nil
+	case dwFormData4, dwFormRef4:
+		return b.u32(), nil
+	case dwFormData8, dwFormRef8:
+		return b.u64(), nil
+	case dwFormUdata, dwFormRefUdata:
+		return b.uleb(), nil
+	case dwFormSdata:
+		return uint64(b.sleb()), nil
+	case dwFormSecOffset:
+		if is64 {
+			return b.u64(), nil
+		}
+		return b.u32(), nil
+	case dwFormFlagPresent:
+		return 1, nil
+	case dwFormData16:
+		b.bytes(16)
+		return 0, nil
+	}
+	return 0, fmt.Errorf("unsupported form 0x%x", form)
+}
+
+// parseDebugNames decodes a DWARF 5 .debug_names section, whose
+// strings live in 'str' (the contents of .debug_str).
+func parseDebugNames(data, str []byte, order binary.ByteOrder) (*nameIndex, error) {
+	idx := &nameIndex{sect: ".debug_names"}
+	b := &llbuf{data: data, order: order, what: ".debug_names"}
+	for b.off < int64(len(data)) {
+		start := b.off
+		length := b.u32()
+		is64 := false
+		if length == 0xffffffff {
+			length = b.u64()
+			is64 = true
+		}
+		end := b.off + int64(length)
+		if b.err != nil {
+			return idx, b.err
+		}
+		if end > int64(len(data)) || end < b.off {
+			return idx, fmt.Errorf("unit at 0x%x: length 0x%x overruns section", start, length)
+		}
+		offsz := int64(4)
+		off := b.u32
+		if is64 {
+			offsz, off = 8, b.u64
+		}
+		if v := b.u16(); v != 5 {
+			return idx, fmt.Errorf("unit at 0x%x: unsupported version %d", start, v)
+		}
+		b.u16() // padding
+		ncu, nltu, nftu := int64(b.u32()), int64(b.u32()), int64(b.u32())
+		nbucket, nname := int64(b.u32()), int64(b.u32())
+		abbrevSize, augSize := int64(b.u32()), int64(b.u32())
+		b.bytes(augSize)
+		cus := make([]int64, ncu)
+		for i := range cus {
+			cus[i] = int64(off())
+		}
+		b.bytes(nltu*offsz + nftu*8 + nbucket*4)
+		if nbucket > 0 {
+			b.bytes(nname * 4) // hashes
+		}
+		strOffs := make([]uint64, nname)
+		for i := range strOffs {
+			strOffs[i] = off()
+		}
+		entOffs := make([]int64, nname)
+		for i := range entOffs {
+			entOffs[i] = int64(off())
+		}
+		abbrevData := b.bytes(abbrevSize)
+		if b.err != nil {
+			return idx, fmt.Errorf("unit at 0x%x: %v", start, b.err)
+		}
+		pool := b.off
+		if pool > end {
+			return idx, fmt.Errorf("unit at 0x%x: tables overrun the unit", start)
+		}
+
+		abbrevs := make(map[uint64]*nameAbbrev)
+		ab := &llbuf{data: abbrevData, order: order, what: ".debug_names abbreviations"}
+		for {
+			code := ab.uleb()
+			if code == 0 || ab.err != nil {
+				break
+			}
+			a := &nameAbbrev{tag: dwarf.Tag(ab.uleb())}
+			for ab.err == nil {
+				at, form := ab.uleb(), ab.uleb()
+				if at == 0 && form == 0 {
+					break
+				}
+				a.attrs = append(a.attrs, [2]uint64{at, form})
+			}
+			abbrevs[code] = a
+		}
+		if ab.err != nil {
+			return idx, fmt.Errorf("unit at 0x%x: %v", start, ab.err)
+		}
+
+		for i := int64(0); i < nname; i++ {
+			sb := &llbuf{data: str, off: int64(strOffs[i]), what: ".debug_str"}
+			name := sb.cstring()
+			if sb.err != nil || strOffs[i] >= uint64(len(str)) {
+				return idx, fmt.Errorf("unit at 0x%x: name %d: bad string offset 0x%x", start, i, strOffs[i])
+			}
+			b.off = pool + entOffs[i]
+			for {
+				if b.off >= end {
+					return idx, fmt.Errorf("unit at 0x%x: entries for %q run off the end of the unit", start, name)
+				}
+				code := b.uleb()
+				if code == 0 {
+					break
+				}
+				a := abbrevs[code]
+				if a == nil {
+					return idx, fmt.Errorf("unit at 0x%x: entry for %q has unknown abbreviation code %d", start, name, code)
+				}
+				cuIdx, tuIdx, die := int64(-1), int64(-1), int64(-1)
+				for _, at := range a.attrs {
+					v, err := b.nameIdxValue(at[1], is64)
+					if err != nil {
+						return idx, fmt.Errorf("unit at 0x%x: entry for %q: %v", start, name, err)
+					}
+					switch at[0] {
+					case dwIdxCompileUnit:
+						cuIdx = int64(v)
+					case dwIdxTypeUnit:
+						tuIdx = int64(v)
+					case dwIdxDieOffset:
+						die = int64(v)
+					}
+				}
+				if b.err != nil {
+					return idx, fmt.Errorf("unit at 0x%x: %v", start, b.err)
+				}
+				e := nameEntry{name: name, cu: -1, tag: a.tag}
+				switch {
+				case tuIdx >= 0:
+					if tuIdx >= nltu+nftu {
+						return idx, fmt.Errorf("unit at 0x%x: entry for %q refers to type unit %d, but there are only %d",
+							start, name, tuIdx, nltu+nftu)
+					}
+				case cuIdx >= 0:
+					if cuIdx >= ncu {
+						return idx, fmt.Errorf("unit at 0x%x: entry for %q refers to CU %d, but there are only %d",
+							start, name, cuIdx, ncu)
+					}
+					e.cu = cus[cuIdx]
+				case ncu == 1:
+					e.cu = cus[0]
+				default:
+					return idx, fmt.Errorf("unit at 0x%x: entry for %q does not identify its CU", start, name)
+				}
+				if die < 0 {
+					return idx, fmt.Errorf("unit at 0x%x: entry for %q has no DIE offset", start, name)
+				}
+				if e.cu >= 0 {
+					e.die = dwarf.Offset(e.cu + die)
+				}
+				idx.entries = append(idx.entries, e)
+			}
+		}
+		idx.cus = append(idx.cus, cus...)
+		b.off = end
+	}
+	return idx, nil
+}
+
+// nameProblem is a stale or missing entry found when checking a name
+// index, attributed to the CU at 'cu' (or -1 if there is none). 'name'
+// and 'attr' identify it in a baseline; a problem with the CU itself
+// has no name and takes the CU's.
+type nameProblem struct {
+	cu      int64
+	missing bool
+	name    string
+	attr    string
+	msg     string
+}
+
+// checkNameIndex checks the entries in 'idx' against the DIEs in
+// 'nd'. Each entry must refer to a DIE with the stated name and tag
+// (or kind), in the stated CU; conversely each DIE of the kinds the
+// index covers must have an entry, if its CU is covered at all.
+func checkNameIndex(idx *nameIndex, nd *nameDIEs) []nameProblem {
+	probs := append([]nameProblem(nil), idx.probs...)
+	stale := func(e nameEntry, format string, a ...interface{}) {
+		probs = append(probs, nameProblem{cu: e.cu, name: e.name, attr: "stale", msg: fmt.Sprintf("stale entry %q: ", e.name) + fmt.Sprintf(format, a...)})
+	}
+	covered := make(map[int64]bool)
+	for _, off := range idx.cus {
+		cu := nd.cus[off]
+		if cu == nil {
+			probs = append(probs, nameProblem{cu: -1, attr: "CU offset", msg: fmt.Sprintf("CU offset 0x%x is not a compilation unit", off)})
+			continue
+		}
+		covered[off] = true
+		if n, ok := idx.cuLens[off]; ok && n != cu.size {
+			probs = append(probs, nameProblem{cu: off, attr: "CU length", msg: fmt.Sprintf("CU length recorded as 0x%x, but it is 0x%x", n, cu.size)})
+		}
+	}
+
+	indexed := make(map[dwarf.Offset]bool)
+	byName := make(map[int64]map[string]bool)
+	for _, e := range idx.entries {
+		cu := nd.cus[e.cu]
+		if cu == nil {
+			// A type unit entry, or a CU already reported above.
+			continue
+		}
+		if idx.byName {
+			short := lastComponent(e.name)
+			bits := cu.names[e.name] | cu.names[short]
+			switch {
+			case bits == 0:
+				stale(e, "no DIE in the CU has that name")
+			case bits&(1<<e.kind) == 0:
+				stale(e, "no DIE of kind %s in the CU has that name", idxKindNames[e.kind])
+			default:
+				if byName[e.cu] == nil {
+					byName[e.cu] = make(map[string]bool)
+				}
+				byName[e.cu][short] = true
+			}
+			continue
+		}
+		x := nd.dies[e.die]
+		if x == nil && nd.cuDIEs[e.die] {
+			// GCC points .debug_pubtypes entries for types that were
+			// moved to type units at the CU DIE.
+			continue
+		}
+		if x == nil {
+			stale(e, "no DIE at offset 0x%x", e.die)
+			continue
+		}
+		switch {
+		case x.cu != e.cu:
+			stale(e, "DIE at 0x%x belongs to the CU at 0x%x", e.die, x.cu)
+		case e.tag != 0 && e.tag != x.tag:
+			stale(e, "DIE at 0x%x is a %v, not a %v", e.die, x.tag, e.tag)
+		case idxKindBits(x.tag)&(1<<e.kind) == 0:
+			stale(e, "DIE at 0x%x is a %v, not of kind %s", e.die, x.tag, idxKindNames[e.kind])
+		case !nameMatches(e.name, nd.names(e.die)):
+			stale(e, "DIE at 0x%x is named %q", e.die, nd.name(e.die))
+		default:
+			indexed[e.die] = true
+		}
+	}
+
+	uncovered := make(map[int64]bool)
+	for _, off := range nd.offs {
+		x := nd.dies[off]
+		k := nd.indexKind(off)
+		if k == idxKindNone || idx.want&(1<<k) == 0 {
+			continue
+		}
+		if !covered[x.cu] {
+			uncovered[x.cu] = true
+			continue
+		}
+		found := false
+		if idx.byName {
+			for _, n := range nd.names(off) {
+				found = found || byName[x.cu][n]
+			}
+		} else {
+			for _, c := range nd.chain(off) {
+				found = found || indexed[c]
+			}
+		}
+		if !found {
+			probs = append(probs, nameProblem{cu: x.cu, missing: true, name: nd.name(off), attr: "missing",
+				msg: fmt.Sprintf("no entry for %s %q at 0x%x", idxKindNames[k], nd.name(off), off)})
+		}
+	}
+	for _, off := range nd.order {
+		if !uncovered[off] {
+			continue
+		}
+		if idx.strict {
+			probs = append(probs, nameProblem{cu: off, missing: true, attr: "CU coverage", msg: "CU is not covered by the index"})
+		} else {
+			verb(1, "%s: CU at 0x%x (%s) is not covered by the index", idx.sect, off, nd.cus[off].name)
+		}
+	}
+	return probs
+}
+
+// checkNames parses each name index section present (.debug_names,
+// .gdb_index, and the .debug_pubnames family) and checks it against
+// the DIEs in .debug_info, reporting stale and missing entries per
+// CU. Returns false if problems were found.
+func checkNames(of *objFile, d *dwarf.Data) (bool, error) {
+	order := of.byteOrder()
+	funcsAndVars := 1<<idxKindFunction | 1<<idxKindVariable
+	all := funcsAndVars | 1<<idxKindType
+	var idxs []*nameIndex
+	ok := true
+	load := func(sect string, parse func(data []byte) (*nameIndex, error)) error {
+		data, err := of.sectionData(sect)
+		if err != nil || data == nil {
+			return err
+		}
+		idx, err := parse(data)
+		if err != nil {
+			if reportf("names", sect, "decode", site{}, "%s: %v", sect, err) {
+				ok = false
+			}
+			return nil
+		}
+		idxs = append(idxs, idx)
+		return nil
+	}
+	pub := func(sect string, gnu bool, kind, want int) error {
+		return load(sect, func(data []byte) (*nameIndex, error) {
+			idx, err := parsePubnames(sect, data, order, gnu, kind)
+			idx.want = want
+			return idx, err
+		})
+	}
+	if err := load(".debug_names", func(data []byte) (*nameIndex, error) {
+		str, err := of.sectionData(".debug_str")
+		if err != nil {
+			return nil, err
+		}
+		idx, err := parseDebugNames(data, str, order)
+		idx.want = all
+		return idx, err
+	}); err != nil {
+		return false, err
+	}
+	if err := load(".gdb_index", func(data []byte) (*nameIndex, error) {
+		idx, err := parseGdbIndex(data)
+		idx.want, idx.strict = all, true
+		return idx, err
+	}); err != nil {
+		return false, err
+	}
+	for _, p := range []struct {
+		sect       string
+		gnu        bool
+		kind, want int
+	}{
+		{".debug_pubnames", false, idxKindNonType, funcsAndVars},
+		{".debug_pubtypes", false, idxKindType, 1 << idxKindType},
+		{".debug_gnu_pubnames", true, 0, funcsAndVars},
+		{".debug_gnu_pubtypes", true, 0, 1 << idxKindType},
+	} {
+		if err := pub(p.sect, p.gnu, p.kind, p.want); err != nil {
+			return false, err
+		}
+	}
+	if len(idxs) == 0 {
+		verb(1, "no name index sections")
+		return ok, nil
+	}
+
+	nd, err := collectNameDIEs(of, d)
+	if err != nil {
+		return false, err
+	}
+	pos := make(map[int64]int)
+	for i, off := range nd.order {
+		pos[off] = i
+	}
+	for _, idx := range idxs {
+		var probs []nameProblem
+		for _, p := range checkNameIndex(idx, nd) {
+			name := p.name
+			var at site
+			if cu := nd.cus[p.cu]; cu != nil {
+				if name == "" {
+					name = cu.name
+				}
+				at.dies = []dwarf.Offset{cu.die}
+			}
+			if !suppressed(&finding{check: "names", name: name, attr: idx.sect + " " + p.attr, at: at}) {
+				probs = append(probs, p)
+			}
+		}
+		verb(1, "%s: checked %d entries covering %d CUs", idx.sect, len(idx.entries), len(idx.cus))
+		if len(probs) == 0 {
+			continue
+		}
+		ok = false
+		sort.SliceStable(probs, func(i, j int) bool {
+			pi, pj := -1, -1
+			if probs[i].cu >= 0 {
+				pi = pos[probs[i].cu]
+			}
+			if probs[j].cu >= 0 {
+				pj = pos[probs[j].cu]
+			}
+			return pi < pj
+		})
+		for i := 0; i < len(probs); {
+			j, nstale := i, 0
+			for ; j < len(probs) && probs[j].cu == probs[i].cu; j++ {
+				if !probs[j].missing {
+					nstale++
+				}
+			}
+			if cu := nd.cus[probs[i].cu]; cu != nil {
+				warn("%s: CU at 0x%x (%s): %d stale, %d missing entries",
+					idx.sect, cu.off, cu.name, nstale, j-i-nstale)
+			} else {
+				warn("%s:", idx.sect)
+			}
+			for ; i < j; i++ {
+				warn("  %s", probs[i].msg)
+			}
+		}
+	}
+	return ok, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLastComponent(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"main", "main"},
+		{"ns::Pt::sum", "sum"},
+		{"twice<ns::Pt>", "twice<ns::Pt>"},
+		{"ns::twice<ns::Pt>", "twice<ns::Pt>"},
+		{"(anonymous namespace)::hidden", "hidden"},
+		{"ns::operator<", "operator<"},
+		{"main.main", "main.main"},
+	} {
+		if got := lastComponent(tc.in); got != tc.want {
+			t.Errorf("lastComponent(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+// buildNamesFixture compiles testdata/names.cc with the given flags.
+func buildNamesFixture(t *testing.T, exe string, flags ...string) {
+	cxx, err := exec.LookPath("g++")
+	if err != nil {
+		t.Skip("no g++ available")
+	}
+	args := append([]string{"-g", "-o", exe}, flags...)
+	args = append(args, filepath.Join("testdata", "names.cc"))
+	if out, err := exec.Command(cxx, args...).CombinedOutput(); err != nil {
+		t.Logf("build: %s\n", out)
+		t.Fatalf("build error: %v", err)
+	}
+}
+
+func TestNameIndexes(t *testing.T) {
+	dir := t.TempDir()
+	for _, flags := range [][]string{
+		{"-O0", "-gpubnames"},
+		{"-O2", "-gpubnames"},
+		{"-O2", "-ggnu-pubnames"},
+		{"-O2", "-fuse-ld=gold", "-Wl,--gdb-index"},
+	} {
+		exe := filepath.Join(dir, "names.exe")
+		buildNamesFixture(t, exe, flags...)
+		of, d := loadObj(t, exe)
+		if of.ef == nil {
+			t.Skip("test requires ELF binaries")
+		}
+		if !of.hasSection(".debug_pubnames") && !of.hasSection(".debug_gnu_pubnames") &&
+			of.ef.Section(".gdb_index") == nil {
+			t.Logf("%v: no name index sections produced", flags)
+			continue
+		}
+		if ok, err := checkNames(of, d); err != nil || !ok {
+			t.Errorf("%v: checkNames = %v, %v", flags, ok, err)
+		}
+	}
+
+	// Rename an entry: it goes stale, and global_fn goes missing.
+	exe := filepath.Join(dir, "names.exe")
+	buildNamesFixture(t, exe, "-O0", "-gpubnames")
+	of, d := loadObj(t, exe)
+	data, err := of.sectionData(".debug_pubnames")
+	if err != nil || data == nil {
+		t.Skipf("no .debug_pubnames (%v)", err)
+	}
+	data = bytes.Replace(data, []byte("global_fn\x00"), []byte("global_fX\x00"), 1)
+	idx, err := parsePubnames(".debug_pubnames", data, of.byteOrder(), false, idxKindNonType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.want = 1<<idxKindFunction | 1<<idxKindVariable
+	nd, err := collectNameDIEs(of, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	for _, p := range checkNameIndex(idx, nd) {
+		msgs = append(msgs, p.msg)
+	}
+	if len(msgs) != 2 || !strings.Contains(msgs[0], `stale entry "global_fX"`) ||
+		!strings.Contains(msgs[1], `no entry for function "global_fn"`) {
+		t.Errorf("corrupted .debug_pubnames: got problems %q", msgs)
+	}
+}
+
+// debugNames builds a minimal .debug_names section for a single CU,
+// with one entry per name, and the .debug_str section it refers to.
+func debugNames(cu int64, names []string, tags []dwarf.Tag, dies []int64) (data, str []byte) {
+	var b []byte
+	u16 := func(v uint16) { b = append(b, byte(v), byte(v>>8)) }
+	u32 := func(v uint32) { u16(uint16(v)); u16(uint16(v >> 16)) }
+	str = []byte{0}
+	var abbrevs []byte
+	for i, tag := range tags {
+		abbrevs = append(abbrevs, byte(i+1), byte(tag), dwIdxDieOffset, dwFormRef4, 0, 0)
+	}
+	abbrevs = append(abbrevs, 0)
+	var pool []byte
+	var strOffs, entOffs []uint32
+	for i, n := range names {
+		strOffs = append(strOffs, uint32(len(str)))
+		str = append(append(str, n...), 0)
+		entOffs = append(entOffs, uint32(len(pool)))
+		d := uint32(dies[i])
+		pool = append(pool, byte(i+1), byte(d), byte(d>>8), byte(d>>16), byte(d>>24), 0)
+	}
+	u16(5) // version
+	u16(0) // padding
+	for _, v := range []uint32{1, 0, 0, 0, uint32(len(names)), uint32(len(abbrevs)), 0, uint32(cu)} {
+		u32(v)
+	}
+	for _, v := range append(strOffs, entOffs...) {
+		u32(v)
+	}
+	b = append(append(b, abbrevs...), pool...)
+	data = append([]byte{byte(len(b)), byte(len(b) >> 8), 0, 0}, b...)
+	return data, str
+}
+
+func TestDebugNames(t *testing.T) {
+	exe := filepath.Join(t.TempDir(), "names.exe")
+	buildNamesFixture(t, exe, "-O0")
+	of, d := loadObj(t, exe)
+	if of.ef == nil {
+		t.Skip("test requires ELF binaries")
+	}
+	nd, err := collectNameDIEs(of, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	find := func(name string) (cu, die int64) {
+		for _, off := range nd.offs {
+			if x := nd.dies[off]; x.name == name && x.tag == dwarf.TagSubprogram {
+				return x.cu, int64(off) - x.cu
+			}
+		}
+		t.Fatalf("no subprogram %q", name)
+		return 0, 0
+	}
+	cu, fn := find("global_fn")
+	_, mn := find("main")
+
+	// An entry for global_fn, and one for main with the wrong tag.
+	data, str := debugNames(cu, []string{"global_fn", "main"},
+		[]dwarf.Tag{dwarf.TagSubprogram, dwarf.TagVariable}, []int64{fn, mn})
+	if len(data) >= 256 {
+		t.Fatalf("test section too large")
+	}
+	idx, err := parseDebugNames(data, str, of.byteOrder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.entries) != 2 || idx.entries[0].die != dwarf.Offset(cu+fn) {
+		t.Fatalf("parseDebugNames: got entries %+v", idx.entries)
+	}
+	idx.want = 1<<idxKindFunction | 1<<idxKindVariable | 1<<idxKindType
+	var stale, missing []string
+	for _, p := range checkNameIndex(idx, nd) {
+		if p.missing {
+			missing = append(missing, p.msg)
+		} else {
+			stale = append(stale, p.msg)
+		}
+	}
+	if len(stale) != 1 || !strings.Contains(stale[0], "is a Subprogram, not a Variable") {
+		t.Errorf("stale entries: got %q", stale)
+	}
+	all := strings.Join(missing, "\n")
+	for _, want := range []string{`variable "gc"`, `variable "counter"`, `function "sum"`, `type "Pt"`, `type "point"`} {
+		if !strings.Contains(all, want) {
+			t.Errorf("missing entries: %s not reported in %q", want, missing)
+		}
+	}
+	for _, unwanted := range []string{"global_fn", "helper", "hidden", `"get"`, "Local"} {
+		if strings.Contains(all, unwanted) {
+			t.Errorf("missing entries: %s unexpectedly reported in %q", unwanted, missing)
+		}
+	}
+
+	// An entry with an undefined abbreviation code.
+	data[len(data)-6] = 9
+	if _, err := parseDebugNames(data, str, of.byteOrder()); err == nil {
+		t.Errorf("parseDebugNames accepted an unknown abbreviation code")
+	}
+}
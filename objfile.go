@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"debug/dwarf"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// objFile is a load module opened as one of the supported object
+// file flavors. Exactly one of ef, mf, pf will be non-nil.
+type objFile struct {
+	ef *elf.File
+	mf *macho.File
+	pf *pe.File
+
+	r   io.ReaderAt // the file ef, mf or pf was read from
+	df  *os.File    // separate debug file opened for ef, if any
+	exe *elf.File   // the executable, if ef is its separate debug file
+
+	code        map[interface{}][]byte // section contents read by codeBytes
+	relocWarned map[*elf.Section]bool  // sections with unapplied relocations reported
+}
+
+// close closes the separate debug file, if one was opened; the
+// caller's reader is left alone.
+func (of *objFile) close() error {
+	if of.df != nil {
+		return of.df.Close()
+	}
+	return nil
+}
+
+// loadedELF returns the ELF file to read the contents of allocated
+// sections such as .text and .eh_frame from: in a separate debug
+// file, they have none.
+func (of *objFile) loadedELF() *elf.File {
+	if of.exe != nil {
+		return of.exe
+	}
+	return of.ef
+}
+
+func (of *objFile) byteOrder() binary.ByteOrder {
+	switch {
+	case of.ef != nil:
+		return of.ef.ByteOrder
+	case of.mf != nil:
+		return of.mf.ByteOrder
+	}
+	return binary.LittleEndian
+}
+
+// dwarf returns the DWARF data for the object file.
+func (of *objFile) dwarf() (*dwarf.Data, error) {
+	switch {
+	case of.ef != nil:
+		return of.ef.DWARF()
+	case of.mf != nil:
+		return of.mf.DWARF()
+	}
+	return of.pf.DWARF()
+}
+
+// dwarfSectionNames returns the names of the object file's DWARF
+// debug sections, excluding the unwind-only .eh_frame.
+func (of *objFile) dwarfSectionNames() []string {
+	var rv []string
+	isDebug := func(n string) bool {
+		return strings.HasPrefix(n, ".debug_") || strings.HasPrefix(n, ".zdebug_")
+	}
+	switch {
+	case of.ef != nil:
+		for _, s := range of.ef.Sections {
+			if isDebug(s.Name) && s.Type != elf.SHT_NOBITS {
+				rv = append(rv, s.Name)
+			}
+		}
+	case of.mf != nil:
+		for _, s := range of.mf.Sections {
+			if strings.HasPrefix(s.Name, "__debug_") || strings.HasPrefix(s.Name, "__zdebug_") {
+				rv = append(rv, s.Name)
+			}
+		}
+	case of.pf != nil:
+		for _, s := range of.pf.Sections {
+			if isDebug(s.Name) {
+				rv = append(rv, s.Name)
+			}
+		}
+	}
+	return rv
+}
+
+// hasSection reports whether the object file has a non-empty DWARF
+// section with the given (ELF spelling) name, compressed or not.
+func (of *objFile) hasSection(name string) bool {
+	suffix := strings.TrimPrefix(name, ".debug_")
+	switch {
+	case of.ef != nil:
+		for _, n := range []string{name, ".zdebug_" + suffix} {
+			if s := of.ef.Section(n); s != nil && s.Type != elf.SHT_NOBITS && s.Size != 0 {
+				return true
+			}
+		}
+	case of.mf != nil:
+		for _, n := range []string{"__debug_" + suffix, "__zdebug_" + suffix} {
+			if len(n) > 16 {
+				n = n[:16]
+			}
+			if s := of.mf.Section(n); s != nil && s.Size != 0 {
+				return true
+			}
+		}
+	case of.pf != nil:
+		for _, s := range of.pf.Sections {
+			if (s.Name == name || s.Name == ".zdebug_"+suffix) && s.Size != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decompressZdebug expands the contents of an old-style ".zdebug_*"
+// section, which starts with "ZLIB" and a 64-bit big-endian size.
+func decompressZdebug(b []byte) ([]byte, error) {
+	if len(b) < 12 || string(b[:4]) != "ZLIB" {
+		return nil, fmt.Errorf("missing ZLIB header")
+	}
+	dlen := binary.BigEndian.Uint64(b[4:12])
+	r, err := zlib.NewReader(bytes.NewReader(b[12:]))
+	if err != nil {
+		return nil, err
+	}
+	dbuf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(dbuf)) != dlen {
+		return nil, fmt.Errorf("decompressed size %d does not match header size %d", len(dbuf), dlen)
+	}
+	return dbuf, nil
+}
+
+// elfSectionData returns the contents of ELF section 's', expanding
+// it if it is an old-style ".zdebug" section and applying any
+// relocations if the file is a relocatable object. Relocations that
+// can't be applied are reported the first time the section is read.
+func (of *objFile) elfSectionData(s *elf.Section, zdebug bool) ([]byte, error) {
+	b, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	if zdebug {
+		if b, err = decompressZdebug(b); err != nil {
+			return nil, err
+		}
+	}
+	unsupported, err := relocateSection(of.ef, s, b)
+	if err != nil {
+		return nil, err
+	}
+	if len(unsupported) != 0 && !of.relocWarned[s] {
+		if of.relocWarned == nil {
+			of.relocWarned = make(map[*elf.Section]bool)
+		}
+		of.relocWarned[s] = true
+		reportUnsupportedRelocs(of.ef, s, unsupported)
+	}
+	return b, nil
+}
+
+// sectionData returns the (decompressed) contents of the named DWARF
+// section, which is given in its ELF spelling (e.g. ".debug_info").
+// Returns nil with no error if the section is not present.
+func (of *objFile) sectionData(name string) ([]byte, error) {
+	suffix := strings.TrimPrefix(name, ".debug_")
+	switch {
+	case of.ef != nil:
+		if s := of.ef.Section(name); s != nil {
+			if s.Type == elf.SHT_NOBITS {
+				return nil, nil
+			}
+			return of.elfSectionData(s, false)
+		}
+		if s := of.ef.Section(".zdebug_" + suffix); s != nil {
+			return of.elfSectionData(s, true)
+		}
+	case of.mf != nil:
+		machoName := func(n string) string {
+			if len(n) > 16 {
+				n = n[:16]
+			}
+			return n
+		}
+		if s := of.mf.Section(machoName("__debug_" + suffix)); s != nil {
+			return s.Data()
+		}
+		if s := of.mf.Section(machoName("__zdebug_" + suffix)); s != nil {
+			b, err := s.Data()
+			if err != nil {
+				return nil, err
+			}
+			return decompressZdebug(b)
+		}
+	case of.pf != nil:
+		for _, s := range of.pf.Sections {
+			if s.Name != name && s.Name != ".zdebug_"+suffix {
+				continue
+			}
+			b, err := s.Data()
+			if err != nil && uint32(len(b)) < s.Size {
+				return nil, err
+			}
+			if 0 < s.VirtualSize && s.VirtualSize < s.Size {
+				b = b[:s.VirtualSize]
+			}
+			if s.Name != name {
+				return decompressZdebug(b)
+			}
+			return b, nil
+		}
+	}
+	return nil, nil
+}
+
+// allSectionData is like sectionData, but returns the contents of
+// every section with the given name; relocatable ELF objects may have
+// several (e.g. one .debug_types section per COMDAT group).
+func (of *objFile) allSectionData(name string) ([][]byte, error) {
+	if of.ef == nil {
+		b, err := of.sectionData(name)
+		if err != nil || b == nil {
+			return nil, err
+		}
+		return [][]byte{b}, nil
+	}
+	var rv [][]byte
+	zname := ".zdebug_" + strings.TrimPrefix(name, ".debug_")
+	for _, s := range of.ef.Sections {
+		if (s.Name != name && s.Name != zname) || s.Type == elf.SHT_NOBITS {
+			continue
+		}
+		b, err := of.elfSectionData(s, s.Name == zname)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, b)
+	}
+	return rv, nil
+}
+
+// unitHeader describes a single unit within .debug_info (or within
+// a DWARF 4 .debug_types section).
+type unitHeader struct {
+	off      int64 // offset of the unit header
+	end      int64 // offset just past the end of the unit
+	dieOff   int64 // offset of the unit's first DIE
+	version  int
+	utype    uint8 // DWARF 5 unit type, zero for earlier versions
+	addrSize int
+	is64     bool
+	sig      uint64 // type signature, for type units
+	typeOff  int64  // offset of the type DIE, for type units
+}
+
+// DWARF 5 unit types.
+const (
+	dwUtCompile      = 0x01
+	dwUtType         = 0x02
+	dwUtPartial      = 0x03
+	dwUtSkeleton     = 0x04
+	dwUtSplitCompile = 0x05
+	dwUtSplitType    = 0x06
+)
+
+// parseUnitHeaders decodes the header of each unit in the section
+// 'data'. If 'types' is set, the section is treated as a DWARF 4
+// .debug_types section.
+func parseUnitHeaders(data []byte, order binary.ByteOrder, types bool) ([]unitHeader, error) {
+	var rv []unitHeader
+	off := int64(0)
+	for off < int64(len(data)) {
+		u := unitHeader{off: off}
+		p := off
+		need := func(n int64) error {
+			if p+n > int64(len(data)) {
+				return fmt.Errorf("truncated unit header at offset 0x%x", u.off)
+			}
+			return nil
+		}
+		if err := need(4); err != nil {
+			return rv, err
+		}
+		length := int64(order.Uint32(data[p:]))
+		p += 4
+		if length == 0xffffffff {
+			if err := need(8); err != nil {
+				return rv, err
+			}
+			length = int64(order.Uint64(data[p:]))
+			p += 8
+			u.is64 = true
+		}
+		u.end = p + length
+		if u.end > int64(len(data)) || u.end < p {
+			return rv, fmt.Errorf("unit at offset 0x%x has bad length 0x%x", u.off, length)
+		}
+		offSize := int64(4)
+		if u.is64 {
+			offSize = 8
+		}
+		readOff := func() int64 {
+			if u.is64 {
+				v := int64(order.Uint64(data[p:]))
+				p += 8
+				return v
+			}
+			v := int64(order.Uint32(data[p:]))
+			p += 4
+			return v
+		}
+		if err := need(2); err != nil {
+			return rv, err
+		}
+		u.version = int(order.Uint16(data[p:]))
+		p += 2
+		if u.version >= 5 {
+			// unit_type, address_size, debug_abbrev_offset
+			if err := need(2 + offSize); err != nil {
+				return rv, err
+			}
+			u.utype = data[p]
+			u.addrSize = int(data[p+1])
+			p += 2
+			readOff()
+			switch u.utype {
+			case dwUtSkeleton, dwUtSplitCompile:
+				if err := need(8); err != nil {
+					return rv, err
+				}
+				p += 8 // dwo_id
+			case dwUtType, dwUtSplitType:
+				if err := need(8 + offSize); err != nil {
+					return rv, err
+				}
+				u.sig = order.Uint64(data[p:])
+				p += 8
+				u.typeOff = u.off + readOff()
+			}
+		} else {
+			// debug_abbrev_offset, address_size
+			if err := need(offSize + 1); err != nil {
+				return rv, err
+			}
+			readOff()
+			u.addrSize = int(data[p])
+			p++
+			if types {
+				if err := need(8 + offSize); err != nil {
+					return rv, err
+				}
+				u.sig = order.Uint64(data[p:])
+				p += 8
+				u.typeOff = u.off + readOff()
+			}
+		}
+		u.dieOff = p
+		rv = append(rv, u)
+		off = u.end
+	}
+	return rv, nil
+}
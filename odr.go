@@ -0,0 +1,250 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strings"
+)
+
+type odrCheckMode int
+
+const (
+	noOdrCheck  odrCheckMode = 0
+	yesOdrCheck odrCheckMode = 1
+)
+
+// odrVariant is one distinct layout seen for a given type name,
+// along with the CUs in which that layout appears.
+type odrVariant struct {
+	hash   uint64
+	offset dwarf.Offset // offset of first DIE with this layout
+	cus    []string
+}
+
+// odrTypeTag returns the kind string used to key a type for ODR
+// purposes, or "" if DIEs with this tag are not of interest.
+func odrTypeTag(t dwarf.Tag) string {
+	switch t {
+	case dwarf.TagStructType:
+		return "struct"
+	case dwarf.TagUnionType:
+		return "union"
+	case dwarf.TagClassType:
+		return "class"
+	case dwarf.TagTypedef:
+		return "typedef"
+	}
+	return ""
+}
+
+// isScopeTag returns true for DIEs whose name contributes to the
+// qualified name of types nested within them.
+func isScopeTag(t dwarf.Tag) bool {
+	switch t {
+	case dwarf.TagNamespace, dwarf.TagStructType, dwarf.TagUnionType, dwarf.TagClassType:
+		return true
+	}
+	return false
+}
+
+// isLocalScopeTag returns true for DIEs that introduce a function
+// local scope; types defined within such scopes are not subject to
+// the ODR (Go generic shape typedefs live there, for example).
+func isLocalScopeTag(t dwarf.Tag) bool {
+	switch t {
+	case dwarf.TagSubprogram, dwarf.TagLexDwarfBlock, dwarf.TagInlinedSubroutine:
+		return true
+	}
+	return false
+}
+
+// odrScope is an entry in the stack of enclosing DIEs maintained
+// while walking; 'name' is empty for DIEs that aren't named scopes.
+type odrScope struct {
+	name  string
+	local bool
+}
+
+// odrLayoutHash hashes the structure of a type: for aggregates the
+// size plus each member's name, position and type; for typedefs the
+// underlying type.
+func odrLayoutHash(t dwarf.Type) uint64 {
+	var sb strings.Builder
+	switch t := t.(type) {
+	case *dwarf.StructType:
+		fmt.Fprintf(&sb, "%s size=%d", t.Kind, t.ByteSize)
+		for _, f := range t.Field {
+			fmt.Fprintf(&sb, ";%s@%d", f.Name, f.ByteOffset)
+			if f.BitSize != 0 {
+				fmt.Fprintf(&sb, ":%d:%d:%d", f.BitOffset, f.DataBitOffset, f.BitSize)
+			}
+			fmt.Fprintf(&sb, ":%s", f.Type)
+		}
+	case *dwarf.TypedefType:
+		fmt.Fprintf(&sb, "typedef %s", t.Type)
+	default:
+		fmt.Fprintf(&sb, "%s", t)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(sb.String()))
+	return h.Sum64()
+}
+
+// collectODR walks all DIEs and groups the named struct, union,
+// class and typedef definitions by kind and qualified name; an
+// anonymous namespace is qualified by its CU's name. Names with
+// more than one layout within a single CU are left out: those are not
+// ODR violations, but distinct entities that DWARF gives the same
+// name, such as the instances of a member alias template. Types that
+// debug/dwarf can't decode are skipped.
+func collectODR(d *dwarf.Data) (map[string][]*odrVariant, error) {
+	variants := make(map[string][]*odrVariant)
+	// The layout of each name in each CU, by CU offset.
+	inCU := make(map[string]map[dwarf.Offset]uint64)
+	ambiguous := make(map[string]bool)
+	cuName := ""
+	var cuOff dwarf.Offset
+	var scope []odrScope
+	rdr := d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag == 0 {
+			if len(scope) > 0 {
+				scope = scope[:len(scope)-1]
+			}
+			continue
+		}
+		name, _ := ent.Val(dwarf.AttrName).(string)
+		if ent.Tag == dwarf.TagCompileUnit {
+			cuName = name
+			cuOff = ent.Offset
+		}
+		if ent.Children {
+			sc := odrScope{local: isLocalScopeTag(ent.Tag)}
+			if isScopeTag(ent.Tag) {
+				sc.name = name
+			}
+			// Types in an anonymous namespace are private to their CU.
+			// Its name, unlike its offset, is the same in other builds.
+			if ent.Tag == dwarf.TagNamespace && name == "" {
+				sc.name = "(anonymous namespace in " + cuName + ")"
+			}
+			if len(scope) > 0 && scope[len(scope)-1].local {
+				sc.local = true
+			}
+			scope = append(scope, sc)
+		}
+		kind := odrTypeTag(ent.Tag)
+		if kind == "" || name == "" {
+			continue
+		}
+		if decl, _ := ent.Val(dwarf.AttrDeclaration).(bool); decl {
+			continue
+		}
+		// Qualify the name using any enclosing named scopes
+		// (excluding the entry itself, if it was pushed above).
+		encl := scope
+		if ent.Children {
+			encl = scope[:len(scope)-1]
+		}
+		if len(encl) > 0 && encl[len(encl)-1].local {
+			continue
+		}
+		var qual []string
+		for _, s := range encl {
+			if s.name != "" {
+				qual = append(qual, s.name)
+			}
+		}
+		qual = append(qual, name)
+		key := kind + " " + strings.Join(qual, "::")
+
+		t, err := d.Type(ent.Offset)
+		if err != nil {
+			verb(1, "skipping type %q at offset 0x%x: %v", key, ent.Offset, err)
+			continue
+		}
+		if st, ok := t.(*dwarf.StructType); ok && st.Incomplete {
+			continue
+		}
+		// The Go linker emits some types as a typedef referring to
+		// another typedef of the same name; the outer one is just an
+		// alias and doesn't define a layout of its own.
+		if td, ok := t.(*dwarf.TypedefType); ok {
+			if inner, ok := td.Type.(*dwarf.TypedefType); ok && inner.Name == td.Name {
+				continue
+			}
+		}
+		h := odrLayoutHash(t)
+		if inCU[key] == nil {
+			inCU[key] = make(map[dwarf.Offset]uint64)
+		}
+		if prev, ok := inCU[key][cuOff]; ok && prev != h {
+			ambiguous[key] = true
+		}
+		inCU[key][cuOff] = h
+		var v *odrVariant
+		for _, cand := range variants[key] {
+			if cand.hash == h {
+				v = cand
+				break
+			}
+		}
+		if v == nil {
+			v = &odrVariant{hash: h, offset: ent.Offset}
+			variants[key] = append(variants[key], v)
+		}
+		if len(v.cus) == 0 || v.cus[len(v.cus)-1] != cuName {
+			v.cus = append(v.cus, cuName)
+		}
+	}
+	for key := range ambiguous {
+		verb(2, "not checking %s, which has several layouts within a CU", key)
+		delete(variants, key)
+	}
+	return variants, nil
+}
+
+// checkODR reports any type name that has more than one distinct
+// layout across the program. Returns false if violations were found.
+func checkODR(d *dwarf.Data) (bool, error) {
+	variants, err := collectODR(d)
+	if err != nil {
+		return false, err
+	}
+	keys := make([]string, 0, len(variants))
+	for k, vs := range variants {
+		if len(vs) > 1 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	nbad := 0
+	for _, k := range keys {
+		vs := variants[k]
+		var at site
+		for _, v := range vs {
+			at.dies = append(at.dies, v.offset)
+		}
+		if !reportf("odr", k, "layout", at, "ODR violation: %s has %d distinct layouts", k, len(vs)) {
+			continue
+		}
+		nbad++
+		for i, v := range vs {
+			fmt.Fprintf(os.Stderr, "  layout %d (DIE at offset 0x%x): CUs %s\n",
+				i+1, v.offset, strings.Join(v.cus, ", "))
+		}
+	}
+	verb(1, "ODR check examined %d type names, %d with conflicts",
+		len(variants), len(keys))
+	return nbad == 0, nil
+}
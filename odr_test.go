@@ -0,0 +1,78 @@
+package main
+
+import (
+	"debug/dwarf"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestODRLayoutHash(t *testing.T) {
+	intT := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 4, Name: "int"}}}
+	charT := &dwarf.CharType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 1, Name: "char"}}}
+	mk := func(f1, f2 dwarf.Type, off2 int64) *dwarf.StructType {
+		return &dwarf.StructType{
+			CommonType: dwarf.CommonType{ByteSize: 8},
+			StructName: "foo",
+			Kind:       "struct",
+			Field: []*dwarf.StructField{
+				{Name: "a", Type: f1, ByteOffset: 0},
+				{Name: "b", Type: f2, ByteOffset: off2},
+			},
+		}
+	}
+	h1 := odrLayoutHash(mk(intT, charT, 4))
+	if h2 := odrLayoutHash(mk(intT, charT, 4)); h1 != h2 {
+		t.Errorf("identical layouts hash differently")
+	}
+	if h3 := odrLayoutHash(mk(charT, intT, 4)); h1 == h3 {
+		t.Errorf("member type change not reflected in hash")
+	}
+	if h4 := odrLayoutHash(mk(intT, charT, 5)); h1 == h4 {
+		t.Errorf("member offset change not reflected in hash")
+	}
+}
+
+func TestODRSelf(t *testing.T) {
+	exe := buildSelf(t, t.TempDir(), noExtra)
+	ok, err := checkODR(loadDwarf(t, exe))
+	if err != nil {
+		t.Fatalf("checkODR: %v", err)
+	}
+	if !ok {
+		t.Errorf("unexpected ODR violations reported for Go binary")
+	}
+}
+
+func TestODRCXX(t *testing.T) {
+	cxx, err := exec.LookPath("g++")
+	if err != nil {
+		t.Skip("no g++ available")
+	}
+	exe := filepath.Join(t.TempDir(), "odr.exe")
+	cmd := exec.Command(cxx, "-g", "-gdwarf-4", "-o", exe,
+		filepath.Join("testdata", "odr1.cc"), filepath.Join("testdata", "odr2.cc"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Logf("build: %s\n", out)
+		t.Fatalf("build error: %v", err)
+	}
+	variants, err := collectODR(loadDwarf(t, exe))
+	if err != nil {
+		t.Fatalf("collectODR: %v", err)
+	}
+	var bad []string
+	for k, vs := range variants {
+		if len(vs) > 1 {
+			bad = append(bad, k)
+		}
+	}
+	if len(bad) != 1 || bad[0] != "struct S" {
+		t.Errorf("names with several layouts: %v, want [struct S]", bad)
+	}
+	for _, cu := range []string{"odr1.cc", "odr2.cc"} {
+		key := "struct (anonymous namespace in testdata/" + cu + ")::Impl"
+		if len(variants[key]) != 1 {
+			t.Errorf("%s: %d layouts, want 1", key, len(variants[key]))
+		}
+	}
+}
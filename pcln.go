@@ -0,0 +1,219 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"debug/gosym"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+type pclnCheckMode int
+
+const (
+	noPclnCheck  pclnCheckMode = 0
+	yesPclnCheck pclnCheckMode = 1
+)
+
+// pclnSamples is the maximum number of PCs per function at which
+// pclntab and the DWARF line table are compared.
+const pclnSamples = 16
+
+// lineRow is a row of the DWARF line table.
+type lineRow struct {
+	addr uint64
+	file string
+	line int
+	end  bool // DW_LNE_end_sequence
+}
+
+// dwarfLineRows returns the rows of every CU's line table, sorted by
+// address. Where several rows share an address only the last, which
+// is the one that applies, is kept.
+func dwarfLineRows(d *dwarf.Data) ([]lineRow, error) {
+	var rows []lineRow
+	rdr := d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag != dwarf.TagCompileUnit {
+			rdr.SkipChildren()
+			continue
+		}
+		lr, err := d.LineReader(ent)
+		if err != nil {
+			return nil, err
+		}
+		rdr.SkipChildren()
+		if lr == nil {
+			continue
+		}
+		var le dwarf.LineEntry
+		for {
+			if err := lr.Next(&le); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			r := lineRow{addr: le.Address, line: le.Line, end: le.EndSequence}
+			if le.File != nil {
+				r.file = le.File.Name
+			}
+			rows = append(rows, r)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].addr < rows[j].addr })
+	var rv []lineRow
+	for _, r := range rows {
+		if n := len(rv); n > 0 && rv[n-1].addr == r.addr {
+			// An end_sequence row doesn't override the start of the
+			// following sequence.
+			if r.end && !rv[n-1].end {
+				continue
+			}
+			rv[n-1] = r
+			continue
+		}
+		rv = append(rv, r)
+	}
+	return rv, nil
+}
+
+// comparePcln compares, for the function occupying [entry, end), the
+// file and line that pcToLine (i.e. pclntab) gives with the DWARF
+// line table 'rows', at up to 'max' of the DWARF row addresses in the
+// function. It returns the number of PCs compared and a description
+// of each disagreement.
+func comparePcln(entry, end uint64, rows []lineRow, pcToLine func(pc uint64) (string, int), max int) (int, []string) {
+	lo := sort.Search(len(rows), func(i int) bool { return rows[i].addr >= entry })
+	hi := sort.Search(len(rows), func(i int) bool { return rows[i].addr >= end })
+	var cand []lineRow
+	for _, r := range rows[lo:hi] {
+		if !r.end {
+			cand = append(cand, r)
+		}
+	}
+	step := 1
+	if len(cand) > max {
+		step = (len(cand) + max - 1) / max
+	}
+	n := 0
+	var bad []string
+	for i := 0; i < len(cand); i += step {
+		r := cand[i]
+		n++
+		file, line := pcToLine(r.addr)
+		if line != r.line || filepath.Clean(file) != filepath.Clean(r.file) {
+			bad = append(bad, fmt.Sprintf("at 0x%x pclntab has %s:%d, DWARF has %s:%d",
+				r.addr, file, line, r.file, r.line))
+		}
+	}
+	return n, bad
+}
+
+// goLineTable returns the Go symbol table built from the object
+// file's pclntab, or nil if it has none. Function addresses are
+// relative to runtime.text, which isn't the start of .text when the
+// program was linked by an external linker.
+func goLineTable(of *objFile) (*gosym.Table, error) {
+	var data []byte
+	var text uint64
+	var err error
+	switch {
+	case of.ef != nil:
+		s := of.loadedELF().Section(".gopclntab")
+		if s == nil || s.Type == elf.SHT_NOBITS {
+			return nil, nil
+		}
+		if data, err = s.Data(); err != nil {
+			return nil, err
+		}
+		if t := of.ef.Section(".text"); t != nil {
+			text = t.Addr
+		}
+		if syms, err := of.ef.Symbols(); err == nil {
+			for _, s := range syms {
+				if s.Name == "runtime.text" {
+					text = s.Value
+				}
+			}
+		}
+	case of.mf != nil:
+		s := of.mf.Section("__gopclntab")
+		if s == nil {
+			return nil, nil
+		}
+		if data, err = s.Data(); err != nil {
+			return nil, err
+		}
+		if t := of.mf.Section("__text"); t != nil {
+			text = t.Addr
+		}
+		if of.mf.Symtab != nil {
+			for _, s := range of.mf.Symtab.Syms {
+				if s.Name == "runtime.text" {
+					text = s.Value
+				}
+			}
+		}
+	default:
+		return nil, nil
+	}
+	return gosym.NewTable(nil, gosym.NewLineTable(data, text))
+}
+
+// checkPcln compares the Go pclntab's file and line information with
+// the DWARF line table at a sample of PCs in each function, and
+// reports the functions where they disagree. Returns false if
+// problems were found.
+func checkPcln(of *objFile, d *dwarf.Data) (bool, error) {
+	tab, err := goLineTable(of)
+	if err != nil {
+		return false, fmt.Errorf("reading pclntab: %v", err)
+	}
+	if tab == nil {
+		verb(1, "no Go pclntab")
+		return true, nil
+	}
+	rows, err := dwarfLineRows(d)
+	if err != nil {
+		return false, err
+	}
+	pcToLine := func(pc uint64) (string, int) {
+		file, line, _ := tab.PCToLine(pc)
+		return file, line
+	}
+	ok := true
+	nfunc, npc, nbad := 0, 0, 0
+	for i := range tab.Funcs {
+		fn := &tab.Funcs[i]
+		n, bad := comparePcln(fn.Entry, fn.End, rows, pcToLine, pclnSamples)
+		if n == 0 {
+			verb(2, "%s: no DWARF line rows", fn.Name)
+			continue
+		}
+		nfunc++
+		npc += n
+		if len(bad) == 0 {
+			continue
+		}
+		nbad++
+		if !reportf("pcln", fn.Name, "line table", site{fn: fn.Name, pc: fn.Entry}, "%s: pclntab and DWARF line table disagree at %d of %d sampled PCs; first %s",
+			fn.Name, len(bad), n, bad[0]) {
+			continue
+		}
+		ok = false
+		for _, b := range bad[1:] {
+			verb(1, "  %s", b)
+		}
+	}
+	verb(1, "compared pclntab and DWARF at %d PCs in %d functions; %d functions disagree", npc, nfunc, nbad)
+	return ok, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComparePcln(t *testing.T) {
+	rows := []lineRow{
+		{addr: 0x1000, file: "a.go", line: 10},
+		{addr: 0x1008, file: "a.go", line: 11},
+		{addr: 0x1010, file: "b.go", line: 3},
+		{addr: 0x1018, end: true},
+		{addr: 0x2000, file: "c.go", line: 1},
+	}
+	pcln := map[uint64]int{0x1000: 10, 0x1008: 12, 0x1010: 3}
+	pcToLine := func(pc uint64) (string, int) {
+		if pc == 0x1010 {
+			return "b.go", pcln[pc]
+		}
+		return "a.go", pcln[pc]
+	}
+	n, bad := comparePcln(0x1000, 0x1020, rows, pcToLine, 16)
+	if n != 3 || len(bad) != 1 || !strings.Contains(bad[0], "pclntab has a.go:12, DWARF has a.go:11") {
+		t.Errorf("comparePcln = %d, %q", n, bad)
+	}
+	if n, _ := comparePcln(0x1000, 0x1020, rows, pcToLine, 2); n != 2 {
+		t.Errorf("comparePcln with 2 samples compared %d PCs", n)
+	}
+}
+
+func TestCheckPcln(t *testing.T) {
+	exe := buildSelf(t, t.TempDir(), noExtra)
+	of, d := loadObj(t, exe)
+	if ok, err := checkPcln(of, d); err != nil || !ok {
+		t.Errorf("checkPcln = %v, %v", ok, err)
+	}
+}
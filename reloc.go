@@ -0,0 +1,195 @@
+package main
+
+import (
+	"debug/elf"
+	"fmt"
+	"sort"
+)
+
+// relocWidth returns the number of bytes patched by an absolute
+// relocation of type 'typ' for machine 'm', or 0 if we don't know how
+// to apply it. Only the data relocations compilers emit into debug
+// sections are handled.
+func relocWidth(m elf.Machine, typ uint32) int {
+	switch m {
+	case elf.EM_X86_64:
+		switch elf.R_X86_64(typ) {
+		case elf.R_X86_64_64:
+			return 8
+		case elf.R_X86_64_32, elf.R_X86_64_32S:
+			return 4
+		}
+	case elf.EM_386:
+		if elf.R_386(typ) == elf.R_386_32 {
+			return 4
+		}
+	case elf.EM_AARCH64:
+		switch elf.R_AARCH64(typ) {
+		case elf.R_AARCH64_ABS64:
+			return 8
+		case elf.R_AARCH64_ABS32:
+			return 4
+		}
+	case elf.EM_ARM:
+		if elf.R_ARM(typ) == elf.R_ARM_ABS32 {
+			return 4
+		}
+	case elf.EM_PPC64:
+		switch elf.R_PPC64(typ) {
+		case elf.R_PPC64_ADDR64:
+			return 8
+		case elf.R_PPC64_ADDR32:
+			return 4
+		}
+	case elf.EM_RISCV:
+		switch elf.R_RISCV(typ) {
+		case elf.R_RISCV_64:
+			return 8
+		case elf.R_RISCV_32:
+			return 4
+		}
+	case elf.EM_S390:
+		switch elf.R_390(typ) {
+		case elf.R_390_64:
+			return 8
+		case elf.R_390_32:
+			return 4
+		}
+	}
+	return 0
+}
+
+// relocTypeName returns a printable name for relocation type 'typ'.
+func relocTypeName(m elf.Machine, typ uint32) string {
+	switch m {
+	case elf.EM_X86_64:
+		return elf.R_X86_64(typ).String()
+	case elf.EM_386:
+		return elf.R_386(typ).String()
+	case elf.EM_AARCH64:
+		return elf.R_AARCH64(typ).String()
+	case elf.EM_ARM:
+		return elf.R_ARM(typ).String()
+	case elf.EM_PPC64:
+		return elf.R_PPC64(typ).String()
+	case elf.EM_RISCV:
+		return elf.R_RISCV(typ).String()
+	case elf.EM_S390:
+		return elf.R_390(typ).String()
+	}
+	return fmt.Sprintf("%v type %d", m, typ)
+}
+
+// relocateSection applies the relocations that target section 'sect'
+// of the relocatable (ET_REL) file 'ef' to 'data', its contents. The
+// debug/elf package does this itself when building a dwarf.Data, but
+// not for section contents we read directly. Relocations of types we
+// don't handle are left unapplied, and counted by type in the result.
+func relocateSection(ef *elf.File, sect *elf.Section, data []byte) (map[uint32]int, error) {
+	if ef.Type != elf.ET_REL {
+		return nil, nil
+	}
+	var idx uint32
+	for i, s := range ef.Sections {
+		if s == sect {
+			idx = uint32(i)
+		}
+	}
+	var syms []elf.Symbol
+	unsupported := make(map[uint32]int)
+	order := ef.ByteOrder
+	for _, rs := range ef.Sections {
+		if (rs.Type != elf.SHT_RELA && rs.Type != elf.SHT_REL) || rs.Info != idx {
+			continue
+		}
+		if syms == nil {
+			var err error
+			if syms, err = ef.Symbols(); err != nil {
+				return nil, err
+			}
+		}
+		rels, err := rs.Data()
+		if err != nil {
+			return nil, err
+		}
+		rela := rs.Type == elf.SHT_RELA
+		entSize := 8
+		if ef.Class == elf.ELFCLASS64 {
+			entSize = 16
+		}
+		if rela {
+			entSize += entSize / 2
+		}
+		if len(rels)%entSize != 0 {
+			return nil, fmt.Errorf("%s: size %d is not a multiple of %d", rs.Name, len(rels), entSize)
+		}
+		for p := 0; p < len(rels); p += entSize {
+			var off uint64
+			var symNo, typ uint32
+			var addend int64
+			if ef.Class == elf.ELFCLASS64 {
+				off = order.Uint64(rels[p:])
+				info := order.Uint64(rels[p+8:])
+				symNo, typ = uint32(info>>32), uint32(info&0xffffffff)
+				if rela {
+					addend = int64(order.Uint64(rels[p+16:]))
+				}
+			} else {
+				off = uint64(order.Uint32(rels[p:]))
+				info := order.Uint32(rels[p+4:])
+				symNo, typ = info>>8, info&0xff
+				if rela {
+					addend = int64(int32(order.Uint32(rels[p+8:])))
+				}
+			}
+			if typ == 0 {
+				continue // R_*_NONE
+			}
+			w := relocWidth(ef.Machine, typ)
+			if w == 0 {
+				unsupported[typ]++
+				continue
+			}
+			if off+uint64(w) > uint64(len(data)) {
+				return nil, fmt.Errorf("%s: relocation at offset 0x%x is outside %s", rs.Name, off, sect.Name)
+			}
+			if symNo == 0 || symNo > uint32(len(syms)) {
+				continue
+			}
+			sym := &syms[symNo-1]
+			if sym.Section == elf.SHN_UNDEF || sym.Section >= elf.SHN_LORESERVE {
+				continue
+			}
+			if !rela {
+				if w == 8 {
+					addend = int64(order.Uint64(data[off:]))
+				} else {
+					addend = int64(int32(order.Uint32(data[off:])))
+				}
+			}
+			v := sym.Value + uint64(addend)
+			if w == 8 {
+				order.PutUint64(data[off:], v)
+			} else {
+				order.PutUint32(data[off:], uint32(v))
+			}
+		}
+	}
+	return unsupported, nil
+}
+
+// reportUnsupportedRelocs reports the relocations of section 'sect' that
+// relocateSection left unapplied, counted by type in 'unsupported'.
+func reportUnsupportedRelocs(ef *elf.File, sect *elf.Section, unsupported map[uint32]int) {
+	var types []uint32
+	for typ := range unsupported {
+		types = append(types, typ)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	for _, typ := range types {
+		n := unsupported[typ]
+		name := relocTypeName(ef.Machine, typ)
+		reportf("reloc", sect.Name, name, site{}, "section %s: %d relocations of unsupported type %s not applied",
+			sect.Name, n, name)
+	}
+}
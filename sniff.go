@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// objFormat identifies an object file format by its magic number.
+type objFormat int
+
+const (
+	unknownFormat objFormat = iota
+	elfFormat
+	machoFormat
+	fatFormat
+	peFormat
+)
+
+func (f objFormat) String() string {
+	switch f {
+	case elfFormat:
+		return "ELF"
+	case machoFormat:
+		return "Macho"
+	case fatFormat:
+		return "Macho universal binary"
+	case peFormat:
+		return "PE"
+	}
+	return "unknown"
+}
+
+// sniffFormat determines the format of the object file 'r' from the
+// magic bytes at its start.
+func sniffFormat(r io.ReaderAt) objFormat {
+	var magic [4]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return unknownFormat
+	}
+	switch {
+	case bytes.Equal(magic[:], []byte("\x7fELF")):
+		return elfFormat
+	case magic[0] == 'M' && magic[1] == 'Z':
+		return peFormat
+	}
+	switch binary.BigEndian.Uint32(magic[:]) {
+	case 0xfeedface, 0xfeedfacf, 0xcefaedfe, 0xcffaedfe:
+		return machoFormat
+	case 0xcafebabe:
+		return fatFormat
+	}
+	return unknownFormat
+}
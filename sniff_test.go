@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestSniffFormat(t *testing.T) {
+	for _, tc := range []struct {
+		magic string
+		want  objFormat
+	}{
+		{"\x7fELF\x02\x01", elfFormat},
+		{"\xcf\xfa\xed\xfe", machoFormat},
+		{"\xfe\xed\xfa\xce", machoFormat},
+		{"\xca\xfe\xba\xbe", fatFormat},
+		{"MZ\x90\x00", peFormat},
+		{"hello world", unknownFormat},
+		{"", unknownFormat},
+	} {
+		if got := sniffFormat(bytes.NewReader([]byte(tc.magic))); got != tc.want {
+			t.Errorf("sniffFormat(%q) = %v, want %v", tc.magic, got, tc.want)
+		}
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	exe := buildFixture(t, dir, "layout.go", "-ldflags=-compressdwarf=false")
+	ef, err := elf.Open(exe)
+	if err != nil {
+		t.Skip("test requires ELF binaries")
+	}
+	info := ef.Section(".debug_info")
+	// The offset of the second DIE, within the first CU.
+	d, err := ef.DWARF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr := d.Reader()
+	rdr.Next()
+	second, err := rdr.Next()
+	if err != nil || second == nil {
+		t.Fatalf("reading second DIE: %v", err)
+	}
+	ef.Close()
+	content, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(name string, b []byte) string {
+		out := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(out, b, 0755); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	// Bump the first unit's version to one nobody supports.
+	badver := append([]byte(nil), content...)
+	badver[info.Offset+4] = 99
+	// Give a DIE past the unit header an abbreviation nobody defines.
+	badabbrev := append([]byte(nil), content...)
+	badabbrev[info.Offset+uint64(second.Offset)] = 0x7f
+
+	cases := []struct {
+		file string
+		want int
+	}{
+		{exe, exitOK},
+		{write("notobj.txt", []byte("not an object file\n")), exitNotObject},
+		{filepath.Join(dir, "nonexistent"), exitNotObject},
+		{buildFixture(t, t.TempDir(), "layout.go", "-ldflags=-w"), exitNoDWARF},
+		{write("badver.exe", badver), exitParseError},
+		{write("badabbrev.exe", badabbrev), exitParseError},
+	}
+	if objcopy, err := exec.LookPath("objcopy"); err == nil {
+		noinfo := filepath.Join(dir, "noinfo.exe")
+		if out, err := exec.Command(objcopy, "--remove-section=.debug_info", exe, noinfo).CombinedOutput(); err != nil {
+			t.Logf("objcopy: %s\n", out)
+			t.Fatalf("objcopy: %v", err)
+		}
+		cases = append(cases, struct {
+			file string
+			want int
+		}{noinfo, exitNoDebugInfo})
+	}
+
+	save := st
+	defer func() { st = save }()
+	for _, tc := range cases {
+		st = exitOK
+		ok := examineFile(tc.file, options{dc: yesDoAbsChecks})
+		if ok != (tc.want == exitOK) || st != tc.want {
+			t.Errorf("%s: examineFile = %v with exit status %d, want %d",
+				filepath.Base(tc.file), ok, st, tc.want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"sort"
+)
+
+type symsCheckMode int
+
+const (
+	noSymsCheck  symsCheckMode = 0
+	yesSymsCheck symsCheckMode = 1
+)
+
+// startupFuncs are functions that the C runtime's startup files
+// (crt1.o, crti.o, crtbegin.o and friends) add to .text, and markers
+// defined by the Go linker. None of these have debug info, so they
+// are not reported.
+var startupFuncs = map[string]bool{
+	"_start":                  true,
+	"_init":                   true,
+	"_fini":                   true,
+	"_dl_relocate_static_pie": true,
+	"deregister_tm_clones":    true,
+	"register_tm_clones":      true,
+	"__do_global_dtors_aux":   true,
+	"frame_dummy":             true,
+	"__libc_csu_init":         true,
+	"__libc_csu_fini":         true,
+	"runtime.text":            true,
+	"runtime.etext":           true,
+	"go:textfipsstart":        true,
+	"go:textfipsend":          true,
+}
+
+// funcSym is an STT_FUNC symbol defined in .text.
+type funcSym struct {
+	name  string
+	value uint64
+	size  uint64
+}
+
+// dwarfFunc is a subprogram DIE with code.
+type dwarfFunc struct {
+	off    dwarf.Offset
+	name   string
+	lowpc  uint64
+	highpc uint64 // zero if the subprogram uses DW_AT_ranges
+	ranges [][2]uint64
+}
+
+// collectDwarfFuncs returns the subprograms in 'd' that have code.
+// Subprograms whose code was discarded by the linker (low_pc zero)
+// are skipped.
+func collectDwarfFuncs(d *dwarf.Data) ([]dwarfFunc, error) {
+	var rv []dwarfFunc
+	rdr := d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag != dwarf.TagSubprogram {
+			continue
+		}
+		if ent.Val(dwarf.AttrLowpc) == nil && ent.Val(dwarf.AttrRanges) == nil {
+			continue
+		}
+		ranges, err := d.Ranges(ent)
+		if err != nil {
+			return nil, fmt.Errorf("subprogram at 0x%x: %v", ent.Offset, err)
+		}
+		f := dwarfFunc{off: ent.Offset, ranges: mergeRanges(ranges)}
+		if len(f.ranges) == 0 {
+			continue
+		}
+		f.name, _ = ent.Val(dwarf.AttrName).(string)
+		if f.name == "" {
+			if origin, ok := ent.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset); ok {
+				f.name = subprogramName(d, origin)
+			} else if spec, ok := ent.Val(dwarf.AttrSpecification).(dwarf.Offset); ok {
+				f.name = subprogramName(d, spec)
+			}
+		}
+		if lo, ok := ent.Val(dwarf.AttrLowpc).(uint64); ok && lo != 0 {
+			f.lowpc = lo
+			if len(ranges) == 1 {
+				f.highpc = ranges[0][1]
+			}
+		}
+		rv = append(rv, f)
+	}
+	return rv, nil
+}
+
+// subprogramName returns the name of the subprogram DIE at 'off', or
+// "" if it can't be read.
+func subprogramName(d *dwarf.Data, off dwarf.Offset) string {
+	rdr := d.Reader()
+	rdr.Seek(off)
+	ent, err := rdr.Next()
+	if err != nil || ent == nil {
+		return ""
+	}
+	name, _ := ent.Val(dwarf.AttrName).(string)
+	return name
+}
+
+// checkSyms compares the STT_FUNC symbols in .text against the
+// DWARF subprograms, reporting functions with no debug info,
+// subprograms whose low_pc matches no symbol, and subprograms whose
+// extent differs from the symbol's size. Returns false if problems
+// were found.
+func checkSyms(of *objFile, d *dwarf.Data) (bool, error) {
+	if of.ef == nil {
+		verb(1, "skipping symbol check for non-ELF file")
+		return true, nil
+	}
+	if of.ef.Type == elf.ET_REL {
+		verb(1, "skipping symbol check for relocatable object")
+		return true, nil
+	}
+	text := of.ef.Section(".text")
+	if text == nil {
+		verb(1, "no .text section")
+		return true, nil
+	}
+	elfsyms, err := of.ef.Symbols()
+	if err == elf.ErrNoSymbols {
+		verb(1, "no symbol table")
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var syms []funcSym
+	for _, s := range elfsyms {
+		if elf.ST_TYPE(s.Info) != elf.STT_FUNC || s.Value == 0 ||
+			int(s.Section) >= len(of.ef.Sections) || of.ef.Sections[s.Section] != text {
+			continue
+		}
+		syms = append(syms, funcSym{name: s.Name, value: s.Value, size: s.Size})
+	}
+	sort.SliceStable(syms, func(i, j int) bool { return syms[i].value < syms[j].value })
+	symsAt := make(map[uint64][]funcSym)
+	for _, s := range syms {
+		symsAt[s.value] = append(symsAt[s.value], s)
+	}
+
+	funcs, err := collectDwarfFuncs(d)
+	if err != nil {
+		return false, err
+	}
+	var all [][2]uint64
+	for _, f := range funcs {
+		all = append(all, f.ranges...)
+	}
+	covered := mergeRanges(all)
+
+	ok := true
+	nodwarf := 0
+	for i, s := range syms {
+		if i > 0 && syms[i-1].value == s.value {
+			continue // an alias
+		}
+		j := sort.Search(len(covered), func(j int) bool { return covered[j][1] > s.value })
+		if j < len(covered) && covered[j][0] <= s.value {
+			continue
+		}
+		if startupFuncs[s.name] {
+			verb(1, "startup function %s at 0x%x has no DWARF", s.name, s.value)
+			continue
+		}
+		nodwarf++
+		if reportf("syms", s.name, "no DWARF", site{fn: s.name, pc: s.value}, "function %s at 0x%x (size %d) has no DWARF subprogram", s.name, s.value, s.size) {
+			ok = false
+		}
+	}
+
+	nosym, badsize := 0, 0
+	for _, f := range funcs {
+		if f.lowpc == 0 {
+			continue
+		}
+		at := symsAt[f.lowpc]
+		what := fmt.Sprintf("subprogram at 0x%x", f.off)
+		if f.name != "" {
+			what = fmt.Sprintf("subprogram %s at 0x%x", f.name, f.off)
+		}
+		if len(at) == 0 {
+			nosym++
+			if reportf("syms", f.name, "no symbol", site{fn: f.name, dies: []dwarf.Offset{f.off}}, "%s: low_pc 0x%x matches no function symbol", what, f.lowpc) {
+				ok = false
+			}
+			continue
+		}
+		if f.highpc == 0 {
+			continue
+		}
+		size := f.highpc - f.lowpc
+		match := false
+		for _, s := range at {
+			match = match || s.size == size || s.size == 0
+		}
+		if !match {
+			badsize++
+			if reportf("syms", f.name, "size", site{fn: f.name, dies: []dwarf.Offset{f.off}}, "%s: DWARF range [0x%x,0x%x) is %d bytes, but symbol %s has size %d",
+				what, f.lowpc, f.highpc, size, at[0].name, at[0].size) {
+				ok = false
+			}
+		}
+	}
+	verb(1, "checked %d function symbols against %d subprograms: %d without DWARF, %d subprograms without symbols, %d size mismatches",
+		len(syms), len(funcs), nodwarf, nosym, badsize)
+	return ok, nil
+}
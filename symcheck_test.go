@@ -0,0 +1,75 @@
+package main
+
+import (
+	"debug/elf"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckSyms(t *testing.T) {
+	cc, err := exec.LookPath("gcc")
+	if err != nil {
+		t.Skip("no gcc available")
+	}
+	dir := t.TempDir()
+	build := func(exe string, args ...string) {
+		args = append([]string{"-o", exe}, args...)
+		if out, err := exec.Command(cc, args...).CombinedOutput(); err != nil {
+			t.Logf("build: %s\n", out)
+			t.Fatalf("build error: %v", err)
+		}
+	}
+	a := filepath.Join(dir, "a.o")
+	b := filepath.Join(dir, "b.o")
+	build(a, "-g", "-O2", "-c", "-DSUFFIX=a", filepath.Join("testdata", "reloc.c"))
+	build(b, "-g", "-O2", "-c", "-DSUFFIX=b", filepath.Join("testdata", "reloc.c"))
+	main := filepath.Join("testdata", "relocmain.c")
+	exe := filepath.Join(dir, "syms.exe")
+	build(exe, "-g", main, a, b)
+	of, d := loadObj(t, exe)
+	if of.ef == nil {
+		t.Skip("test requires ELF binaries")
+	}
+	if ok, err := checkSyms(of, d); err != nil || !ok {
+		t.Errorf("checkSyms = %v, %v", ok, err)
+	}
+
+	// workb has no debug info when b.o is built without -g.
+	build(b, "-g0", "-O2", "-c", "-DSUFFIX=b", filepath.Join("testdata", "reloc.c"))
+	nodebug := filepath.Join(dir, "nodebug.exe")
+	build(nodebug, "-g", main, a, b)
+	of, d = loadObj(t, nodebug)
+	if ok, err := checkSyms(of, d); err != nil || ok {
+		t.Errorf("checkSyms with undescribed function = %v, %v", ok, err)
+	}
+
+	// Change the symbol size for main.
+	of, _ = loadObj(t, exe)
+	syms, err := of.ef.Symbols()
+	if err != nil || of.ef.Class != elf.ELFCLASS64 {
+		t.Skipf("unexpected symbol table (%v)", err)
+	}
+	content, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	symtab := of.ef.Section(".symtab")
+	order := of.byteOrder()
+	for i, s := range syms {
+		if s.Name == "main" {
+			// Symbols() omits the null symbol at index 0.
+			p := symtab.Offset + uint64(i+1)*24 + 16
+			order.PutUint64(content[p:], s.Size+4)
+		}
+	}
+	bad := filepath.Join(dir, "badsize.exe")
+	if err := ioutil.WriteFile(bad, content, 0755); err != nil {
+		t.Fatal(err)
+	}
+	of, d = loadObj(t, bad)
+	if ok, err := checkSyms(of, d); err != nil || ok {
+		t.Errorf("checkSyms with bad symbol size = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,47 @@
+// Fixture for TestLayoutCXX.
+
+struct Base {
+  long x;
+};
+
+// Occupied by Base up to offset 8; only the 4 bytes after 'y' are
+// padding.
+struct Derived : Base {
+  int y;
+};
+
+struct Empty {};
+
+// The empty base takes up no space.
+struct OnEmpty : Empty {
+  int z;
+};
+
+// Bit fields at data bit offset 0.
+struct Bits {
+  unsigned a : 3;
+  char c;
+  int i;
+};
+
+// With -gdwarf-4, 'top' has a DW_AT_bit_offset of zero, and takes up
+// its whole storage unit.
+struct HighBits {
+  unsigned : 29;
+  unsigned top : 3;
+  int i;
+};
+
+// With -gdwarf-4, debug/dwarf can't decode char16_t.
+struct Wide {
+  char16_t w;
+  int i;
+};
+
+Derived d;
+OnEmpty e;
+Bits b;
+Wide w;
+HighBits h;
+
+int main() { return d.y + e.z + b.i + w.i + h.i; }
@@ -0,0 +1,19 @@
+package main
+
+// holey has a 7 byte hole after 'a' and 7 bytes of tail padding.
+type holey struct {
+	a int8
+	b int64
+	c int8
+}
+
+var sink holey
+
+//go:noinline
+func use(h holey) {
+	sink = h
+}
+
+func main() {
+	use(holey{a: 1, b: 2, c: 3})
+}
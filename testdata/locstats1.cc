@@ -0,0 +1,20 @@
+// Fixture for TestLocStatsCXX: f is overloaded, and helper is a
+// static function of the same name as one in locstats2.cc.
+static int helper(int a) {
+  int b = a * 2;
+  return b + 1;
+}
+
+int f(int x) {
+  int y = x + 1;
+  return helper(y);
+}
+
+int f(double x) {
+  double y = x * 2;
+  return int(y);
+}
+
+int other(int);
+
+int main() { return f(1) + f(2.0) + other(3); }
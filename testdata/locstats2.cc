@@ -0,0 +1,8 @@
+// Fixture for TestLocStatsCXX: helper is a static function of the
+// same name as one in locstats1.cc.
+static int helper(int a) {
+  long c = a - 3;
+  return int(c);
+}
+
+int other(int z) { return helper(z); }
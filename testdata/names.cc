@@ -0,0 +1,21 @@
+// Fixture for the name index checks: functions, variables and types
+// at namespace scope, plus things that needn't be indexed.
+namespace ns {
+struct Pt { int x, y; int sum() const; };
+int Pt::sum() const { return x + y; }
+int counter;
+enum Color { Red, Green };
+}
+namespace {
+int hidden(int v) { return v - 1; }
+}
+typedef ns::Pt point;
+static int helper(int v) { return v * 2; }
+int global_fn(point *p) {
+  struct Local { int get() const { return 3; } };
+  Local l;
+  return helper(p->sum()) + hidden(ns::counter) + l.get();
+}
+template <typename T> T twice(T v) { return v + v; }
+ns::Color gc = ns::Green;
+int main() { point p = {1, 2}; return global_fn(&p) + twice(3) + twice(1L); }
@@ -0,0 +1,24 @@
+// Fixture for TestODRCXX: S is defined differently in odr2.cc;
+// the Impls are distinct types.
+#include <map>
+#include <string>
+
+struct S {
+  int a;
+};
+
+std::map<std::string, int> m1;
+char16_t c1;
+S s1;
+
+namespace {
+struct Impl {
+  int x;
+};
+}  // namespace
+
+Impl i1;
+
+int other();
+
+int main() { return s1.a + i1.x + m1.size() + c1 + other(); }
@@ -0,0 +1,22 @@
+// Fixture for TestODRCXX: S is defined differently in odr1.cc;
+// the Impls are distinct types.
+#include <map>
+#include <string>
+
+struct S {
+  long a;
+  int b;
+};
+
+std::map<std::string, long> m2;
+S s2;
+
+namespace {
+struct Impl {
+  double y;
+};
+}  // namespace
+
+Impl i2;
+
+int other() { return s2.b + int(i2.y) + m2.size(); }
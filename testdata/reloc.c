@@ -0,0 +1,18 @@
+/* Fixture for relocatable object tests; compile with -DSUFFIX=x to
+   get a second object with distinct symbol names. */
+
+#define CAT2(a, b) a##b
+#define CAT(a, b) CAT2(a, b)
+#define NAME(n) CAT(n, SUFFIX)
+
+extern int sink(int);
+
+int NAME(counter);
+
+int NAME(work)(int n)
+{
+  int acc = 0;
+  for (int i = 0; i < n; i++)
+    acc += sink(i * NAME(counter));
+  return sink(acc) + n;
+}
@@ -0,0 +1,14 @@
+/* Main program for linking the testdata/reloc.c objects. */
+
+extern int worka(int);
+extern int workb(int);
+
+int sink(int x)
+{
+  return x + 1;
+}
+
+int main(void)
+{
+  return worka(3) + workb(4);
+}
@@ -0,0 +1,5 @@
+struct S { int a; long b; };
+struct T { S s; char c; };
+T gt;
+int f(S *s) { return s->a; }
+int main() { return f(&gt.s); }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/thanm/dwarf-check/dwexaminer"
+)
+
+// typesAsInfo rewrites the DWARF 4 type units 'units' of a
+// .debug_types section as compile units, by dropping the signature and
+// type offset from their headers, so that debug/dwarf can read their
+// DIEs. Returns the rewritten section and, for each unit, by how much
+// the offsets of its DIEs decrease.
+func typesAsInfo(data []byte, order binary.ByteOrder, units []unitHeader) ([]byte, []int64) {
+	var rv []byte
+	shifts := make([]int64, len(units))
+	for i, u := range units {
+		// unit_length, version, debug_abbrev_offset, address_size
+		lenSize, offSize := int64(4), int64(4)
+		if u.is64 {
+			lenSize, offSize = 12, 8
+		}
+		hdr := append([]byte(nil), data[u.off:u.off+lenSize+2+offSize+1]...)
+		drop := 8 + offSize // type_signature, type_offset
+		if u.is64 {
+			order.PutUint64(hdr[4:], uint64(u.end-u.off-lenSize-drop))
+		} else {
+			order.PutUint32(hdr, uint32(u.end-u.off-lenSize-drop))
+		}
+		rv = append(rv, hdr...)
+		shifts[i] = u.dieOff - int64(len(rv))
+		rv = append(rv, data[u.dieOff:u.end]...)
+	}
+	return rv, shifts
+}
+
+// indexTypeUnits registers with 'ds' the type units found in any
+// .debug_types sections (DWARF 4) and within .debug_info (DWARF 5).
+// The DIEs in each .debug_types section are indexed by an examiner of
+// their own.
+func indexTypeUnits(of *objFile, ds *dwexaminer.DwExaminer) (int, error) {
+	n := 0
+	add := func(sect string, data []byte, types bool) error {
+		units, err := parseUnitHeaders(data, of.byteOrder(), types)
+		if err != nil {
+			return fmt.Errorf("%s: %v", sect, err)
+		}
+		var dies *dwexaminer.DwExaminer
+		var shifts []int64
+		if types && len(units) != 0 {
+			if dies, shifts, err = examineTypesSection(of, data, units); err != nil {
+				return fmt.Errorf("%s: %v", sect, err)
+			}
+		}
+		for i, u := range units {
+			if !types && u.utype != dwUtType && u.utype != dwUtSplitType {
+				continue
+			}
+			tu := dwexaminer.TypeUnit{
+				Section:    sect,
+				Offset:     dwarf.Offset(u.off),
+				Signature:  u.sig,
+				TypeOffset: dwarf.Offset(u.typeOff),
+			}
+			if dies != nil {
+				tu.DIEs = dies
+				tu.DIEOffset = dwarf.Offset(u.typeOff - shifts[i])
+			}
+			ds.AddTypeUnit(tu)
+			n++
+		}
+		return nil
+	}
+	typesSects, err := of.allSectionData(".debug_types")
+	if err != nil {
+		return n, err
+	}
+	for _, data := range typesSects {
+		if err := add(".debug_types", data, true); err != nil {
+			return n, err
+		}
+	}
+	info, err := of.sectionData(".debug_info")
+	if err != nil {
+		return n, err
+	}
+	return n, add(".debug_info", info, false)
+}
+
+// examineTypesSection reads the DIEs of the .debug_types section
+// 'data', whose units are 'units'. Returns an examiner over them and
+// the shift of each unit's offsets, as from typesAsInfo.
+func examineTypesSection(of *objFile, data []byte, units []unitHeader) (*dwexaminer.DwExaminer, []int64, error) {
+	abbrev, err := of.sectionData(".debug_abbrev")
+	if err != nil {
+		return nil, nil, err
+	}
+	str, err := of.sectionData(".debug_str")
+	if err != nil {
+		return nil, nil, err
+	}
+	info, shifts := typesAsInfo(data, of.byteOrder(), units)
+	d, err := dwarf.New(abbrev, nil, nil, info, nil, nil, nil, str)
+	if err != nil {
+		return nil, nil, err
+	}
+	dies, err := dwexaminer.NewDwExaminer(d.Reader())
+	if err != nil {
+		return nil, nil, err
+	}
+	return dies, shifts, nil
+}
+
+// checkSignatures verifies that each type signature referenced via
+// DW_FORM_ref_sig8 (recorded in 'refs' along with the referring DIEs)
+// is defined by exactly one type unit, and that the unit's type
+// offset refers to a type DIE. Returns false on failure.
+func checkSignatures(ds *dwexaminer.DwExaminer, refs map[uint64][]dwarf.Offset) bool {
+	sigs := make([]uint64, 0, len(refs))
+	for sig := range refs {
+		sigs = append(sigs, sig)
+	}
+	sort.Slice(sigs, func(i, j int) bool { return sigs[i] < sigs[j] })
+	ok := true
+	for _, sig := range sigs {
+		from := refs[sig]
+		tus := ds.TypeUnits(sig)
+		name := fmt.Sprintf("0x%x", sig)
+		if len(tus) != 1 {
+			if reportf("typesig", name, "type units", site{dies: from},
+				"type signature 0x%x referenced from %d DIE(s) (first at offset 0x%x) has %d defining type units",
+				sig, len(from), from[0], len(tus)) {
+				ok = false
+			}
+			continue
+		}
+		ent, _, err := ds.ResolveSignature(sig)
+		if err == nil && !isIndexTypeTag(ent.Tag) {
+			err = fmt.Errorf("DIE is a %v", ent.Tag)
+		}
+		if err != nil {
+			if reportf("typesig", name, "type offset", site{dies: from},
+				"type signature 0x%x: bad type offset 0x%x in %s unit at offset 0x%x: %v",
+				sig, tus[0].TypeOffset, tus[0].Section, tus[0].Offset, err) {
+				ok = false
+			}
+		}
+	}
+	verb(1, "checked %d referenced type signatures", len(sigs))
+	return ok
+}
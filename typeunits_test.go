@@ -0,0 +1,70 @@
+package main
+
+import (
+	"debug/dwarf"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/thanm/dwarf-check/dwexaminer"
+)
+
+func TestTypeUnits(t *testing.T) {
+	cxx, err := exec.LookPath("g++")
+	if err != nil {
+		t.Skip("no g++ available")
+	}
+	for _, dwv := range []string{"-gdwarf-4", "-gdwarf-5"} {
+		exe := filepath.Join(t.TempDir(), "tu.exe")
+		cmd := exec.Command(cxx, "-g", dwv, "-fdebug-types-section",
+			"-o", exe, filepath.Join("testdata", "typeunits.cc"))
+		if b, err := cmd.CombinedOutput(); err != nil {
+			t.Logf("build: %s\n", b)
+			t.Skipf("g++ %s -fdebug-types-section failed: %v", dwv, err)
+		}
+		of, d := loadObj(t, exe)
+		ds, err := dwexaminer.NewDwExaminer(d.Reader())
+		if err != nil {
+			t.Fatalf("NewDwExaminer: %v", err)
+		}
+		n, err := indexTypeUnits(of, ds)
+		if err != nil {
+			t.Fatalf("%s: indexTypeUnits: %v", dwv, err)
+		}
+		if n == 0 {
+			t.Errorf("%s: no type units found", dwv)
+		}
+
+		// Collect signature references and make sure they resolve.
+		refs := make(map[uint64][]dwarf.Offset)
+		for _, off := range ds.DieOffsets() {
+			die, err := ds.LoadEntryByOffset(off)
+			if err != nil {
+				t.Fatalf("LoadEntryByOffset: %v", err)
+			}
+			for _, f := range die.Field {
+				if sig, ok := f.Val.(uint64); ok && f.Class == dwarf.ClassReferenceSig {
+					refs[sig] = append(refs[sig], off)
+				}
+			}
+		}
+		if len(refs) == 0 {
+			t.Errorf("%s: no ref_sig8 references found", dwv)
+		}
+		if !checkSignatures(ds, refs) {
+			t.Errorf("%s: checkSignatures failed on valid input", dwv)
+		}
+		for sig := range refs {
+			ent, tu, err := ds.ResolveSignature(sig)
+			if err != nil || ent == nil || !isIndexTypeTag(ent.Tag) {
+				t.Errorf("%s: ResolveSignature(0x%x) in %v = %v, %v", dwv, sig, tu, ent, err)
+			}
+		}
+
+		// A dangling signature should be flagged.
+		refs[0xdeadbeef] = []dwarf.Offset{0}
+		if checkSignatures(ds, refs) {
+			t.Errorf("%s: checkSignatures missed undefined signature", dwv)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+type unwindCheckMode int
+
+const (
+	noUnwindCheck  unwindCheckMode = 0
+	yesUnwindCheck unwindCheckMode = 1
+)
+
+// cfaRule is the rule for computing the CFA in effect at some
+// address: either register plus offset, or a DWARF expression.
+type cfaRule struct {
+	defined bool
+	expr    bool
+	reg     uint64
+	off     int64
+}
+
+func (r cfaRule) String() string {
+	switch {
+	case !r.defined:
+		return "undefined"
+	case r.expr:
+		return "expr"
+	}
+	return fmt.Sprintf("r%d%+d", r.reg, r.off)
+}
+
+// cfaRow is a row of the unwind table: the CFA rule in effect from
+// 'loc' up to the next row.
+type cfaRow struct {
+	loc uint64
+	cfa cfaRule
+}
+
+// cfaRows executes the CIE's initial instructions and then the FDE's
+// instructions to produce the CFA column of the FDE's unwind table.
+func cfaRows(f *cfiFDE, sect *cfiSection, order binary.ByteOrder) ([]cfaRow, error) {
+	initial, err := decodeCFA(f.cie.initial, f.cie, sect, order)
+	if err != nil {
+		return nil, fmt.Errorf("CIE at 0x%x: %v", f.cie.off, err)
+	}
+	insns, err := decodeCFA(f.insns, f.cie, sect, order)
+	if err != nil {
+		return nil, err
+	}
+	var cfa cfaRule
+	var stack []cfaRule
+	rows := []cfaRow{{loc: f.lowpc}}
+	exec := func(in cfaInsn, inFDE bool) error {
+		loc := rows[len(rows)-1].loc
+		switch in.op {
+		case dwCfaAdvanceLoc, dwCfaAdvanceLoc1, dwCfaAdvanceLoc2, dwCfaAdvanceLoc4, dwCfaSetLoc:
+			if !inFDE {
+				return fmt.Errorf("location change in CIE initial instructions")
+			}
+			nloc := loc + uint64(in.off)
+			if in.op == dwCfaSetLoc {
+				nloc = in.loc
+				if nloc < loc {
+					return fmt.Errorf("DW_CFA_set_loc moves back from 0x%x to 0x%x", loc, nloc)
+				}
+			}
+			if nloc > f.highpc {
+				return fmt.Errorf("row at 0x%x is beyond the FDE's end 0x%x", nloc, f.highpc)
+			}
+			// A row at the very end (as in binutils' PLT FDEs) never
+			// takes effect, but isn't an error either.
+			rows = append(rows, cfaRow{loc: nloc, cfa: cfa})
+			return nil
+		case dwCfaDefCfa, dwCfaDefCfaSf:
+			cfa = cfaRule{defined: true, reg: in.reg, off: in.off}
+		case dwCfaDefCfaRegister:
+			if !cfa.defined || cfa.expr {
+				return fmt.Errorf("DW_CFA_def_cfa_register at 0x%x without a register CFA rule", loc)
+			}
+			cfa.reg = in.reg
+		case dwCfaDefCfaOffset, dwCfaDefCfaOffsetSf:
+			if !cfa.defined || cfa.expr {
+				return fmt.Errorf("DW_CFA_def_cfa_offset at 0x%x without a register CFA rule", loc)
+			}
+			cfa.off = in.off
+		case dwCfaDefCfaExpression:
+			cfa = cfaRule{defined: true, expr: true}
+		case dwCfaRememberState:
+			stack = append(stack, cfa)
+		case dwCfaRestoreState:
+			if len(stack) == 0 {
+				return fmt.Errorf("DW_CFA_restore_state at 0x%x with no remembered state", loc)
+			}
+			cfa = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		default:
+			return nil
+		}
+		rows[len(rows)-1].cfa = cfa
+		return nil
+	}
+	for _, in := range initial {
+		if err := exec(in, false); err != nil {
+			return nil, fmt.Errorf("CIE at 0x%x: %v", f.cie.off, err)
+		}
+	}
+	for _, in := range insns {
+		if err := exec(in, true); err != nil {
+			return rows, err
+		}
+	}
+	return rows, nil
+}
+
+// ruleAt returns the CFA rule in effect at 'pc'.
+func ruleAt(rows []cfaRow, pc uint64) cfaRule {
+	i := sort.Search(len(rows), func(i int) bool { return rows[i].loc > pc })
+	if i == 0 {
+		return cfaRule{}
+	}
+	return rows[i-1].cfa
+}
+
+// arch returns the Go-style name of the object file's architecture,
+// or "" if it is not one we know how to find return points for.
+func (of *objFile) arch() string {
+	switch {
+	case of.ef != nil:
+		switch of.ef.Machine {
+		case elf.EM_X86_64:
+			return "amd64"
+		case elf.EM_386:
+			return "386"
+		case elf.EM_AARCH64:
+			return "arm64"
+		}
+	case of.mf != nil:
+		switch of.mf.Cpu {
+		case macho.CpuAmd64:
+			return "amd64"
+		case macho.Cpu386:
+			return "386"
+		case macho.CpuArm64:
+			return "arm64"
+		}
+	case of.pf != nil:
+		switch of.pf.Machine {
+		case pe.IMAGE_FILE_MACHINE_AMD64:
+			return "amd64"
+		case pe.IMAGE_FILE_MACHINE_I386:
+			return "386"
+		case pe.IMAGE_FILE_MACHINE_ARM64:
+			return "arm64"
+		}
+	}
+	return ""
+}
+
+// codeBytes returns the loaded contents of [lo, hi), or nil if that
+// range isn't within a single section with contents. Section contents
+// are kept in of.code, if the caller has set it up.
+func (of *objFile) codeBytes(lo, hi uint64) []byte {
+	read := func(sect interface{}, addr, size uint64, data func() ([]byte, error)) []byte {
+		if lo < addr || hi > addr+size || hi < lo {
+			return nil
+		}
+		b, ok := of.code[sect]
+		if !ok {
+			var err error
+			if b, err = data(); err != nil {
+				b = nil
+			}
+			if of.code != nil {
+				of.code[sect] = b
+			}
+		}
+		if uint64(len(b)) < hi-addr {
+			return nil
+		}
+		return b[lo-addr : hi-addr]
+	}
+	switch {
+	case of.ef != nil:
+		for _, s := range of.loadedELF().Sections {
+			if s.Flags&elf.SHF_ALLOC != 0 && s.Type == elf.SHT_PROGBITS {
+				if b := read(s, s.Addr, s.Size, s.Data); b != nil {
+					return b
+				}
+			}
+		}
+	case of.mf != nil:
+		for _, s := range of.mf.Sections {
+			if b := read(s, s.Addr, s.Size, s.Data); b != nil {
+				return b
+			}
+		}
+	case of.pf != nil:
+		var base uint64
+		switch oh := of.pf.OptionalHeader.(type) {
+		case *pe.OptionalHeader32:
+			base = uint64(oh.ImageBase)
+		case *pe.OptionalHeader64:
+			base = oh.ImageBase
+		}
+		for _, s := range of.pf.Sections {
+			if b := read(s, base+uint64(s.VirtualAddress), uint64(s.VirtualSize), s.Data); b != nil {
+				return b
+			}
+		}
+	}
+	return nil
+}
+
+// arm64Ret is the encoding of "RET" (i.e. RET X30).
+const arm64Ret = 0xd65f03c0
+
+// returnPoints returns the addresses of the likely return
+// instructions within an FDE's range, given its code and unwind
+// rows. This is heuristic. On x86 we can't reliably decode the
+// instruction stream, so we only consider RET opcodes at the start
+// of a row, where an epilogue's final stack adjustment leaves the
+// return. (A 0xc3 byte elsewhere, even at the end of the function,
+// may be part of another instruction.) On arm64 every aligned RET
+// instruction is a return point.
+func returnPoints(arch string, f *cfiFDE, code []byte, rows []cfaRow, order binary.ByteOrder) []uint64 {
+	var rv []uint64
+	switch arch {
+	case "amd64", "386":
+		isRet := func(pc uint64) bool {
+			i := pc - f.lowpc
+			return i < uint64(len(code)) && (code[i] == 0xc3 || code[i] == 0xc2)
+		}
+		seen := make(map[uint64]bool)
+		for _, r := range rows {
+			if !seen[r.loc] && isRet(r.loc) {
+				seen[r.loc] = true
+				rv = append(rv, r.loc)
+			}
+		}
+	case "arm64":
+		for i := 0; i+4 <= len(code); i += 4 {
+			if order.Uint32(code[i:]) == arm64Ret {
+				rv = append(rv, f.lowpc+uint64(i))
+			}
+		}
+	}
+	return rv
+}
+
+// checkFDEUnwind simulates an FDE's unwind table and checks that a
+// CFA rule is defined throughout, and that the rule in effect at
+// each return point is the same as at entry.
+func checkFDEUnwind(of *objFile, arch string, f *cfiFDE, sect *cfiSection, name string) (int, bool) {
+	order := of.byteOrder()
+	what := fmt.Sprintf("%s: FDE at 0x%x [0x%x,0x%x)", sect.name, f.off, f.lowpc, f.highpc)
+	fname := sect.name
+	if name != "" {
+		what += " (" + name + ")"
+		fname = name
+	}
+	at := site{fn: name, pc: f.lowpc}
+	rows, err := cfaRows(f, sect, order)
+	if err != nil {
+		return 0, !reportf("unwind", fname, "decode", at, "%s: %v", what, err)
+	}
+	ok := true
+	for _, r := range rows {
+		if !r.cfa.defined {
+			ok = !reportf("unwind", fname, "no CFA rule", at, "%s: no CFA rule at 0x%x", what, r.loc)
+			break
+		}
+	}
+	entry := rows[0].cfa
+	if !ok || entry.expr || arch == "" {
+		return 0, ok
+	}
+	code := of.codeBytes(f.lowpc, f.highpc)
+	if code == nil {
+		verb(2, "%s: code not available", what)
+		return 0, ok
+	}
+	rps := returnPoints(arch, f, code, rows, order)
+	for _, pc := range rps {
+		rule := ruleAt(rows, pc)
+		if rule.expr || rule == entry {
+			continue
+		}
+		if reportf("unwind", fname, "return CFA", at, "%s: CFA at return point 0x%x is %v, but %v at entry", what, pc, rule, entry) {
+			ok = false
+		}
+	}
+	return len(rps), ok
+}
+
+// checkUnwind simulates the unwind tables of every FDE in the object
+// file, checking for stack pointer imbalance at return points and
+// for code with no CFA rule. Returns false if problems were found.
+func checkUnwind(of *objFile, d *dwarf.Data) (bool, error) {
+	if of.ef != nil && of.ef.Type == elf.ET_REL {
+		verb(1, "skipping unwind check for relocatable object")
+		return true, nil
+	}
+	sects, err := cfiSections(of)
+	if err != nil {
+		return false, err
+	}
+	of.code = make(map[interface{}][]byte)
+	defer func() { of.code = nil }()
+
+	// Name FDEs after the subprograms they describe, where possible.
+	names := make(map[uint64]string)
+	rdr := d.Reader()
+	for {
+		ent, err := rdr.Next()
+		if err != nil {
+			return false, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag != dwarf.TagSubprogram {
+			continue
+		}
+		if lo, ok := ent.Val(dwarf.AttrLowpc).(uint64); ok {
+			if name, ok := ent.Val(dwarf.AttrName).(string); ok {
+				names[lo] = name
+			}
+		}
+	}
+
+	arch := of.arch()
+	if arch == "" {
+		verb(1, "return points not identified for this architecture; checking CFA rules only")
+	}
+	ok := true
+	nfde, nret := 0, 0
+	for _, sect := range sects {
+		tab, errs := parseCFI(sect, of.byteOrder(), of.addrSize())
+		for _, err := range errs {
+			if reportf("unwind", sect.name, "decode", site{}, "%s: %v", sect.name, err) {
+				ok = false
+			}
+		}
+		for _, f := range tab.fdes {
+			if isDiscardedFDE(f, of.addrSize()) {
+				continue
+			}
+			nfde++
+			n, fok := checkFDEUnwind(of, arch, f, sect, names[f.lowpc])
+			nret += n
+			ok = ok && fok
+		}
+	}
+	verb(1, "simulated %d FDEs, checked %d return points", nfde, nret)
+	return ok, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// amd64 frame for a function with a push/pop epilogue in the middle:
+//
+//	0x1000: push rbp        ; cfa rsp+8
+//	0x1001: ...             ; cfa rsp+16
+//	0x1005: pop rbp
+//	0x1006: ret             ; cfa rsp+8
+//	0x1007: ...             ; cfa rsp+16 (restored)
+//	0x100a: pop rbp
+//	0x100b: ret             ; cfa rsp+8
+func testFrame(epilogue []byte) (*cfiFDE, []byte) {
+	cie := &cfiCIE{addrSize: 8, codeAlign: 1, dataAlign: -8,
+		initial: []byte{dwCfaDefCfa, 7, 8, dwCfaOffset | 16, 1}}
+	insns := []byte{
+		dwCfaAdvanceLoc | 1, dwCfaDefCfaOffset, 16,
+		dwCfaRememberState,
+		dwCfaAdvanceLoc | 5, dwCfaDefCfaOffset, 8,
+		dwCfaAdvanceLoc | 1, dwCfaRestoreState,
+	}
+	insns = append(insns, epilogue...)
+	code := []byte{0x55, 0x90, 0x90, 0x90, 0x90, 0x5d, 0xc3, 0x90, 0x90, 0x90, 0x5d, 0xc3}
+	return &cfiFDE{cie: cie, lowpc: 0x1000, highpc: 0x100c, insns: insns}, code
+}
+
+func TestCFARows(t *testing.T) {
+	sect := &cfiSection{name: ".debug_frame"}
+	for _, tc := range []struct {
+		epilogue []byte
+		rets     int
+		balanced bool
+	}{
+		{[]byte{dwCfaAdvanceLoc | 4, dwCfaDefCfaOffset, 8}, 2, true},
+		// Without the final pop's adjustment, no row starts at the
+		// final ret, which might as well be the end of some other
+		// instruction.
+		{nil, 1, true},
+	} {
+		f, code := testFrame(tc.epilogue)
+		rows, err := cfaRows(f, sect, binary.LittleEndian)
+		if err != nil {
+			t.Fatalf("cfaRows: %v", err)
+		}
+		for pc, want := range map[uint64]int64{0x1000: 8, 0x1003: 16, 0x1006: 8, 0x1008: 16} {
+			if r := ruleAt(rows, pc); r.reg != 7 || r.off != want {
+				t.Errorf("rule at 0x%x is %v, want r7%+d", pc, r, want)
+			}
+		}
+		rps := returnPoints("amd64", f, code, rows, binary.LittleEndian)
+		balanced := len(rps) == tc.rets
+		for _, pc := range rps {
+			if ruleAt(rows, pc) != rows[0].cfa {
+				balanced = false
+			}
+		}
+		if balanced != tc.balanced {
+			t.Errorf("epilogue % x: return points %x, balanced %v, want %v",
+				tc.epilogue, rps, balanced, tc.balanced)
+		}
+	}
+
+	// Rows past the end of the FDE and unmatched restore_state are
+	// rejected.
+	for _, bad := range [][]byte{
+		{dwCfaAdvanceLoc1, 0x20},
+		{dwCfaRestoreState},
+	} {
+		f, _ := testFrame(nil)
+		f.insns = bad
+		if _, err := cfaRows(f, sect, binary.LittleEndian); err == nil {
+			t.Errorf("cfaRows(% x) succeeded", bad)
+		}
+	}
+}
+
+func TestCheckUnwind(t *testing.T) {
+	exe := buildSelf(t, t.TempDir(), noExtra)
+	of, d := loadObj(t, exe)
+	if ok, err := checkUnwind(of, d); err != nil || !ok {
+		t.Errorf("checkUnwind(%s/%s) = %v, %v", runtime.GOOS, runtime.GOARCH, ok, err)
+	}
+	if of.code != nil {
+		t.Errorf("checkUnwind left section contents cached")
+	}
+
+	// With of.code set up, codeBytes reads each section only once.
+	if of.ef != nil && of.ef.Section(".text") != nil {
+		s := of.ef.Section(".text")
+		of.code = make(map[interface{}][]byte)
+		a, b := of.codeBytes(s.Addr, s.Addr+16), of.codeBytes(s.Addr+16, s.Addr+32)
+		if len(a) != 16 || len(b) != 16 || len(of.code) != 1 || &a[:32][16] != &b[0] {
+			t.Errorf("codeBytes did not reuse the contents of .text")
+		}
+		of.code = nil
+	}
+
+	// Also check a linux/arm64 build, for the other return point
+	// heuristic.
+	if runtime.GOARCH == "arm64" {
+		return
+	}
+	armexe := filepath.Join(t.TempDir(), "fixture.arm64")
+	gotoolpath := filepath.Join(runtime.GOROOT(), "bin", "go")
+	cmd := exec.Command(gotoolpath, "build", "-o", armexe, filepath.Join("testdata", "layout.go"))
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=arm64", "CGO_ENABLED=0")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Logf("build: %s\n", b)
+		t.Fatalf("build error: %v", err)
+	}
+	of, d = loadObj(t, armexe)
+	if of.arch() != "arm64" {
+		t.Fatalf("arch() = %q, want arm64", of.arch())
+	}
+	if ok, err := checkUnwind(of, d); err != nil || !ok {
+		t.Errorf("checkUnwind(linux/arm64) = %v, %v", ok, err)
+	}
+}